@@ -0,0 +1,147 @@
+// Command capturefixtures records the InnerTube responses the parsers in
+// services are tested against. It sends the requests musiq sends, drops the
+// tracking, logging and accessibility fields no parser reads and writes the
+// rest to the fixture directory:
+//
+//	go run ./cmd/capturefixtures -out services/testdata
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"musiq/config"
+)
+
+// unreadKeys are response fields no parser reads. They make up most of a
+// response and change with every request.
+var unreadKeys = map[string]bool{
+	"responseContext":     true,
+	"trackingParams":      true,
+	"clickTrackingParams": true,
+	"loggingContext":      true,
+	"loggingDirectives":   true,
+	"frameworkUpdates":    true,
+	"accessibility":       true,
+	"accessibilityData":   true,
+	"commandMetadata":     true,
+	"adSignalsInfo":       true,
+}
+
+// capture is one recorded request
+type capture struct {
+	file     string
+	baseURL  string
+	client   string
+	version  string
+	endpoint string
+	payload  map[string]any
+}
+
+func main() {
+	out := flag.String("out", "services/testdata", "directory the fixtures are written to")
+	query := flag.String("query", "lofi", "query of the web search")
+	musicQuery := flag.String("music-query", "daft punk", "query of the music search")
+	playlist := flag.String("playlist", "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", "playlist whose browse page is recorded")
+	mix := flag.String("mix", "RDdQw4w9WgXcQ", "mix whose watch-next page is recorded")
+	flag.Parse()
+
+	defaults := config.Default().YouTube
+	captures := []capture{
+		{file: "search_web.json", baseURL: "https://www.youtube.com", client: "WEB", version: defaults.ClientVersion,
+			endpoint: "search", payload: map[string]any{"query": *query}},
+		{file: "next_mix.json", baseURL: "https://www.youtube.com", client: "WEB", version: defaults.ClientVersion,
+			endpoint: "next", payload: map[string]any{"playlistId": *mix}},
+		{file: "browse_playlist.json", baseURL: "https://www.youtube.com", client: "WEB", version: defaults.ClientVersion,
+			endpoint: "browse", payload: map[string]any{"browseId": "VL" + *playlist}},
+		{file: "search_music.json", baseURL: "https://music.youtube.com", client: "WEB_REMIX", version: defaults.MusicClientVersion,
+			endpoint: "search", payload: map[string]any{"query": *musicQuery}},
+	}
+
+	httpClient := &http.Client{Timeout: defaults.Timeout}
+	for _, c := range captures {
+		response, err := c.record(httpClient, defaults)
+		if err != nil {
+			log.Fatalf("Failed to record %s: %v", c.file, err)
+		}
+		data, err := json.MarshalIndent(trim(response), "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode %s: %v", c.file, err)
+		}
+		if err := os.WriteFile(filepath.Join(*out, c.file), append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", c.file, err)
+		}
+		log.Printf("Recorded %s (%d bytes)", c.file, len(data))
+	}
+	log.Printf("Captured on %s with client versions %s and %s", time.Now().Format(time.DateOnly), defaults.ClientVersion, defaults.MusicClientVersion)
+}
+
+// record sends the request and decodes its response
+func (c capture) record(httpClient *http.Client, defaults config.YouTube) (any, error) {
+	payload := map[string]any{
+		"context": map[string]any{
+			"client": map[string]any{
+				"clientName":    c.client,
+				"clientVersion": c.version,
+				"hl":            defaults.HL,
+				"gl":            defaults.GL,
+			},
+		},
+	}
+	for k, v := range c.payload {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/youtubei/v1/"+c.endpoint+"?prettyPrint=false", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", defaults.UserAgent)
+	req.Header.Set("Origin", c.baseURL)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var response any
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// trim drops the unread fields from a decoded response
+func trim(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if unreadKeys[key] {
+				delete(v, key)
+				continue
+			}
+			v[key] = trim(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = trim(value)
+		}
+	}
+	return v
+}
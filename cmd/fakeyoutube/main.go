@@ -0,0 +1,28 @@
+// Command fakeyoutube runs a local stand-in for YouTube. Point musiq at it
+// with YOUTUBE_BASE_URL=http://localhost:8090.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"musiq/internal/fakeyoutube"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	fixtures := flag.String("fixtures", "services/testdata", "directory of InnerTube response fixtures")
+	media := flag.String("media", "", "media file served for every stream (default: synthetic bytes)")
+	verbose := flag.Bool("verbose", false, "log every request")
+	flag.Parse()
+
+	server := fakeyoutube.New(*fixtures)
+	server.MediaFile = *media
+	server.Verbose = *verbose
+
+	log.Printf("Fake YouTube listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("Failed to start fake YouTube: %v", err)
+	}
+}
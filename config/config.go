@@ -0,0 +1,439 @@
+// Package config loads the server configuration. Every setting has a
+// default and can be set in a YAML file, with an environment variable and
+// with a command-line flag, later sources overriding earlier ones.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Config is the server configuration
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Log        Log        `yaml:"log"`
+	FFmpeg     FFmpeg     `yaml:"ffmpeg"`
+	CORS       CORS       `yaml:"cors"`
+	RateLimit  RateLimit  `yaml:"rateLimit"`
+	Auth       Auth       `yaml:"auth"`
+	YouTube    YouTube    `yaml:"youtube"`
+	Thumbnails Thumbnails `yaml:"thumbnails"`
+	Library    Library    `yaml:"library"`
+	Suggest    Suggest    `yaml:"suggest"`
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Port    int    `yaml:"port"`
+	GinMode string `yaml:"ginMode"`
+	// ShutdownTimeout is how long in-flight streams may run after a
+	// shutdown signal before they are cut off
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// TrustedProxies are the IPs and CIDR ranges whose X-Forwarded-For
+	// headers name the client; other peers are the client themselves
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+// Log configures the server log
+type Log struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is json, or text for logfmt-style lines
+	Format string `yaml:"format"`
+}
+
+// FFmpeg configures audio conversion and muxing
+type FFmpeg struct {
+	Path string `yaml:"path"`
+	// AudioCodec and AudioQuality are used for MP3 conversion
+	AudioCodec   string `yaml:"audioCodec"`
+	AudioQuality string `yaml:"audioQuality"`
+	// MuxAudioCodec is the audio codec of muxed MP4 videos
+	MuxAudioCodec string `yaml:"muxAudioCodec"`
+	// TempDir holds the FIFOs and temporary files of muxing
+	TempDir string `yaml:"tempDir"`
+}
+
+// CORS configures cross-origin requests. The policy applies to every
+// route group that Groups doesn't override.
+type CORS struct {
+	CORSPolicy `yaml:",inline"`
+	// Groups override the policy of the api, media, ui and admin route
+	// groups
+	Groups map[string]CORSOverride `yaml:"groups,omitempty"`
+}
+
+// CORSPolicy is the cross-origin policy of a route group
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as https://app.example.com, wildcard
+	// subdomains such as https://*.example.com, or * for any site
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// AllowCredentials lets allowed origins send cookies, such as the web
+	// UI's API key, with their requests
+	AllowCredentials bool `yaml:"allowCredentials"`
+	// MaxAge is how long browsers may cache preflight results; 0 leaves it
+	// to the browser
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// CORSOverride changes the policy of a route group. Fields left unset keep
+// the value of the default policy.
+type CORSOverride struct {
+	AllowedOrigins   []string       `yaml:"allowedOrigins,omitempty"`
+	AllowCredentials *bool          `yaml:"allowCredentials,omitempty"`
+	MaxAge           *time.Duration `yaml:"maxAge,omitempty"`
+}
+
+// CORSGroups are the route groups CORS.Groups can override
+var CORSGroups = []string{"api", "media", "ui", "admin"}
+
+// Policy returns the policy of a route group, with its override applied
+func (c CORS) Policy(group string) CORSPolicy {
+	policy := c.CORSPolicy
+	override, ok := c.Groups[group]
+	if !ok {
+		return policy
+	}
+	if override.AllowedOrigins != nil {
+		policy.AllowedOrigins = override.AllowedOrigins
+	}
+	if override.AllowCredentials != nil {
+		policy.AllowCredentials = *override.AllowCredentials
+	}
+	if override.MaxAge != nil {
+		policy.MaxAge = *override.MaxAge
+	}
+	return policy
+}
+
+// RateLimit configures the per-client token buckets. Each budget refills
+// at its per-minute rate up to its burst; a rate of 0 disables it.
+type RateLimit struct {
+	// API budgets JSON API and web UI requests
+	APIPerMinute int `yaml:"apiPerMinute"`
+	APIBurst     int `yaml:"apiBurst"`
+	// Stream budgets listen and watch requests, which run ffmpeg and
+	// download from upstream
+	StreamPerMinute int `yaml:"streamPerMinute"`
+	StreamBurst     int `yaml:"streamBurst"`
+	// Allowlist holds the IPs, CIDR ranges and API key names of trusted
+	// clients, which are never limited. Key names refer to the keys of
+	// Auth.KeysFile, so no secret is kept here.
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// Auth configures API key authentication
+type Auth struct {
+	// KeysFile is the YAML file of API keys and their scopes; every request
+	// is allowed when it is empty
+	KeysFile string `yaml:"keysFile"`
+}
+
+// YouTube configures the upstream YouTube requests and their caches
+type YouTube struct {
+	// BaseURL receives every youtube.com request when set, for a proxy or
+	// a local stand-in
+	BaseURL string `yaml:"baseURL"`
+	// MusicBaseURL receives YouTube Music API requests; it defaults to
+	// BaseURL when that is set
+	MusicBaseURL       string        `yaml:"musicBaseURL"`
+	ThumbnailBaseURL   string        `yaml:"thumbnailBaseURL"`
+	SuggestBaseURL     string        `yaml:"suggestBaseURL"`
+	Timeout            time.Duration `yaml:"timeout"`
+	UserAgent          string        `yaml:"userAgent"`
+	ClientVersion      string        `yaml:"clientVersion"`
+	MusicClientVersion string        `yaml:"musicClientVersion"`
+	HL                 string        `yaml:"hl"`
+	GL                 string        `yaml:"gl"`
+	SearchCacheTTL     time.Duration `yaml:"searchCacheTTL"`
+	PlaylistCacheTTL   time.Duration `yaml:"playlistCacheTTL"`
+	CacheStaleTTL      time.Duration `yaml:"cacheStaleTTL"`
+	VideoCacheSize     int           `yaml:"videoCacheSize"`
+	ResponseCacheSize  int           `yaml:"responseCacheSize"`
+	RetryAttempts      int           `yaml:"retryAttempts"`
+	RetryBackoff       time.Duration `yaml:"retryBackoff"`
+	PlayerClients      []string      `yaml:"playerClients"`
+}
+
+// Thumbnails configures the thumbnail proxy
+type Thumbnails struct {
+	CacheDir string `yaml:"cacheDir"`
+	// ProxyURL, such as "/api/thumb", makes API and UI thumbnails point at
+	// the proxy instead of i.ytimg.com
+	ProxyURL string `yaml:"proxyURL"`
+}
+
+// Library configures the local music library
+type Library struct {
+	// Dir is the library root; the library is disabled when it is empty
+	Dir string `yaml:"dir"`
+}
+
+// Suggest configures search autocompletion
+type Suggest struct {
+	// Provider is "youtube", or "local" for search history only
+	Provider string `yaml:"provider"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8080,
+			GinMode:         "release",
+			ShutdownTimeout: 30 * time.Second,
+			TrustedProxies:  []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"},
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		FFmpeg: FFmpeg{
+			Path:          "ffmpeg",
+			AudioCodec:    "libmp3lame",
+			AudioQuality:  "0",
+			MuxAudioCodec: "aac",
+			TempDir:       os.TempDir(),
+		},
+		CORS: CORS{
+			CORSPolicy: CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				MaxAge:         10 * time.Minute,
+			},
+		},
+		RateLimit: RateLimit{
+			APIPerMinute:    300,
+			APIBurst:        60,
+			StreamPerMinute: 30,
+			StreamBurst:     10,
+		},
+		YouTube: YouTube{
+			ThumbnailBaseURL:   "https://i.ytimg.com",
+			SuggestBaseURL:     "https://suggestqueries.google.com",
+			Timeout:            20 * time.Second,
+			UserAgent:          "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+			ClientVersion:      "2.20231219.04.00",
+			MusicClientVersion: "1.20231219.01.00",
+			HL:                 "en",
+			GL:                 "US",
+			SearchCacheTTL:     10 * time.Minute,
+			PlaylistCacheTTL:   30 * time.Minute,
+			CacheStaleTTL:      time.Hour,
+			VideoCacheSize:     500,
+			ResponseCacheSize:  1000,
+			RetryAttempts:      3,
+			RetryBackoff:       250 * time.Millisecond,
+			PlayerClients:      []string{"android", "ios", "tv"},
+		},
+		Thumbnails: Thumbnails{
+			CacheDir: filepath.Join(os.TempDir(), "musiq-thumbnails"),
+		},
+		Suggest: Suggest{
+			Provider: "youtube",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the file named by
+// -config or MUSIQ_CONFIG, the environment and the flags in args, in that
+// order of precedence. The setting flags are registered on fs, so callers
+// can add their own flags before calling Load.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	configFile := fs.String("config", os.Getenv("MUSIQ_CONFIG"), "YAML configuration file")
+	for _, s := range settings {
+		fs.Var(fieldValue{s.field(cfg)}, s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Flags were applied while parsing; remember them so they can be
+	// applied again over the file and the environment
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setField(s.field(cfg), value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", s.env, value, err)
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flags[s.flag]; ok {
+			setField(s.field(cfg), value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalWithOptions(data, cfg, yaml.Strict()); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the settings are usable, reporting every problem
+// at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(slices.Contains([]string{"debug", "release", "test"}, c.Server.GinMode), "server.ginMode must be debug, release or test, got %q", c.Server.GinMode)
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdownTimeout must not be negative")
+	for _, proxy := range c.Server.TrustedProxies {
+		check(isIPOrPrefix(proxy), "server.trustedProxies: %q is not an IP or CIDR range", proxy)
+	}
+
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, c.Log.Level), "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(slices.Contains([]string{"json", "text"}, c.Log.Format), "log.format must be json or text, got %q", c.Log.Format)
+
+	check(c.FFmpeg.Path != "", "ffmpeg.path must be set")
+	check(c.FFmpeg.AudioCodec != "", "ffmpeg.audioCodec must be set")
+	check(c.FFmpeg.MuxAudioCodec != "", "ffmpeg.muxAudioCodec must be set")
+	if info, err := os.Stat(c.FFmpeg.TempDir); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("ffmpeg.tempDir %q is not a directory", c.FFmpeg.TempDir))
+	}
+
+	checkCORS := func(field string, policy CORSPolicy) {
+		check(len(policy.AllowedOrigins) > 0, "%s.allowedOrigins must not be empty", field)
+		for _, origin := range policy.AllowedOrigins {
+			check(validOrigin(origin), "%s.allowedOrigins: %q is not *, an origin such as https://example.com or a pattern such as https://*.example.com", field, origin)
+		}
+		check(!policy.AllowCredentials || !slices.Contains(policy.AllowedOrigins, "*"), "%s.allowCredentials can't be combined with the * origin", field)
+		check(policy.MaxAge >= 0, "%s.maxAge must not be negative", field)
+	}
+	checkCORS("cors", c.CORS.CORSPolicy)
+	for group := range c.CORS.Groups {
+		check(slices.Contains(CORSGroups, group), "cors.groups: unknown route group %q", group)
+	}
+	for _, group := range CORSGroups {
+		if _, ok := c.CORS.Groups[group]; ok {
+			checkCORS("cors.groups."+group, c.CORS.Policy(group))
+		}
+	}
+
+	rl := c.RateLimit
+	check(rl.APIPerMinute >= 0, "rateLimit.apiPerMinute must not be negative")
+	check(rl.APIPerMinute == 0 || rl.APIBurst > 0, "rateLimit.apiBurst must be positive")
+	check(rl.StreamPerMinute >= 0, "rateLimit.streamPerMinute must not be negative")
+	check(rl.StreamPerMinute == 0 || rl.StreamBurst > 0, "rateLimit.streamBurst must be positive")
+	for _, entry := range rl.Allowlist {
+		_, prefixErr := netip.ParsePrefix(entry)
+		_, addrErr := netip.ParseAddr(entry)
+		check(prefixErr == nil || addrErr == nil || c.Auth.KeysFile != "", "rateLimit.allowlist: %q is neither an IP nor a CIDR range, and API key names need auth.keysFile", entry)
+	}
+
+	if c.Auth.KeysFile != "" {
+		if info, err := os.Stat(c.Auth.KeysFile); err != nil || info.IsDir() {
+			errs = append(errs, fmt.Errorf("auth.keysFile %q is not a file", c.Auth.KeysFile))
+		}
+	}
+
+	y := c.YouTube
+	for _, u := range []struct {
+		name, value string
+		optional    bool
+	}{
+		{"youtube.baseURL", y.BaseURL, true},
+		{"youtube.musicBaseURL", y.MusicBaseURL, true},
+		{"youtube.thumbnailBaseURL", y.ThumbnailBaseURL, false},
+		{"youtube.suggestBaseURL", y.SuggestBaseURL, false},
+	} {
+		if u.value == "" && u.optional {
+			continue
+		}
+		parsed, err := url.Parse(u.value)
+		check(err == nil && parsed.Scheme != "" && parsed.Host != "", "%s must be an absolute URL, got %q", u.name, u.value)
+	}
+	check(y.Timeout > 0, "youtube.timeout must be positive")
+	check(y.SearchCacheTTL >= 0, "youtube.searchCacheTTL must not be negative")
+	check(y.PlaylistCacheTTL >= 0, "youtube.playlistCacheTTL must not be negative")
+	check(y.CacheStaleTTL >= 0, "youtube.cacheStaleTTL must not be negative")
+	check(y.VideoCacheSize > 0, "youtube.videoCacheSize must be positive")
+	check(y.ResponseCacheSize > 0, "youtube.responseCacheSize must be positive")
+	check(y.RetryAttempts > 0, "youtube.retryAttempts must be positive")
+	check(y.RetryBackoff >= 0, "youtube.retryBackoff must not be negative")
+	check(len(y.PlayerClients) > 0, "youtube.playerClients must not be empty")
+	for _, name := range y.PlayerClients {
+		check(slices.Contains(PlayerClients, name), "youtube.playerClients: unknown client %q", name)
+	}
+
+	check(c.Thumbnails.CacheDir != "", "thumbnails.cacheDir must be set")
+	check(slices.Contains([]string{"youtube", "local"}, c.Suggest.Provider), "suggest.provider must be youtube or local, got %q", c.Suggest.Provider)
+
+	if c.Library.Dir != "" {
+		if info, err := os.Stat(c.Library.Dir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("library.dir %q is not a directory", c.Library.Dir))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validOrigin reports whether s is *, a scheme and host with an optional
+// port, or such an origin whose host starts with a *. wildcard label
+func validOrigin(s string) bool {
+	if s == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.Replace(s, "://*.", "://wildcard.", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil {
+		return false
+	}
+	return u.Path == "" && u.RawQuery == "" && u.Fragment == "" && !strings.Contains(u.Host, "*")
+}
+
+// isIPOrPrefix reports whether s is an IP address or a CIDR range
+func isIPOrPrefix(s string) bool {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(s)
+	return err == nil
+}
+
+// PlayerClients are the InnerTube clients youtube.playerClients can name
+var PlayerClients = []string{"android", "ios", "tv"}
+
+// YAML returns the configuration in the config file format
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every setting's environment variable for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("MUSIQ_CONFIG", "")
+	for _, s := range settings {
+		t.Setenv(s.env, "")
+	}
+}
+
+// writeConfig writes a YAML configuration file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "musiq.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+// load calls Load with a fresh flag set
+func load(args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("musiq", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := "server:\n  port: 9000\nlog:\n  level: debug\nffmpeg:\n  path: /opt/ffmpeg/bin/ffmpeg\n"
+
+	type want struct {
+		port   int
+		level  string
+		ffmpeg string
+	}
+	tests := []struct {
+		name string
+		file bool
+		env  map[string]string
+		args []string
+		want want
+	}{
+		{name: "defaults", want: want{8080, "info", "ffmpeg"}},
+		{name: "file", file: true, want: want{9000, "debug", "/opt/ffmpeg/bin/ffmpeg"}},
+		{name: "env over file", file: true, env: map[string]string{"PORT": "9100", "LOG_LEVEL": "warn"}, want: want{9100, "warn", "/opt/ffmpeg/bin/ffmpeg"}},
+		{name: "flags over env", file: true, env: map[string]string{"PORT": "9100", "LOG_LEVEL": "warn"}, args: []string{"-port", "9200"}, want: want{9200, "warn", "/opt/ffmpeg/bin/ffmpeg"}},
+		// A flag wins even when it sets the default value
+		{name: "flag set to default", env: map[string]string{"PORT": "9100"}, args: []string{"-port", "8080"}, want: want{8080, "info", "ffmpeg"}},
+		{name: "empty env ignored", file: true, env: map[string]string{"PORT": ""}, want: want{9000, "debug", "/opt/ffmpeg/bin/ffmpeg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			if tt.file {
+				t.Setenv("MUSIQ_CONFIG", writeConfig(t, file))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := load(tt.args...)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			got := want{cfg.Server.Port, cfg.Log.Level, cfg.FFmpeg.Path}
+			if got != tt.want {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MUSIQ_CONFIG", writeConfig(t, "server:\n  port: 9000\n"))
+
+	cfg, err := load("-config", writeConfig(t, "server:\n  port: 9001\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 9001 {
+		t.Errorf("port = %d, want 9001 from the -config file", cfg.Server.Port)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(*Config) bool
+		// err is part of the expected error, if any
+		err string
+	}{
+		{name: "duration", env: map[string]string{"SHUTDOWN_TIMEOUT": "45s"},
+			check: func(c *Config) bool { return c.Server.ShutdownTimeout == 45*time.Second }},
+		{name: "list", env: map[string]string{"TRUSTED_PROXIES": " 10.0.0.1, 10.0.0.0/8,"},
+			check: func(c *Config) bool { return slices.Equal(c.Server.TrustedProxies, []string{"10.0.0.1", "10.0.0.0/8"}) }},
+		{name: "bool", env: map[string]string{"CORS_ALLOWED_ORIGINS": "https://*.example.com", "CORS_ALLOW_CREDENTIALS": "true"},
+			check: func(c *Config) bool { return c.CORS.AllowCredentials && c.CORS.AllowedOrigins[0] == "https://*.example.com" }},
+		{name: "int", env: map[string]string{"RATE_LIMIT_API_BURST": "7"},
+			check: func(c *Config) bool { return c.RateLimit.APIBurst == 7 }},
+		{name: "bad int", env: map[string]string{"PORT": "eighty"}, err: `invalid PORT "eighty": not an integer`},
+		{name: "bad bool", env: map[string]string{"CORS_ALLOW_CREDENTIALS": "sometimes"}, err: "not true or false"},
+		{name: "bad duration", env: map[string]string{"YOUTUBE_TIMEOUT": "20"}, err: "not a duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := load()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Load() = %+v, want %v applied", cfg, tt.env)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "unknown key", content: "server:\n  prot: 9000\n", err: "failed to parse config file"},
+		{name: "wrong type", content: "server:\n  port: high\n", err: "failed to parse config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			_, err := load("-config", writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	clearEnv(t)
+	if _, err := load("-config", filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Load() of a missing file error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		// errs are parts of the expected error, all reported at once
+		errs []string
+	}{
+		{name: "defaults", modify: func(*Config) {}},
+		{name: "port", modify: func(c *Config) { c.Server.Port = 70000 }, errs: []string{"server.port must be between 1 and 65535"}},
+		{name: "gin mode", modify: func(c *Config) { c.Server.GinMode = "prod" }, errs: []string{"server.ginMode"}},
+		{name: "trusted proxy", modify: func(c *Config) { c.Server.TrustedProxies = []string{"proxy.local"} }, errs: []string{`"proxy.local" is not an IP or CIDR range`}},
+		{name: "log format", modify: func(c *Config) { c.Log.Format = "xml" }, errs: []string{"log.format"}},
+		{name: "ffmpeg path", modify: func(c *Config) { c.FFmpeg.Path = "" }, errs: []string{"ffmpeg.path must be set"}},
+		{name: "temp dir", modify: func(c *Config) { c.FFmpeg.TempDir = "/nonexistent/musiq" }, errs: []string{"ffmpeg.tempDir"}},
+		{name: "credentials with any origin", modify: func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			c.CORS.AllowCredentials = true
+		}, errs: []string{"cors.allowCredentials can't be combined with the * origin"}},
+		{name: "origin with path", modify: func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }, errs: []string{"cors.allowedOrigins"}},
+		{name: "unknown CORS group", modify: func(c *Config) { c.CORS.Groups = map[string]CORSOverride{"stream": {}} }, errs: []string{`unknown route group "stream"`}},
+		{name: "burst", modify: func(c *Config) { c.RateLimit.APIBurst = 0 }, errs: []string{"rateLimit.apiBurst must be positive"}},
+		{name: "relative base URL", modify: func(c *Config) { c.YouTube.SuggestBaseURL = "suggest.local" }, errs: []string{"youtube.suggestBaseURL must be an absolute URL"}},
+		{name: "timeout", modify: func(c *Config) { c.YouTube.Timeout = 0 }, errs: []string{"youtube.timeout must be positive"}},
+		{name: "suggest provider", modify: func(c *Config) { c.Suggest.Provider = "bing" }, errs: []string{"suggest.provider must be youtube or local"}},
+		{name: "library dir", modify: func(c *Config) { c.Library.Dir = "/nonexistent/music" }, errs: []string{"library.dir"}},
+		{name: "several", modify: func(c *Config) {
+			c.Server.Port = 0
+			c.Log.Level = "trace"
+			c.Suggest.Provider = ""
+		}, errs: []string{"server.port", "log.level", "suggest.provider"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds a configuration field to its environment variable and flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	field func(*Config) any
+}
+
+// settings lists every field that can be set from the environment and the
+// command line. Environment names predate the config file and are kept.
+var settings = []setting{
+	{"PORT", "port", "HTTP listen port", func(c *Config) any { return &c.Server.Port }},
+	{"GIN_MODE", "gin-mode", "Gin mode: debug, release or test", func(c *Config) any { return &c.Server.GinMode }},
+	{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long in-flight streams may run after SIGTERM", func(c *Config) any { return &c.Server.ShutdownTimeout }},
+	{"TRUSTED_PROXIES", "trusted-proxies", "comma-separated proxy IPs and CIDR ranges whose X-Forwarded-For is trusted", func(c *Config) any { return &c.Server.TrustedProxies }},
+
+	{"LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", func(c *Config) any { return &c.Log.Level }},
+	{"LOG_FORMAT", "log-format", "log format: json or text", func(c *Config) any { return &c.Log.Format }},
+
+	{"FFMPEG_PATH", "ffmpeg-path", "FFmpeg binary", func(c *Config) any { return &c.FFmpeg.Path }},
+	{"FFMPEG_AUDIO_CODEC", "ffmpeg-audio-codec", "codec for MP3 conversion", func(c *Config) any { return &c.FFmpeg.AudioCodec }},
+	{"FFMPEG_AUDIO_QUALITY", "ffmpeg-audio-quality", "VBR quality for MP3 conversion (0 is best)", func(c *Config) any { return &c.FFmpeg.AudioQuality }},
+	{"FFMPEG_MUX_AUDIO_CODEC", "ffmpeg-mux-audio-codec", "audio codec of muxed MP4 videos", func(c *Config) any { return &c.FFmpeg.MuxAudioCodec }},
+	{"FFMPEG_TEMP_DIR", "ffmpeg-temp-dir", "directory for muxing FIFOs and temporary files", func(c *Config) any { return &c.FFmpeg.TempDir }},
+
+	{"CORS_ALLOWED_ORIGINS", "cors-allowed-origins", "comma-separated origins allowed to call the API, such as https://*.example.com, or *", func(c *Config) any { return &c.CORS.AllowedOrigins }},
+	{"CORS_ALLOW_CREDENTIALS", "cors-allow-credentials", "let allowed origins send cookies with their requests", func(c *Config) any { return &c.CORS.AllowCredentials }},
+	{"CORS_MAX_AGE", "cors-max-age", "how long browsers may cache preflight results", func(c *Config) any { return &c.CORS.MaxAge }},
+
+	{"RATE_LIMIT_API_PER_MINUTE", "rate-limit-api-per-minute", "API and UI requests per client and minute (0 disables)", func(c *Config) any { return &c.RateLimit.APIPerMinute }},
+	{"RATE_LIMIT_API_BURST", "rate-limit-api-burst", "API and UI requests a client may make at once", func(c *Config) any { return &c.RateLimit.APIBurst }},
+	{"RATE_LIMIT_STREAM_PER_MINUTE", "rate-limit-stream-per-minute", "listen and watch requests per client and minute (0 disables)", func(c *Config) any { return &c.RateLimit.StreamPerMinute }},
+	{"RATE_LIMIT_STREAM_BURST", "rate-limit-stream-burst", "listen and watch requests a client may make at once", func(c *Config) any { return &c.RateLimit.StreamBurst }},
+	{"RATE_LIMIT_ALLOWLIST", "rate-limit-allowlist", "comma-separated IPs, CIDR ranges and API key names that are never limited", func(c *Config) any { return &c.RateLimit.Allowlist }},
+
+	{"AUTH_KEYS_FILE", "auth-keys-file", "YAML file of API keys and their scopes (empty allows every request)", func(c *Config) any { return &c.Auth.KeysFile }},
+
+	{"YOUTUBE_BASE_URL", "youtube-base-url", "server that receives every youtube.com request", func(c *Config) any { return &c.YouTube.BaseURL }},
+	{"YOUTUBE_MUSIC_BASE_URL", "youtube-music-base-url", "server for YouTube Music API requests", func(c *Config) any { return &c.YouTube.MusicBaseURL }},
+	{"YOUTUBE_THUMBNAIL_BASE_URL", "youtube-thumbnail-base-url", "server thumbnails are fetched from", func(c *Config) any { return &c.YouTube.ThumbnailBaseURL }},
+	{"YOUTUBE_SUGGEST_BASE_URL", "youtube-suggest-base-url", "server search completions are fetched from", func(c *Config) any { return &c.YouTube.SuggestBaseURL }},
+	{"YOUTUBE_TIMEOUT", "youtube-timeout", "timeout for each API and metadata request", func(c *Config) any { return &c.YouTube.Timeout }},
+	{"YOUTUBE_USER_AGENT", "youtube-user-agent", "User-Agent for InnerTube API requests", func(c *Config) any { return &c.YouTube.UserAgent }},
+	{"YOUTUBE_CLIENT_VERSION", "youtube-client-version", "WEB InnerTube client version", func(c *Config) any { return &c.YouTube.ClientVersion }},
+	{"YOUTUBE_MUSIC_CLIENT_VERSION", "youtube-music-client-version", "WEB_REMIX InnerTube client version", func(c *Config) any { return &c.YouTube.MusicClientVersion }},
+	{"YOUTUBE_HL", "youtube-hl", "interface language", func(c *Config) any { return &c.YouTube.HL }},
+	{"YOUTUBE_GL", "youtube-gl", "content region", func(c *Config) any { return &c.YouTube.GL }},
+	{"YOUTUBE_SEARCH_CACHE_TTL", "youtube-search-cache-ttl", "how long search results are cached (0 disables)", func(c *Config) any { return &c.YouTube.SearchCacheTTL }},
+	{"YOUTUBE_PLAYLIST_CACHE_TTL", "youtube-playlist-cache-ttl", "how long playlists are cached (0 disables)", func(c *Config) any { return &c.YouTube.PlaylistCacheTTL }},
+	{"YOUTUBE_CACHE_STALE_TTL", "youtube-cache-stale-ttl", "how long an expired search or playlist is served while it refreshes", func(c *Config) any { return &c.YouTube.CacheStaleTTL }},
+	{"YOUTUBE_VIDEO_CACHE_SIZE", "youtube-video-cache-size", "maximum cached player responses", func(c *Config) any { return &c.YouTube.VideoCacheSize }},
+	{"YOUTUBE_RESPONSE_CACHE_SIZE", "youtube-response-cache-size", "maximum cached searches and playlists, each", func(c *Config) any { return &c.YouTube.ResponseCacheSize }},
+	{"YOUTUBE_RETRY_ATTEMPTS", "youtube-retry-attempts", "tries per player client for transient failures", func(c *Config) any { return &c.YouTube.RetryAttempts }},
+	{"YOUTUBE_RETRY_BACKOFF", "youtube-retry-backoff", "delay before the first retry", func(c *Config) any { return &c.YouTube.RetryBackoff }},
+	{"YOUTUBE_PLAYER_CLIENTS", "youtube-player-clients", "comma-separated InnerTube clients to fall back across", func(c *Config) any { return &c.YouTube.PlayerClients }},
+
+	{"THUMBNAIL_CACHE_DIR", "thumbnail-cache-dir", "directory of cached thumbnails", func(c *Config) any { return &c.Thumbnails.CacheDir }},
+	{"THUMBNAIL_PROXY_URL", "thumbnail-proxy-url", "base URL API and UI thumbnails point at, such as /api/thumb", func(c *Config) any { return &c.Thumbnails.ProxyURL }},
+
+	{"MUSIC_LIBRARY_DIR", "library-dir", "local music library directory", func(c *Config) any { return &c.Library.Dir }},
+
+	{"SUGGEST_PROVIDER", "suggest-provider", "autocomplete provider: youtube, or local for search history only", func(c *Config) any { return &c.Suggest.Provider }},
+}
+
+// setField parses value into the field pointer, which is one of the types
+// used in Config
+func setField(field any, value string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		*f = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("not true or false")
+		}
+		*f = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("not a duration such as 30s or 10m")
+		}
+		*f = d
+	case *[]string:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*f = values
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+func formatField(field any) string {
+	switch f := field.(type) {
+	case *string:
+		return *f
+	case *int:
+		return strconv.Itoa(*f)
+	case *bool:
+		return strconv.FormatBool(*f)
+	case *time.Duration:
+		return f.String()
+	case *[]string:
+		return strings.Join(*f, ",")
+	default:
+		return ""
+	}
+}
+
+// fieldValue adapts a configuration field to flag.Value
+type fieldValue struct {
+	field any
+}
+
+func (v fieldValue) String() string {
+	if v.field == nil {
+		return ""
+	}
+	return formatField(v.field)
+}
+
+func (v fieldValue) Set(value string) error {
+	return setField(v.field, value)
+}
+
+// IsBoolFlag lets boolean settings be given as a bare flag
+func (v fieldValue) IsBoolFlag() bool {
+	_, ok := v.field.(*bool)
+	return ok
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"musiq/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// validatorTTL is how long the first-seen time of a response body is
+	// remembered for its Last-Modified header
+	validatorTTL = 24 * time.Hour
+	// maxValidators bounds the remembered response bodies
+	maxValidators = 10000
+)
+
+// validators remembers when each distinct response body was first served,
+// so unchanged cached results keep a stable Last-Modified
+var validators = &validatorTimes{seen: make(map[string]time.Time)}
+
+type validatorTimes struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// firstSeen returns when a body with this ETag was first served
+func (v *validatorTimes) firstSeen(etag string) time.Time {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if seen, ok := v.seen[etag]; ok {
+		return seen
+	}
+
+	now := time.Now().Truncate(time.Second)
+	if len(v.seen) >= maxValidators {
+		for k, seen := range v.seen {
+			if now.Sub(seen) > validatorTTL {
+				delete(v.seen, k)
+			}
+		}
+		if len(v.seen) >= maxValidators {
+			v.seen = make(map[string]time.Time)
+		}
+	}
+	v.seen[etag] = now
+	return now
+}
+
+// conditionalJSON writes a 200 JSON response with ETag and Last-Modified
+// validators, or a 304 when the client's copy is still current
+func conditionalJSON(c *gin.Context, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to encode response",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	modified := validators.firstSeen(etag)
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+
+	if notModified(c.Request, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when no ETags
+// were sent
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !modified.After(since)
+	}
+
+	return false
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveConditional answers a request with headers with conditionalJSON
+func serveConditional(value any, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { conditionalJSON(c, value) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalJSON(t *testing.T) {
+	value := map[string]string{"test": t.Name()}
+	first := serveConditional(value, nil)
+	etag := first.Header().Get("ETag")
+	modified, err := http.ParseTime(first.Header().Get("Last-Modified"))
+	if first.Code != http.StatusOK || etag == "" || err != nil {
+		t.Fatalf("first response = %d, ETag %q, Last-Modified error %v", first.Code, etag, err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{name: "unconditional", status: http.StatusOK},
+		{name: "matching ETag", headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified},
+		{name: "weak ETag", headers: map[string]string{"If-None-Match": "W/" + etag}, status: http.StatusNotModified},
+		{name: "ETag in list", headers: map[string]string{"If-None-Match": `"other", ` + etag}, status: http.StatusNotModified},
+		{name: "any ETag", headers: map[string]string{"If-None-Match": "*"}, status: http.StatusNotModified},
+		{name: "changed ETag", headers: map[string]string{"If-None-Match": `"other"`}, status: http.StatusOK},
+		{name: "not modified since", headers: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, status: http.StatusNotModified},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, status: http.StatusOK},
+		{name: "malformed date", headers: map[string]string{"If-Modified-Since": "yesterday"}, status: http.StatusOK},
+		// If-Modified-Since is ignored when ETags were sent
+		{name: "changed ETag, not modified since", headers: map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+		}, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveConditional(value, tt.headers)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			// Last-Modified stays that of the first response with this body
+			if got := w.Header().Get("Last-Modified"); got != first.Header().Get("Last-Modified") {
+				t.Errorf("Last-Modified = %q, want %q", got, first.Header().Get("Last-Modified"))
+			}
+			if tt.status == http.StatusNotModified && w.Body.Len() > 0 {
+				t.Errorf("304 has a body: %s", w.Body)
+			}
+		})
+	}
+
+	if other := serveConditional(map[string]string{"test": "other"}, nil); other.Header().Get("ETag") == etag {
+		t.Error("a different body has the same ETag")
+	}
+}
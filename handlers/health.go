@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var healthService *services.Health
+
+// Healthz reports that the server is alive. It checks no dependencies, so
+// a slow upstream doesn't get the process restarted.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: models.HealthOK})
+}
+
+// Readyz reports whether the server can serve streams: FFmpeg and its
+// encoders, writable directories and a reachable upstream. It answers 503
+// with the failed checks when it can't.
+func Readyz(c *gin.Context) {
+	response, ready := healthService.Check(c.Request.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
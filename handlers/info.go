@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"musiq/logging"
 	"musiq/models"
-	"musiq/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,18 +19,17 @@ func Info(c *gin.Context) {
 		return
 	}
 
-	// Extract video ID from URL if necessary
-	videoID = services.ExtractVideoID(videoID)
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
 
-	info, err := youtubeService.GetVideoInfo(videoID)
+	info, err := mediaSources.Info(c.Request.Context(), videoID, locale)
 	if err != nil {
-		log.Printf("Failed to get video info for %s: %v", videoID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to get video info",
-			Message: err.Error(),
-		})
+		logging.FromContext(c.Request.Context()).Error("Failed to get video info", "videoId", videoID, "error", err)
+		respondSourceError(c, err, "Failed to get video info")
 		return
 	}
 
-	c.JSON(http.StatusOK, info)
+	conditionalJSON(c, info)
 }
@@ -1,16 +1,19 @@
 package handlers
 
 import (
-	"log"
+	"io"
 	"net/http"
+	"strconv"
 
+	"musiq/logging"
+	"musiq/metrics"
 	"musiq/models"
 	"musiq/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-var ffmpegService = services.NewFFmpegService()
+var ffmpegService *services.FFmpegService
 
 // Listen handles MP3 audio streaming
 func Listen(c *gin.Context) {
@@ -24,21 +27,22 @@ func Listen(c *gin.Context) {
 		return
 	}
 
-	// Extract video ID from URL if necessary
-	videoID = services.ExtractVideoID(videoID)
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	logging.Annotate(ctx, "videoId", videoID)
 
-	// Get audio stream from YouTube
-	audioStream, _, err := youtubeService.GetAudioStream(videoID)
+	// Get audio stream from the video's source
+	audioStream, err := mediaSources.AudioStream(ctx, videoID)
 	if err != nil {
-		log.Printf("Failed to get audio stream for %s: %v", videoID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to get audio stream",
-			Message: err.Error(),
-		})
+		logger.Error("Failed to get audio stream", "videoId", videoID, "error", err)
+		respondSourceError(c, err, "Failed to get audio stream")
 		return
 	}
 	defer audioStream.Close()
 
+	out, done := metrics.StartStream("listen", c.Writer)
+	defer done()
+
 	// Set response headers
 	c.Header("Content-Type", "audio/mpeg")
 	c.Header("Cache-Control", "public, max-age=3600")
@@ -50,9 +54,22 @@ func Listen(c *gin.Context) {
 		c.Header("Content-Disposition", "inline; filename=\""+filename+"\"")
 	}
 
+	// Local MP3 files need no conversion
+	if audioStream.MimeType == "audio/mpeg" {
+		logging.Annotate(ctx, "format", "mp3", "transcoded", false)
+		if audioStream.Size > 0 {
+			c.Header("Content-Length", strconv.FormatInt(audioStream.Size, 10))
+		}
+		if _, err := io.Copy(out, audioStream); err != nil {
+			logger.Warn("Streaming failed", "videoId", videoID, "error", err)
+		}
+		return
+	}
+
 	// Convert to MP3 and stream to response
-	if err := ffmpegService.ConvertToMP3(audioStream, c.Writer); err != nil {
-		log.Printf("MP3 conversion error for %s: %v", videoID, err)
+	logging.Annotate(ctx, "format", "mp3", "transcoded", true)
+	if err := ffmpegService.ConvertToMP3(ctx, audioStream, out); err != nil {
+		logger.Warn("MP3 conversion failed", "videoId", videoID, "error", err)
 		// Only send error if headers haven't been sent
 		if !c.Writer.Written() {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLocale reads the locale from the hl and gl query parameters,
+// falling back to Accept-Language. It writes a 400 response and returns
+// false when hl or gl is malformed.
+func requestLocale(c *gin.Context) (services.Locale, bool) {
+	locale, err := services.ParseLocale(c.Query("hl"), c.Query("gl"), c.GetHeader("Accept-Language"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid locale",
+			Message: err.Error(),
+		})
+		return services.Locale{}, false
+	}
+
+	// Responses depend on the header when no explicit locale is given
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	return locale, true
+}
+
+// localizedService returns the YouTube service for the request's locale
+func localizedService(c *gin.Context) (*services.YouTubeService, bool) {
+	locale, ok := requestLocale(c)
+	if !ok {
+		return nil, false
+	}
+	return youtubeService.ForLocale(locale), true
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"musiq/logging"
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MusicSearch handles YouTube Music search requests
+func MusicSearch(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Missing search query",
+		})
+		return
+	}
+
+	filter := c.Query("type")
+	if filter != "" && !services.IsMusicSearchFilter(filter) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid search type",
+			Message: "type must be one of songs, albums, artists, playlists",
+		})
+		return
+	}
+
+	yt, ok := localizedService(c)
+	if !ok {
+		return
+	}
+
+	results, err := yt.SearchMusic(c.Request.Context(), query, filter)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("Music search failed", "error", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Search failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	conditionalJSON(c, results)
+}
@@ -1,9 +1,10 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
+	"strconv"
 
+	"musiq/logging"
 	"musiq/models"
 
 	"github.com/gin-gonic/gin"
@@ -19,9 +20,14 @@ func PlaylistSearch(c *gin.Context) {
 		return
 	}
 
-	playlists, err := youtubeService.SearchPlaylists(query)
+	yt, ok := localizedService(c)
+	if !ok {
+		return
+	}
+
+	playlists, err := yt.SearchPlaylists(c.Request.Context(), query)
 	if err != nil {
-		log.Printf("Playlist search error: %v", err)
+		logging.FromContext(c.Request.Context()).Error("Playlist search failed", "error", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Search failed",
 			Message: err.Error(),
@@ -29,7 +35,7 @@ func PlaylistSearch(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, playlists)
+	conditionalJSON(c, playlists)
 }
 
 // GetPlaylist handles get playlist videos request
@@ -42,22 +48,40 @@ func GetPlaylist(c *gin.Context) {
 		return
 	}
 
-	videos, err := youtubeService.GetPlaylistVideos(playlistID)
-	if err != nil {
-		log.Printf("Failed to get playlist %s: %v", playlistID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to get playlist",
-			Message: err.Error(),
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid offset",
 		})
 		return
 	}
 
-	if len(videos) == 0 {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid limit",
+		})
+		return
+	}
+
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
+
+	playlist, err := mediaSources.Playlist(c.Request.Context(), playlistID, offset, limit, locale)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("Failed to get playlist", "playlistId", playlistID, "error", err)
+		respondSourceError(c, err, "Failed to get playlist")
+		return
+	}
+
+	if playlist.VideoCount == 0 {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "No items found",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, videos)
+	conditionalJSON(c, playlist)
 }
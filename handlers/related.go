@@ -1,11 +1,10 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"musiq/logging"
 	"musiq/models"
-	"musiq/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,24 +19,23 @@ func GetVideo(c *gin.Context) {
 		return
 	}
 
-	// Extract video ID from URL if necessary
-	videoID = services.ExtractVideoID(videoID)
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
 
 	// Get video info first to use title for related search
-	info, err := youtubeService.GetVideoInfo(videoID)
+	info, err := mediaSources.Info(c.Request.Context(), videoID, locale)
 	if err != nil {
-		log.Printf("Failed to get video info for %s: %v", videoID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Something went wrong",
-			Message: err.Error(),
-		})
+		logging.FromContext(c.Request.Context()).Error("Failed to get video info", "videoId", videoID, "error", err)
+		respondSourceError(c, err, "Something went wrong")
 		return
 	}
 
 	// Search for related videos using the video title
-	relatedVideos, err := youtubeService.SearchVideos(info.Title)
+	relatedVideos, err := mediaSources.Search(c.Request.Context(), info.Title, locale)
 	if err != nil {
-		log.Printf("Failed to get related videos for %s: %v", videoID, err)
+		logging.FromContext(c.Request.Context()).Error("Failed to get related videos", "videoId", videoID, "error", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Something went wrong",
 			Message: err.Error(),
@@ -48,12 +46,12 @@ func GetVideo(c *gin.Context) {
 	// Filter out the original video from results
 	filteredResults := make([]models.VideoResult, 0, len(relatedVideos))
 	for _, v := range relatedVideos {
-		if v.ID != videoID {
+		if v.ID != info.ID {
 			filteredResults = append(filteredResults, v)
 		}
 	}
 
-	c.JSON(http.StatusOK, filteredResults)
+	conditionalJSON(c, filteredResults)
 }
 
 // Related handles video details + related videos request
@@ -66,37 +64,36 @@ func Related(c *gin.Context) {
 		return
 	}
 
-	// Extract video ID from URL if necessary
-	videoID = services.ExtractVideoID(videoID)
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
 
 	// Get video info
-	info, err := youtubeService.GetVideoInfo(videoID)
+	info, err := mediaSources.Info(c.Request.Context(), videoID, locale)
 	if err != nil {
-		log.Printf("Failed to get video info for %s: %v", videoID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Something went wrong",
-			Message: err.Error(),
-		})
+		logging.FromContext(c.Request.Context()).Error("Failed to get video info", "videoId", videoID, "error", err)
+		respondSourceError(c, err, "Something went wrong")
 		return
 	}
 
 	// Search for related videos using the video title
-	relatedVideos, err := youtubeService.SearchVideos(info.Title)
+	relatedVideos, err := mediaSources.Search(c.Request.Context(), info.Title, locale)
 	if err != nil {
-		log.Printf("Failed to get related videos for %s: %v", videoID, err)
+		logging.FromContext(c.Request.Context()).Error("Failed to get related videos", "videoId", videoID, "error", err)
 		// Return video details even if related fails
 		response := models.RelatedResponse{
 			VideoDetails: *info,
 			RelatedSongs: []models.VideoResult{},
 		}
-		c.JSON(http.StatusOK, response)
+		conditionalJSON(c, response)
 		return
 	}
 
 	// Filter out the original video
 	filteredResults := make([]models.VideoResult, 0, len(relatedVideos))
 	for _, v := range relatedVideos {
-		if v.ID != videoID {
+		if v.ID != info.ID {
 			filteredResults = append(filteredResults, v)
 		}
 	}
@@ -106,5 +103,5 @@ func Related(c *gin.Context) {
 		RelatedSongs: filteredResults,
 	}
 
-	c.JSON(http.StatusOK, response)
+	conditionalJSON(c, response)
 }
@@ -4,24 +4,56 @@ import (
 	"net/http"
 
 	"musiq/models"
+	"musiq/openapi"
+	"musiq/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Root handles the root endpoint
+// Configure sets the services the API handlers use
+func Configure(s *services.Services) {
+	youtubeService = s.YouTube
+	ffmpegService = s.FFmpeg
+	suggestService = s.Suggest
+	searchHistory = s.History
+	mediaSources = s.Sources
+	thumbnailService = s.Thumbnails
+	healthService = s.Health
+	apiKeys = s.APIKeys
+}
+
+// Root describes the API and lists its routes
 func Root(c *gin.Context) {
 	response := models.RootResponse{
-		Status: http.StatusOK,
-		Routes: models.Routes{
-			SearchRoute:       "/api/search/:q",
-			ListenRoute:       "/api/listen/:id/:name",
-			WatchRoute:        "/api/watch/:id/:name",
-			InfoRoute:         "/api/info/:id",
-			RelatedRoute:      "/api/getvideo/:id",
-			PlaylistRoute:     "/api/playlist/search/:q",
-			PlaylistRouteByID: "/api/getplaylist/:id",
-		},
+		Status:  http.StatusOK,
+		Version: APIVersion,
+		OpenAPI: OpenAPIPath,
+		Docs:    DocsPath,
+	}
+	for _, route := range APIRoutes() {
+		response.Routes = append(response.Routes, models.Route{
+			Method:  route.Method,
+			Path:    openapi.Path(APIBasePath + route.Path),
+			Summary: route.Summary,
+		})
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// LegacyRoot lists the routes of the unversioned API in the shape it had
+// before the API was versioned
+func LegacyRoot(c *gin.Context) {
+	c.JSON(http.StatusOK, models.LegacyRootResponse{
+		Status: http.StatusOK,
+		Routes: models.Routes{
+			SearchRoute:       LegacyAPIBasePath + "/search/:q",
+			ListenRoute:       LegacyAPIBasePath + "/listen/:id/:name",
+			WatchRoute:        LegacyAPIBasePath + "/watch/:id/:name",
+			InfoRoute:         LegacyAPIBasePath + "/info/:id",
+			RelatedRoute:      LegacyAPIBasePath + "/getvideo/:id",
+			PlaylistRoute:     LegacyAPIBasePath + "/playlist/search/:q",
+			PlaylistRouteByID: LegacyAPIBasePath + "/getplaylist/:id",
+		},
+	})
+}
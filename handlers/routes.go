@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"musiq/middleware"
+	"musiq/models"
+	"musiq/openapi"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersion is the version of the API served under APIBasePath
+const APIVersion = "v1"
+
+// Paths of the versioned API, of the unversioned one kept for existing
+// clients, and of the API description
+const (
+	APIBasePath       = "/api/" + APIVersion
+	LegacyAPIBasePath = "/api"
+	OpenAPIPath       = "/api/openapi.json"
+	DocsPath          = "/api/docs"
+)
+
+// Route is an API route with its handler. Its Scope also decides the rate
+// limit budget: routes with the stream scope spend from the stream budget.
+type Route struct {
+	openapi.Operation
+	Handler gin.HandlerFunc
+	// LegacyHandler serves the route under LegacyAPIBasePath instead,
+	// where its response kept an older shape
+	LegacyHandler gin.HandlerFunc
+}
+
+// localeParams are the parameters of routes that localize their results
+var localeParams = []openapi.Param{
+	{Name: "hl", In: "query", Description: "Language, such as de or pt-BR; defaults to the Accept-Language header"},
+	{Name: "gl", In: "query", Description: "Region, such as AT; defaults to the Accept-Language header"},
+}
+
+var idParam = openapi.Param{
+	Name:        "id",
+	In:          "path",
+	Description: "YouTube video ID or URL, URL-encoded, or a library track ID",
+}
+
+var downloadParam = openapi.Param{
+	Name:        "download",
+	In:          "query",
+	Description: "true to send the file as an attachment, which needs the download scope instead of stream",
+	Type:        "boolean",
+}
+
+// APIRoutes returns the routes of the API, relative to its base path, in
+// the order they are documented
+func APIRoutes() []Route {
+	return []Route{
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "",
+				Summary:  "Describe the API and list its routes",
+				Tag:      "meta",
+				Response: models.RootResponse{},
+			},
+			Handler:       Root,
+			LegacyHandler: LegacyRoot,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/search/:q",
+				Summary: "Search videos",
+				Tag:     "search",
+				Params: append([]openapi.Param{
+					{Name: "q", In: "path", Description: "Search query"},
+					{Name: "submit", In: "query", Description: "1 when the user submitted the query, which keeps it in the history suggestions complete from", Enum: []string{"1"}},
+				}, localeParams...),
+				Response: []models.VideoResult{},
+				Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: Search,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/suggest",
+				Summary:  "Complete a search query",
+				Tag:      "search",
+				Params:   append([]openapi.Param{{Name: "q", In: "query", Description: "Query to complete", Required: true}}, localeParams...),
+				Response: models.SuggestResponse{},
+				Errors:   []int{http.StatusBadRequest, http.StatusBadGateway},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: Suggest,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/music/search",
+				Summary: "Search YouTube Music",
+				Tag:     "search",
+				Params: append([]openapi.Param{
+					{Name: "q", In: "query", Description: "Search query", Required: true},
+					{Name: "type", In: "query", Description: "Only return results of this type", Enum: []string{"songs", "albums", "artists", "playlists"}},
+				}, localeParams...),
+				Response: models.MusicSearchResponse{},
+				Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: MusicSearch,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/info/:id",
+				Summary:  "Get video metadata and formats",
+				Tag:      "videos",
+				Params:   append([]openapi.Param{idParam}, localeParams...),
+				Response: models.VideoInfo{},
+				Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: Info,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/thumb/:id",
+				Summary: "Get a resized thumbnail",
+				Tag:     "videos",
+				Params: []openapi.Param{
+					{Name: "id", In: "path", Description: "YouTube video ID"},
+					{Name: "w", In: "query", Description: "Width in pixels, up to " + strconv.Itoa(services.MaxThumbnailWidth) + "; the original size when unset", Type: "integer"},
+					{Name: "fmt", In: "query", Description: "Image format", Enum: []string{"jpeg", "png", "webp"}},
+					{Name: "crop", In: "query", Description: "square crops the thumbnail to a centered square, for album art", Enum: []string{"square"}},
+				},
+				MediaTypes: []string{"image/jpeg", "image/png", "image/webp"},
+				Errors:     []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError, http.StatusServiceUnavailable},
+				Scope:      services.ScopeSearch,
+			},
+			Handler: Thumbnail,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/getvideo/:id",
+				Summary:  "Get videos related to a video",
+				Tag:      "videos",
+				Params:   append([]openapi.Param{idParam}, localeParams...),
+				Response: []models.VideoResult{},
+				Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: GetVideo,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/related/:id",
+				Summary:  "Get video metadata with related videos",
+				Tag:      "videos",
+				Params:   append([]openapi.Param{idParam}, localeParams...),
+				Response: models.RelatedResponse{},
+				Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: Related,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/playlist/search/:q",
+				Summary:  "Search playlists",
+				Tag:      "playlists",
+				Params:   append([]openapi.Param{{Name: "q", In: "path", Description: "Search query"}}, localeParams...),
+				Response: []models.PlaylistResult{},
+				Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: PlaylistSearch,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/getplaylist/:id",
+				Summary: "Get playlist metadata and a page of its videos",
+				Tag:     "playlists",
+				Params: append([]openapi.Param{
+					{Name: "id", In: "path", Description: "Playlist ID, or a library album ID"},
+					{Name: "offset", In: "query", Description: "Index of the first video", Type: "integer"},
+					{Name: "limit", In: "query", Description: "Videos per page, up to " + strconv.Itoa(services.MaxPlaylistLimit) + "; " + strconv.Itoa(services.DefaultPlaylistLimit) + " when unset", Type: "integer"},
+				}, localeParams...),
+				Response: models.Playlist{},
+				Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+				Scope:    services.ScopeSearch,
+			},
+			Handler: GetPlaylist,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/listen/:id/:name",
+				Summary: "Stream audio as MP3",
+				Tag:     "streams",
+				Params: []openapi.Param{
+					idParam,
+					{Name: "name", In: "path", Description: "File name of downloads, such as song.mp3"},
+					downloadParam,
+				},
+				MediaTypes: []string{"audio/mpeg"},
+				Errors:     []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+				Scope:      services.ScopeStream,
+			},
+			Handler: Listen,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:  http.MethodGet,
+				Path:    "/watch/:id/:name",
+				Summary: "Stream video as MP4",
+				Tag:     "streams",
+				Params: []openapi.Param{
+					{Name: "id", In: "path", Description: "YouTube video ID or URL, URL-encoded"},
+					{Name: "name", In: "path", Description: "File name of downloads, such as video.mp4"},
+					downloadParam,
+				},
+				MediaTypes: []string{"video/mp4"},
+				Errors:     []int{http.StatusBadRequest, http.StatusInternalServerError},
+				Scope:      services.ScopeStream,
+			},
+			Handler: Watch,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/stats",
+				Summary:  "Get cache entry counts and hit rates",
+				Tag:      "admin",
+				Response: models.StatsResponse{},
+				Errors:   []int{http.StatusForbidden},
+				Scope:    services.ScopeAdmin,
+			},
+			Handler: Stats,
+		},
+		{
+			Operation: openapi.Operation{
+				Method:   http.MethodGet,
+				Path:     "/admin/keys",
+				Summary:  "Get the requests and bytes served per API key",
+				Tag:      "admin",
+				Response: models.APIKeysResponse{},
+				Errors:   []int{http.StatusForbidden},
+				Scope:    services.ScopeAdmin,
+			},
+			Handler: APIKeys,
+		},
+	}
+}
+
+// openAPIDocument is built on first use, once Configure has told whether
+// API keys are required
+var openAPIDocument = sync.OnceValue(func() *openapi.Document {
+	routes := APIRoutes()
+	ops := make([]openapi.Operation, len(routes))
+	for i, route := range routes {
+		ops[i] = route.Operation
+	}
+
+	var security *openapi.Security
+	if apiKeys != nil {
+		security = &openapi.Security{Header: middleware.APIKeyHeader, QueryParam: middleware.APIKeyQueryParam}
+	}
+	info := openapi.Info{
+		Title:       "Musiq API",
+		Description: "Search YouTube and YouTube Music, and stream audio and video from them and the local library.",
+		Version:     APIVersion,
+	}
+	return openapi.Build(info, APIBasePath, ops, models.ErrorResponse{}, security)
+})
+
+// OpenAPI serves the OpenAPI document of the API
+func OpenAPI(c *gin.Context) {
+	conditionalJSON(c, openAPIDocument())
+}
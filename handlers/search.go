@@ -1,16 +1,17 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"musiq/logging"
 	"musiq/models"
 	"musiq/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-var youtubeService = services.NewYouTubeService()
+var youtubeService *services.YouTubeService
+var searchHistory *services.HistorySuggestProvider
 
 // Search handles video search requests
 func Search(c *gin.Context) {
@@ -22,9 +23,20 @@ func Search(c *gin.Context) {
 		return
 	}
 
-	videos, err := youtubeService.SearchVideos(query)
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
+
+	// Like the web UI, clients mark searches the user submitted, so
+	// searches run while typing don't fill the history
+	if c.Query("submit") == "1" {
+		searchHistory.Record(query)
+	}
+
+	videos, err := mediaSources.Search(c.Request.Context(), query, locale)
 	if err != nil {
-		log.Printf("Search error: %v", err)
+		logging.FromContext(c.Request.Context()).Error("Search failed", "error", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Search failed",
 			Message: err.Error(),
@@ -32,5 +44,5 @@ func Search(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, videos)
+	conditionalJSON(c, videos)
 }
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var mediaSources *services.Sources
+
+// respondSourceError answers a media source error: 400 for malformed IDs,
+// 404 for unknown library tracks and albums, otherwise 500 with the given error title
+func respondSourceError(c *gin.Context, err error, title string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidVideoRef), errors.Is(err, services.ErrUnknownSource):
+		status = http.StatusBadRequest
+		title = "Invalid ID"
+	case errors.Is(err, services.ErrTrackNotFound):
+		status = http.StatusNotFound
+		title = "Not found"
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Error:   title,
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var apiKeys *services.APIKeyStore
+
+// Stats reports cache effectiveness counters
+func Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, youtubeService.CacheStats())
+}
+
+// APIKeys reports the requests and bytes served for each API key
+func APIKeys(c *gin.Context) {
+	if apiKeys == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "API keys not configured",
+			Message: "Set AUTH_KEYS_FILE to require API keys",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, apiKeys.Usage())
+}
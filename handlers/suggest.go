@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"musiq/logging"
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var suggestService *services.SuggestService
+
+// Suggest handles search autocomplete requests
+func Suggest(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Missing search query",
+		})
+		return
+	}
+
+	locale, ok := requestLocale(c)
+	if !ok {
+		return
+	}
+
+	suggestions, err := suggestService.Suggest(c.Request.Context(), query, locale)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("Suggest failed", "error", err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Suggestions unavailable",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Completions change slowly, let browsers reuse them between keystrokes
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, models.SuggestResponse{
+		Query:       query,
+		Suggestions: suggestions,
+	})
+}
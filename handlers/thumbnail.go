@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"musiq/logging"
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var thumbnailService *services.ThumbnailService
+
+// Thumbnail serves a resized, re-encoded copy of a video's thumbnail so
+// clients never contact i.ytimg.com
+func Thumbnail(c *gin.Context) {
+	if thumbnailService == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "Thumbnail proxy unavailable",
+		})
+		return
+	}
+
+	width, err := strconv.Atoi(c.DefaultQuery("w", "0"))
+	if err != nil || width < 0 || width > services.MaxThumbnailWidth {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid width",
+			Message: "w must be a pixel width up to " + strconv.Itoa(services.MaxThumbnailWidth),
+		})
+		return
+	}
+
+	format := c.DefaultQuery("fmt", "jpeg")
+	if !services.IsThumbnailFormat(format) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid format",
+			Message: "fmt must be one of jpeg, png, webp",
+		})
+		return
+	}
+
+	crop := c.Query("crop")
+	if crop != "" && crop != "square" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid crop",
+			Message: "crop must be square or omitted",
+		})
+		return
+	}
+
+	thumbnail, err := thumbnailService.Get(c.Request.Context(), c.Param("id"), services.ThumbnailOptions{
+		Width:  width,
+		Square: crop == "square",
+		Format: format,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidVideoRef):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Invalid video ID",
+				Message: err.Error(),
+			})
+		case errors.Is(err, services.ErrThumbnailNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "Thumbnail not found",
+			})
+		default:
+			logging.FromContext(c.Request.Context()).Error("Failed to get thumbnail", "videoId", c.Param("id"), "error", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to get thumbnail",
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, thumbnail.ContentType, thumbnail.Data)
+}
@@ -3,9 +3,10 @@ package handlers
 import (
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 
+	"musiq/logging"
+	"musiq/metrics"
 	"musiq/models"
 	"musiq/services"
 
@@ -37,14 +38,37 @@ func Watch(c *gin.Context) {
 		return
 	}
 
-	// Extract video ID from URL if necessary
-	videoID = services.ExtractVideoID(videoID)
+	// Only YouTube has video; local library tracks are audio
+	if !mediaSources.IsPrimary(videoID) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Video not available",
+			Message: "only YouTube videos can be watched, use /api/listen for library tracks",
+		})
+		return
+	}
+
+	// Accept any YouTube URL form as well as a bare ID
+	videoID, err := services.ParseVideoID(videoID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid video ID",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	logging.Annotate(ctx, "videoId", videoID, "format", "mp4")
 
 	// Try to get a combined video+audio stream first (instant playback)
-	stream, mimeType, size, err := youtubeService.GetCombinedStream(videoID)
+	stream, mimeType, size, err := youtubeService.GetCombinedStream(ctx, videoID)
 	if err == nil {
 		defer stream.Close()
-		log.Printf("Using combined stream for %s (size: %d, type: %s)", videoID, size, mimeType)
+		out, done := metrics.StartStream("watch", c.Writer)
+		defer done()
+		logging.Annotate(ctx, "muxed", false, "sourceMimeType", mimeType)
+		logger.Debug("Using combined stream", "videoId", videoID, "size", size, "mimeType", mimeType)
 
 		// Set headers for direct streaming
 		c.Header("Content-Type", "video/mp4")
@@ -62,18 +86,19 @@ func Watch(c *gin.Context) {
 
 		// Stream directly to client
 		c.Writer.WriteHeader(http.StatusOK)
-		if _, err := io.Copy(c.Writer, stream); err != nil {
-			log.Printf("Stream copy error for %s: %v", videoID, err)
+		if _, err := io.Copy(out, stream); err != nil {
+			logger.Warn("Streaming failed", "videoId", videoID, "error", err)
 		}
 		return
 	}
 
 	// Fallback to muxing separate streams if no combined format available
-	log.Printf("No combined stream for %s, falling back to mux: %v", videoID, err)
+	logger.Info("No combined stream, falling back to mux", "videoId", videoID, "error", err)
+	logging.Annotate(ctx, "muxed", true)
 
-	videoStream, audioStream, _, err := youtubeService.GetVideoAndAudioStreams(videoID)
+	videoStream, audioStream, _, err := youtubeService.GetVideoAndAudioStreams(ctx, videoID)
 	if err != nil {
-		log.Printf("Failed to get video streams for %s: %v", videoID, err)
+		logger.Error("Failed to get video streams", "videoId", videoID, "error", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Failed to get video streams",
 			Message: err.Error(),
@@ -83,6 +108,9 @@ func Watch(c *gin.Context) {
 	defer videoStream.Close()
 	defer audioStream.Close()
 
+	out, done := metrics.StartStream("watch", c.Writer)
+	defer done()
+
 	// Set response headers for streaming
 	c.Header("Content-Type", "video/mp4")
 	c.Header("Transfer-Encoding", "chunked")
@@ -93,13 +121,13 @@ func Watch(c *gin.Context) {
 
 	// Create a flushing writer to ensure data is sent immediately
 	fw := &flushWriter{
-		w:       c.Writer,
+		w:       out,
 		flusher: c.Writer,
 	}
 
 	// Use pipe-based mux
-	if err := ffmpegService.MuxVideoAudio(videoStream, audioStream, fw); err != nil {
-		log.Printf("Video streaming error for %s: %v", videoID, err)
+	if err := ffmpegService.MuxVideoAudio(ctx, videoStream, audioStream, fw); err != nil {
+		logger.Warn("Video streaming failed", "videoId", videoID, "error", err)
 		return
 	}
 }
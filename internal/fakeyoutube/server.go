@@ -0,0 +1,370 @@
+// Package fakeyoutube is a local stand-in for the YouTube endpoints musiq
+// talks to. It serves the recorded InnerTube fixtures, generates player
+// responses for any video ID, serves media bytes the way googlevideo.com
+// does and completes queries like suggestqueries.google.com, so the service
+// can run end to end without network access.
+//
+// A few video ID prefixes simulate upstream failures:
+//
+//	LOGIN...  age-restricted: LOGIN_REQUIRED unless requested by the TV
+//	          embedded client
+//	FLAKY...  every other player request fails with 503
+//	EXPIR...  the first player response has stream URLs that already
+//	          expired, which videoplayback refuses with 403
+//	DROPS...  the first two stream requests drop the connection halfway
+//	          through the body
+package fakeyoutube
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMediaSize is the length of the synthetic stream served when no
+// media file is configured
+const defaultMediaSize = 256 * 1024
+
+// Server serves the fake YouTube endpoints
+type Server struct {
+	// FixtureDir holds the InnerTube response fixtures
+	FixtureDir string
+	// MediaFile, when set, is served for every stream instead of
+	// synthetic bytes, so ffmpeg has real audio to convert
+	MediaFile string
+	// Verbose logs every request
+	Verbose bool
+
+	mux *http.ServeMux
+
+	mu             sync.Mutex
+	playerFetches  map[string]int
+	streamRequests map[string]int
+}
+
+// New creates a server reading fixtures from fixtureDir
+func New(fixtureDir string) *Server {
+	s := &Server{
+		FixtureDir:     fixtureDir,
+		playerFetches:  make(map[string]int),
+		streamRequests: make(map[string]int),
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /{$}", s.home)
+	s.mux.HandleFunc("GET /generate_204", s.generate204)
+	s.mux.HandleFunc("GET /embed/{id}", s.embed)
+	s.mux.HandleFunc("GET /s/player/", s.playerScript)
+	s.mux.HandleFunc("POST /youtubei/v1/player", s.player)
+	s.mux.HandleFunc("POST /youtubei/v1/search", s.search)
+	s.mux.HandleFunc("POST /youtubei/v1/next", s.fixture("next_mix.json"))
+	s.mux.HandleFunc("POST /youtubei/v1/browse", s.fixture("browse_playlist.json"))
+	s.mux.HandleFunc("GET /videoplayback", s.videoplayback)
+	s.mux.HandleFunc("GET /vi/{id}/{name}", s.thumbnail)
+	s.mux.HandleFunc("GET /complete/search", s.suggest)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Verbose {
+		log.Printf("fakeyoutube: %s %s", r.Method, r.URL.Path)
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// home serves the page the player library scrapes for a visitor ID
+func (s *Server) home(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html><script>\nytcfg.set({\"INNERTUBE_CONTEXT\":{\"client\":{\"visitorData\":\"CgtGYWtlVmlzaXRvcg%3D%3D\"}}});</script></html>")
+}
+
+// generate204 answers connectivity checks
+func (s *Server) generate204(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// embed serves the embed page, which names the player script
+func (s *Server) embed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, `<html><script src="/s/player/fake0000/player_ias.vflset/en_US/base.js"></script></html>`)
+}
+
+// playerScript serves an empty player script. Stream URLs carry no
+// signature, so nothing in it is ever evaluated.
+func (s *Server) playerScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript")
+	fmt.Fprint(w, "var _yt_player = {};")
+}
+
+// search answers WEB and WEB_REMIX searches with their fixtures
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var payload innertubePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := "search_web.json"
+	if payload.Context.Client.ClientName == "WEB_REMIX" {
+		name = "search_music.json"
+	}
+	s.serveFixture(w, name)
+}
+
+// suggest completes the query with a few fixed suffixes, in the shape the
+// firefox client of the suggest API returns
+func (s *Server) suggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	completions := []string{query + " music", query + " mix", query + " live"}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode([]any{query, completions})
+}
+
+// player generates a playable response for any video ID, with one muxed,
+// one video-only and two audio-only formats pointing back at this server
+func (s *Server) player(w http.ResponseWriter, r *http.Request) {
+	var payload innertubePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.VideoID == "" {
+		http.Error(w, "missing videoId", http.StatusBadRequest)
+		return
+	}
+
+	size, err := s.mediaSize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id := payload.VideoID
+
+	s.mu.Lock()
+	s.playerFetches[id]++
+	fetches := s.playerFetches[id]
+	s.mu.Unlock()
+
+	if strings.HasPrefix(id, "FLAKY") && fetches%2 == 1 {
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	if strings.HasPrefix(id, "LOGIN") && payload.Context.Client.ClientName != "TVHTML5_SIMPLY_EMBEDDED_PLAYER" {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"playabilityStatus":{"status":"LOGIN_REQUIRED","reason":"Sign in to confirm your age"}}`)
+		return
+	}
+
+	// Like real stream URLs, these are signed for six hours
+	expire := time.Now().Add(6 * time.Hour).Unix()
+	if strings.HasPrefix(id, "EXPIR") && fetches == 1 {
+		expire = time.Now().Add(-time.Minute).Unix()
+	}
+	streamURL := func(itag int) string {
+		return fmt.Sprintf("http://%s/videoplayback?id=%s&itag=%d&expire=%d", r.Host, id, itag, expire)
+	}
+	length := strconv.FormatInt(size, 10)
+
+	response := map[string]interface{}{
+		"playabilityStatus": map[string]interface{}{
+			"status":          "OK",
+			"playableInEmbed": true,
+		},
+		"videoDetails": map[string]interface{}{
+			"videoId":          id,
+			"title":            "Fake Artist - Fake Track " + id + " (Official Audio)",
+			"author":           "Fake Artist - Topic",
+			"channelId":        "UCfakeyoutube000000000000",
+			"lengthSeconds":    "213",
+			"viewCount":        "123456",
+			"shortDescription": "Served by fakeyoutube",
+			"thumbnail": map[string]interface{}{
+				"thumbnails": []map[string]interface{}{
+					{"url": fmt.Sprintf("http://%s/vi/%s/hqdefault.jpg", r.Host, id), "width": 480, "height": 360},
+				},
+			},
+		},
+		"microformat": map[string]interface{}{
+			"playerMicroformatRenderer": map[string]interface{}{
+				"publishDate": "2020-01-01",
+			},
+		},
+		"streamingData": map[string]interface{}{
+			"formats": []map[string]interface{}{
+				{"itag": 18, "url": streamURL(18), "mimeType": `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, "bitrate": 500000, "width": 640, "height": 360, "quality": "medium", "qualityLabel": "360p", "audioQuality": "AUDIO_QUALITY_LOW", "audioChannels": 2, "audioSampleRate": "44100", "contentLength": length},
+			},
+			"adaptiveFormats": []map[string]interface{}{
+				{"itag": 137, "url": streamURL(137), "mimeType": `video/mp4; codecs="avc1.640028"`, "bitrate": 4000000, "width": 1920, "height": 1080, "quality": "hd1080", "qualityLabel": "1080p", "contentLength": length},
+				{"itag": 140, "url": streamURL(140), "mimeType": `audio/mp4; codecs="mp4a.40.2"`, "bitrate": 130000, "audioQuality": "AUDIO_QUALITY_MEDIUM", "audioChannels": 2, "audioSampleRate": "44100", "contentLength": length},
+				{"itag": 251, "url": streamURL(251), "mimeType": `audio/webm; codecs="opus"`, "bitrate": 140000, "audioQuality": "AUDIO_QUALITY_MEDIUM", "audioChannels": 2, "audioSampleRate": "48000", "contentLength": length},
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// thumbnailSizes are the dimensions of the i.ytimg.com thumbnail variants.
+// The 4:3 variants are letterboxed like the real ones.
+var thumbnailSizes = map[string]image.Rectangle{
+	"default.jpg":       image.Rect(0, 0, 120, 90),
+	"mqdefault.jpg":     image.Rect(0, 0, 320, 180),
+	"hqdefault.jpg":     image.Rect(0, 0, 480, 360),
+	"sddefault.jpg":     image.Rect(0, 0, 640, 480),
+	"maxresdefault.jpg": image.Rect(0, 0, 1280, 720),
+}
+
+// thumbnail serves a generated JPEG in the size of the requested variant
+func (s *Server) thumbnail(w http.ResponseWriter, r *http.Request) {
+	bounds, ok := thumbnailSizes[r.PathValue("name")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	img := image.NewRGBA(bounds)
+	barHeight := (bounds.Dy() - bounds.Dx()*9/16) / 2
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.RGBA{A: 255}
+			if y >= barHeight && y < bounds.Dy()-barHeight {
+				c = color.RGBA{R: uint8(x * 255 / bounds.Dx()), G: uint8(y * 255 / bounds.Dy()), B: 160, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	jpeg.Encode(w, img, nil)
+}
+
+// videoplayback serves stream bytes, honouring the range=start-end query
+// parameter the player library uses to download in chunks
+func (s *Server) videoplayback(w http.ResponseWriter, r *http.Request) {
+	if expire, err := strconv.ParseInt(r.URL.Query().Get("expire"), 10, 64); err == nil && time.Now().Unix() > expire {
+		http.Error(w, "expired", http.StatusForbidden)
+		return
+	}
+
+	media, size, err := s.openMedia()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer media.Close()
+
+	start, end := int64(0), size-1
+	if value := r.URL.Query().Get("range"); value != "" {
+		from, to, ok := strings.Cut(value, "-")
+		start, err = strconv.ParseInt(from, 10, 64)
+		if ok && err == nil {
+			end, err = strconv.ParseInt(to, 10, 64)
+		}
+		if !ok || err != nil || start > end || end >= size {
+			http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	length := end - start + 1
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	id := r.URL.Query().Get("id")
+	s.mu.Lock()
+	s.streamRequests[id]++
+	requests := s.streamRequests[id]
+	s.mu.Unlock()
+
+	// Sending less than the declared length makes the server close the
+	// connection, which the client sees as an unexpected EOF
+	if strings.HasPrefix(id, "DROPS") && requests <= 2 {
+		length /= 2
+	}
+	io.Copy(w, io.NewSectionReader(media, start, length))
+}
+
+// fixture returns a handler serving a fixture file as is
+func (s *Server) fixture(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.serveFixture(w, name)
+	}
+}
+
+func (s *Server) serveFixture(w http.ResponseWriter, name string) {
+	data, err := os.ReadFile(filepath.Join(s.FixtureDir, name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) mediaSize() (int64, error) {
+	if s.MediaFile == "" {
+		return defaultMediaSize, nil
+	}
+	info, err := os.Stat(s.MediaFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat media file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// openMedia opens the configured media file, or a synthetic stream
+func (s *Server) openMedia() (media readAtCloser, size int64, err error) {
+	if s.MediaFile == "" {
+		return syntheticMedia{}, defaultMediaSize, nil
+	}
+	file, err := os.Open(s.MediaFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open media file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat media file: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+type readAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// syntheticMedia is a repeating byte pattern, so every chunk of a stream can
+// be checked by its offset
+type syntheticMedia struct{}
+
+func (syntheticMedia) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = byte((off + int64(i)) % 251)
+	}
+	return len(p), nil
+}
+
+func (syntheticMedia) Close() error {
+	return nil
+}
+
+// innertubePayload holds the request fields the fake endpoints look at
+type innertubePayload struct {
+	VideoID string `json:"videoId"`
+	Context struct {
+		Client struct {
+			ClientName string `json:"clientName"`
+		} `json:"client"`
+	} `json:"context"`
+}
@@ -0,0 +1,76 @@
+// Package logging sets up the server's structured log and carries
+// per-request loggers through contexts, so service log lines can be
+// correlated with the request that caused them.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"musiq/config"
+)
+
+// New creates a logger writing to w in the configured format and level
+func New(w io.Writer, cfg config.Log) *slog.Logger {
+	var level slog.Level
+	// Validated by config, so unknown levels can't occur
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+type contextKey struct{}
+
+// requestLog is the logger of a request and the fields handlers add for
+// its access log line
+type requestLog struct {
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	fields []any
+}
+
+// NewContext returns a context carrying logger for a request
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLog{logger: logger})
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLog); ok {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// Annotate adds fields, as slog key-value pairs, to the access log line of
+// the request ctx belongs to. It does nothing outside a request.
+func Annotate(ctx context.Context, args ...any) {
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.fields = append(rl.fields, args...)
+}
+
+// Fields returns the fields added to the request of ctx with Annotate
+func Fields(ctx context.Context) []any {
+	rl, ok := ctx.Value(contextKey{}).(*requestLog)
+	if !ok {
+		return nil
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return slices.Clone(rl.fields)
+}
@@ -1,70 +1,102 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"musiq/config"
 	"musiq/handlers"
-	"musiq/middleware"
+	"musiq/logging"
+	"musiq/metrics"
+	"musiq/services"
 	"musiq/web"
-
-	"github.com/gin-gonic/gin"
 )
 
+// ffmpegKillTimeout is how long ffmpeg processes left after the drain get
+// to exit after SIGTERM before they are killed
+const ffmpegKillTimeout = 5 * time.Second
+
 func main() {
-	// Set Gin mode based on environment
-	if os.Getenv("GIN_MODE") == "" {
-		gin.SetMode(gin.ReleaseMode)
+	printConfig := flag.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
-	r := gin.Default()
-
-	// Apply CORS middleware
-	r.Use(middleware.CORS())
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		fmt.Print(string(out))
+		return
+	}
 
-	// Serve static files
-	r.Static("/static", "./web/static")
+	// The standard log package writes through the default logger too
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log))
 
-	// UI routes (templ-rendered HTML)
-	r.GET("/", web.HomePage)
-	ui := r.Group("/ui")
-	{
-		ui.GET("/search", web.SearchResultsView)
-		ui.GET("/play/:id", web.PlayerView)
-		ui.GET("/playlists", web.PlaylistSearchView)
-		ui.GET("/playlist/:id", web.PlaylistVideosView)
+	svc, err := services.New(cfg)
+	if err != nil {
+		slog.Error("Failed to start services", "error", err)
+		os.Exit(1)
 	}
+	handlers.Configure(svc)
+	web.Configure(svc)
+	metrics.RegisterCacheStats(svc.YouTube.CacheStats)
 
-	// API routes (JSON)
-	api := r.Group("/api")
-	{
-		// Search
-		api.GET("/search/:q", handlers.Search)
+	r, err := newRouter(cfg, svc)
+	if err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
 
-		// Audio/Video streaming
-		api.GET("/listen/:id/:name", handlers.Listen)
-		api.GET("/watch/:id/:name", handlers.Watch)
+	srv := &http.Server{
+		Addr:     ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:  r,
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	go func() {
+		slog.Info("Server starting", "port", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
 
-		// Video info
-		api.GET("/info/:id", handlers.Info)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	shutdown(srv, svc, cfg.Server.ShutdownTimeout)
+}
 
-		// Related videos
-		api.GET("/getvideo/:id", handlers.GetVideo)
-		api.GET("/related/:id", handlers.Related)
+// shutdown stops accepting connections and lets in-flight requests, such
+// as streams, finish within timeout. Streams still running then are cut off
+// and their ffmpeg processes terminated.
+func shutdown(srv *http.Server, svc *services.Services, timeout time.Duration) {
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", timeout.String())
 
-		// Playlists
-		api.GET("/playlist/search/:q", handlers.PlaylistSearch)
-		api.GET("/getplaylist/:id", handlers.GetPlaylist)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Drain deadline passed, closing remaining connections")
 	}
 
-	// Get port from environment or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// ffmpeg exits on its own once its streams end; whatever is left gets
+	// a few seconds to exit cleanly before it is killed
+	killCtx, cancelKill := context.WithTimeout(context.Background(), ffmpegKillTimeout)
+	defer cancelKill()
+	svc.FFmpeg.Shutdown(killCtx)
+	srv.Close()
 
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,202 @@
+// Package metrics defines the Prometheus metrics the server exposes on
+// /metrics: HTTP traffic, streams, ffmpeg processes, upstream calls and
+// cache effectiveness.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"musiq/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "musiq"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method. Streams are observed when they end.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"route", "method"})
+
+	httpResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_response_bytes_total",
+		Help:      "HTTP response body bytes by route, counted when the response ends.",
+	}, []string{"route"})
+
+	activeStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Audio and video streams being served.",
+	}, []string{"kind"})
+
+	streamBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_bytes_total",
+		Help:      "Bytes written to stream clients, counted as they are sent.",
+	}, []string{"kind"})
+
+	ffmpegProcesses = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_processes",
+		Help:      "Running ffmpeg processes by operation.",
+	}, []string{"operation"})
+
+	ffmpegExits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_exits_total",
+		Help:      "Finished ffmpeg processes by operation and exit code; killed processes have exit code \"signal\".",
+	}, []string{"operation", "exit_code"})
+
+	ffmpegDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_duration_seconds",
+		Help:      "Run time of ffmpeg processes by operation.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"operation"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of upstream requests until response headers, by upstream and endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "endpoint"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused with 429 by budget: api or stream.",
+	}, []string{"budget"})
+
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Upstream requests by upstream, endpoint and result: ok or an error class.",
+	}, []string{"upstream", "endpoint", "result"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a finished HTTP request. Routes are gin route
+// patterns, so IDs in paths don't create new series.
+func ObserveRequest(route, method string, status int, duration time.Duration, bytes int) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+	if bytes > 0 {
+		httpResponseBytes.WithLabelValues(route).Add(float64(bytes))
+	}
+}
+
+// StartStream counts a stream of the given kind as active and returns a
+// writer that counts the bytes sent through it. Call the returned func when
+// the stream ends.
+func StartStream(kind string, w io.Writer) (io.Writer, func()) {
+	gauge := activeStreams.WithLabelValues(kind)
+	gauge.Inc()
+	return &countingWriter{w: w, bytes: streamBytes.WithLabelValues(kind)}, gauge.Dec
+}
+
+type countingWriter struct {
+	w     io.Writer
+	bytes prometheus.Counter
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.bytes.Add(float64(n))
+	return n, err
+}
+
+// FFmpegStarted counts a started ffmpeg process
+func FFmpegStarted(operation string) {
+	ffmpegProcesses.WithLabelValues(operation).Inc()
+}
+
+// FFmpegExited records a finished ffmpeg process. exitCode is -1 for
+// processes killed by a signal.
+func FFmpegExited(operation string, exitCode int, duration time.Duration) {
+	ffmpegProcesses.WithLabelValues(operation).Dec()
+	code := strconv.Itoa(exitCode)
+	if exitCode < 0 {
+		code = "signal"
+	}
+	ffmpegExits.WithLabelValues(operation, code).Inc()
+	ffmpegDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveUpstream records an upstream request. result is "ok" or the class
+// of the failure.
+func ObserveUpstream(upstream, endpoint, result string, duration time.Duration) {
+	upstreamDuration.WithLabelValues(upstream, endpoint).Observe(duration.Seconds())
+	upstreamRequests.WithLabelValues(upstream, endpoint, result).Inc()
+}
+
+// RateLimited counts a request refused by the rate limiter
+func RateLimited(budget string) {
+	rateLimited.WithLabelValues(budget).Inc()
+}
+
+// RegisterCacheStats exposes the counters of the YouTube service caches,
+// read from stats on every scrape
+func RegisterCacheStats(stats func() models.StatsResponse) {
+	prometheus.MustRegister(&cacheCollector{stats: stats})
+}
+
+var (
+	cacheEntriesDesc = prometheus.NewDesc(namespace+"_cache_entries",
+		"Entries held by each cache.", []string{"cache"}, nil)
+	cacheLookupsDesc = prometheus.NewDesc(namespace+"_cache_lookups_total",
+		"Cache lookups by cache and result: hit, negative_hit, stale_hit or miss.", []string{"cache", "result"}, nil)
+	cacheHitRatioDesc = prometheus.NewDesc(namespace+"_cache_hit_ratio",
+		"Share of lookups answered from each cache since startup.", []string{"cache"}, nil)
+)
+
+// cacheCollector turns the caches' own counters into metrics, so the
+// caches don't need to know about Prometheus
+type cacheCollector struct {
+	stats func() models.StatsResponse
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheEntriesDesc
+	ch <- cacheLookupsDesc
+	ch <- cacheHitRatioDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	for name, cache := range map[string]models.CacheStats{
+		"video":    stats.VideoCache,
+		"search":   stats.SearchCache,
+		"playlist": stats.PlaylistCache,
+		"mix":      stats.MixCache,
+	} {
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(cache.Entries), name)
+		for result, count := range map[string]int64{
+			"hit":          cache.Hits,
+			"negative_hit": cache.NegativeHits,
+			"stale_hit":    cache.StaleHits,
+			"miss":         cache.Misses,
+		} {
+			ch <- prometheus.MustNewConstMetric(cacheLookupsDesc, prometheus.CounterValue, float64(count), name, result)
+		}
+		ch <- prometheus.MustNewConstMetric(cacheHitRatioDesc, prometheus.GaugeValue, cache.HitRate, name)
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"musiq/logging"
+	"musiq/models"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyQueryParam carries the API key of requests that can't set headers,
+// such as those of audio and video elements
+const APIKeyQueryParam = "key"
+
+// apiKeyCookie carries the API key of the web UI, set by RememberAPIKey
+const apiKeyCookie = "musiq_key"
+
+// apiKeyContextKey stores the authenticated *services.APIKey in the gin
+// context
+const apiKeyContextKey = "apiKey"
+
+// Auth authenticates requests with the keys of an API key store. Without a
+// store, authentication is disabled and every request is allowed.
+type Auth struct {
+	keys *services.APIKeyStore
+}
+
+// NewAuth creates the authentication middlewares for keys, which may be
+// nil
+func NewAuth(keys *services.APIKeyStore) *Auth {
+	return &Auth{keys: keys}
+}
+
+// Authenticate returns a middleware that requires a valid API key, taken
+// from the X-API-Key header or the web UI cookie. The request and the bytes
+// served are counted for the key once it ends.
+func (a *Auth) Authenticate() gin.HandlerFunc {
+	return a.authenticate(false)
+}
+
+// AuthenticateWithQuery is Authenticate that also takes the key from the
+// key query parameter. Keys in URLs end up in logs, history and Referer
+// headers, so it is only used where headers can't be set: media and
+// thumbnails loaded by HTML elements, and the web UI entry point.
+func (a *Auth) AuthenticateWithQuery() gin.HandlerFunc {
+	return a.authenticate(true)
+}
+
+func (a *Auth) authenticate(query bool) gin.HandlerFunc {
+	hint := fmt.Sprintf("Send the key in the %s header", APIKeyHeader)
+	if query {
+		hint += fmt.Sprintf(" or the %s query parameter", APIKeyQueryParam)
+	}
+
+	return func(c *gin.Context) {
+		if a.keys == nil {
+			c.Next()
+			return
+		}
+
+		secret := apiKeyCredential(c, query)
+		if secret == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:   "API key required",
+				Message: hint,
+			})
+			return
+		}
+		key, ok := a.keys.Lookup(secret)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Invalid API key",
+			})
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		logging.Annotate(c.Request.Context(), "apiKey", key.Name)
+		c.Next()
+		key.Record(int64(max(c.Writer.Size(), 0)))
+	}
+}
+
+// Require returns a middleware that refuses requests whose API key doesn't
+// grant scope. The admin scope is refused outright when authentication is
+// disabled.
+func (a *Auth) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.require(c, scope)
+	}
+}
+
+// RequireMedia returns a middleware for listen and watch requests, which
+// need the download scope when they ask for an attachment and the stream
+// scope otherwise
+func (a *Auth) RequireMedia() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := services.ScopeStream
+		if c.Query("download") == "true" {
+			scope = services.ScopeDownload
+		}
+		a.require(c, scope)
+	}
+}
+
+func (a *Auth) require(c *gin.Context, scope string) {
+	// Without keys nobody can prove to be an admin, so admin routes stay
+	// closed instead of becoming public
+	if a.keys == nil && scope == services.ScopeAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Forbidden",
+			Message: "Set AUTH_KEYS_FILE to use admin endpoints",
+		})
+		return
+	}
+	if key, ok := APIKey(c); ok && !key.Allows(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Forbidden",
+			Message: fmt.Sprintf("API key %q lacks the %s scope", key.Name, scope),
+		})
+		return
+	}
+	c.Next()
+}
+
+// RememberAPIKey returns a middleware that keeps an API key given in the
+// query in a cookie, so the pages, thumbnails and streams the web UI loads
+// afterwards are authenticated too
+func (a *Auth) RememberAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := APIKey(c); ok {
+			if secret := c.Query(APIKeyQueryParam); secret != "" {
+				secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+				c.SetSameSite(http.SameSiteLaxMode)
+				c.SetCookie(apiKeyCookie, secret, 0, "/", "", secure, true)
+			}
+		}
+		c.Next()
+	}
+}
+
+// APIKey returns the API key the request was authenticated with
+func APIKey(c *gin.Context) (*services.APIKey, bool) {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil, false
+	}
+	key, ok := value.(*services.APIKey)
+	return key, ok
+}
+
+// apiKeyCredential returns the key the client sent, if any. The query
+// parameter is only read when query is set.
+func apiKeyCredential(c *gin.Context, query bool) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if key := c.Query(APIKeyQueryParam); query && key != "" {
+		return key
+	}
+	if key, err := c.Cookie(apiKeyCookie); err == nil {
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthEngine serves /search and /admin behind their scopes, and /listen
+// like the media routes
+func newAuthEngine(auth *Auth) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/search", auth.Authenticate(), auth.Require(services.ScopeSearch), ok)
+	r.GET("/admin", auth.Authenticate(), auth.Require(services.ScopeAdmin), ok)
+	r.GET("/listen", auth.AuthenticateWithQuery(), auth.Require(services.ScopeSearch), ok)
+	return r
+}
+
+func TestAuthRequire(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   bool
+		path   string
+		key    string
+		status int
+	}{
+		{name: "open search", path: "/search", status: http.StatusNoContent},
+		// Admin routes must not become public when keys aren't configured
+		{name: "open admin", path: "/admin", status: http.StatusForbidden},
+		{name: "search without key", keys: true, path: "/search", status: http.StatusUnauthorized},
+		{name: "search with key", keys: true, path: "/search", key: partnerKey, status: http.StatusNoContent},
+		{name: "admin without scope", keys: true, path: "/admin", key: partnerKey, status: http.StatusForbidden},
+		// Keys in URLs end up in logs, so only media routes read them
+		{name: "search with query key", keys: true, path: "/search?key=" + partnerKey, status: http.StatusUnauthorized},
+		{name: "media with query key", keys: true, path: "/listen?key=" + partnerKey, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuth(nil)
+			if tt.keys {
+				auth = newTestAuth(t)
+			}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			newAuthEngine(auth).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -1,22 +1,166 @@
 package middleware
 
 import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"musiq/config"
+
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	corsAllowMethods  = "GET, HEAD, OPTIONS"
+	corsAllowHeaders  = "Accept, Content-Type, Range, If-None-Match, If-Modified-Since, X-Request-ID, X-API-Key"
+	corsExposeHeaders = "X-Request-ID, RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After"
+	// corsExposeMediaHeaders let players seek and name downloads
+	corsExposeMediaHeaders = corsExposeHeaders + ", Accept-Ranges, Content-Range, Content-Disposition, ETag"
+)
+
+// corsRouteGroups assign request paths to the route groups of CORS
+// policies; the first matching prefix wins and other paths, such as the
+// web UI's, belong to ui. Groups go by path because preflight requests
+// match no route. Versioned paths are matched without their version.
+var corsRouteGroups = []struct{ prefix, group string }{
+	{"/api/listen/", "media"},
+	{"/api/watch/", "media"},
+	{"/api/thumb/", "media"},
+	{"/api/stats", "admin"},
+	{"/api/admin/", "admin"},
+	{"/api", "api"},
+}
+
 // CORS returns a middleware that handles Cross-Origin Resource Sharing
-func CORS() gin.HandlerFunc {
+// with the policy of each route group. Preflight requests are answered
+// here, so they reach neither authentication nor rate limits.
+func CORS(cfg config.CORS) gin.HandlerFunc {
+	policies := make(map[string]*corsPolicy, len(config.CORSGroups))
+	for _, group := range config.CORSGroups {
+		policies[group] = newCORSPolicy(cfg.Policy(group), group == "media")
+	}
+
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Range, Content-Disposition")
+		policy := policies[corsRouteGroup(c.Request.URL.Path)]
+		origin := c.GetHeader("Origin")
+
+		switch {
+		case policy.anyOrigin:
+			c.Header("Access-Control-Allow-Origin", "*")
+		case origin != "" && policy.allows(origin):
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if !policy.anyOrigin {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		allowed := c.Writer.Header().Get("Access-Control-Allow-Origin") != ""
+		if allowed {
+			if policy.credentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+			c.Header("Access-Control-Expose-Headers", policy.exposeHeaders)
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			if allowed && c.GetHeader("Access-Control-Request-Method") != "" {
+				c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+				c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+				if policy.maxAge != "" {
+					c.Header("Access-Control-Max-Age", policy.maxAge)
+				}
+			}
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// corsRouteGroup returns the route group of a request path
+func corsRouteGroup(path string) string {
+	if rest, ok := strings.CutPrefix(path, "/api/v1/"); ok {
+		path = "/api/" + rest
+	}
+	for _, g := range corsRouteGroups {
+		if strings.HasPrefix(path, g.prefix) {
+			return g.group
+		}
+	}
+	return "ui"
+}
+
+// corsPolicy is a config.CORSPolicy prepared for matching origins
+type corsPolicy struct {
+	anyOrigin     bool
+	origins       []string
+	patterns      []originPattern
+	credentials   bool
+	maxAge        string
+	exposeHeaders string
+}
+
+// originPattern matches the origins of any subdomain, such as those of
+// https://*.example.com, by their scheme and the rest of the host
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+func newCORSPolicy(cfg config.CORSPolicy, media bool) *corsPolicy {
+	p := &corsPolicy{
+		anyOrigin:     slices.Contains(cfg.AllowedOrigins, "*"),
+		credentials:   cfg.AllowCredentials,
+		exposeHeaders: corsExposeHeaders,
+	}
+	if media {
+		p.exposeHeaders = corsExposeMediaHeaders
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if scheme, host, ok := strings.Cut(origin, "://*."); ok {
+			p.patterns = append(p.patterns, originPattern{prefix: scheme + "://", suffix: "." + host})
+		} else {
+			p.origins = append(p.origins, origin)
+		}
+	}
+	return p
+}
+
+// allows reports whether the policy lets origin call the server
+func (p *corsPolicy) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || slices.Contains(p.origins, origin) {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether origin is on a subdomain of the pattern's host.
+// The host itself doesn't match, and neither do ports other than its own.
+func (p originPattern) matches(origin string) bool {
+	if len(origin) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	subdomain := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	if strings.HasPrefix(subdomain, ".") {
+		return false
+	}
+	for _, r := range subdomain {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"musiq/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOriginPatternMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{name: "subdomain", pattern: "https://*.example.com", origin: "https://app.example.com", want: true},
+		{name: "nested subdomain", pattern: "https://*.example.com", origin: "https://eu.app.example.com", want: true},
+		{name: "upper case", pattern: "https://*.Example.com", origin: "https://APP.example.COM", want: true},
+		{name: "bare host", pattern: "https://*.example.com", origin: "https://example.com"},
+		{name: "empty subdomain", pattern: "https://*.example.com", origin: "https://.example.com"},
+		{name: "other scheme", pattern: "https://*.example.com", origin: "http://app.example.com"},
+		{name: "other port", pattern: "https://*.example.com", origin: "https://app.example.com:8443"},
+		{name: "own port", pattern: "https://*.example.com:8443", origin: "https://app.example.com:8443", want: true},
+		{name: "missing port", pattern: "https://*.example.com:8443", origin: "https://app.example.com"},
+		{name: "lookalike host", pattern: "https://*.example.com", origin: "https://evilexample.com"},
+		{name: "host as subdomain", pattern: "https://*.example.com", origin: "https://app.example.com.evil.net"},
+		{name: "userinfo", pattern: "https://*.example.com", origin: "https://evil.net@app.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newCORSPolicy(config.CORSPolicy{AllowedOrigins: []string{tt.pattern}}, false)
+			if got := policy.allows(tt.origin); got != tt.want {
+				t.Errorf("allows(%q) with %s = %v, want %v", tt.origin, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+// newCORSEngine serves a route of each CORS route group
+func newCORSEngine(cfg config.CORS) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORS(cfg))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	for _, path := range []string{"/api/search", "/api/v1/listen/x", "/api/admin/keys", "/"} {
+		r.GET(path, ok)
+	}
+	return r
+}
+
+func TestCORS(t *testing.T) {
+	credentials := true
+	maxAge := time.Hour
+	trusted := config.CORS{
+		CORSPolicy: config.CORSPolicy{
+			AllowedOrigins:   []string{"https://*.example.com"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+	}
+	grouped := config.CORS{
+		CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"*"}},
+		Groups: map[string]config.CORSOverride{
+			"admin": {AllowedOrigins: []string{"https://ops.example.com"}, AllowCredentials: &credentials, MaxAge: &maxAge},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		cfg    config.CORS
+		method string
+		path   string
+		origin string
+		// preflight sets Access-Control-Request-Method
+		preflight bool
+		status    int
+		// headers are the expected response headers; "" means unset
+		headers map[string]string
+	}{
+		{
+			name: "any origin", cfg: config.Default().CORS, path: "/api/search", origin: "https://other.net",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    corsExposeHeaders,
+				"Vary":                             "",
+			},
+		},
+		{
+			name: "allowed origin", cfg: trusted, path: "/api/search", origin: "https://app.example.com",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name: "refused origin", cfg: trusted, path: "/api/search", origin: "https://example.com",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    "",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name: "media expose headers", cfg: config.Default().CORS, path: "/api/v1/listen/x", origin: "https://other.net",
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Expose-Headers": corsExposeMediaHeaders},
+		},
+		{
+			name: "preflight", cfg: trusted, method: http.MethodOptions, path: "/api/search", origin: "https://app.example.com", preflight: true,
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": corsAllowMethods,
+				"Access-Control-Allow-Headers": corsAllowHeaders,
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		// Preflights of unrouted paths are answered too
+		{
+			name: "preflight without route", cfg: config.Default().CORS, method: http.MethodOptions, path: "/api/v1/thumb/x", origin: "https://other.net", preflight: true,
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": corsExposeMediaHeaders,
+				"Access-Control-Max-Age":        "600",
+			},
+		},
+		{
+			name: "refused preflight", cfg: trusted, method: http.MethodOptions, path: "/api/search", origin: "https://other.net", preflight: true,
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			name: "OPTIONS without preflight", cfg: trusted, method: http.MethodOptions, path: "/api/search", origin: "https://app.example.com",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name: "no max age", cfg: config.CORS{CORSPolicy: config.CORSPolicy{AllowedOrigins: []string{"*"}}},
+			method: http.MethodOptions, path: "/api/search", origin: "https://other.net", preflight: true,
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Max-Age": ""},
+		},
+		{
+			name: "group default policy", cfg: grouped, path: "/", origin: "https://other.net",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name: "group override", cfg: grouped, path: "/api/admin/keys", origin: "https://ops.example.com",
+			status: http.StatusNoContent,
+			headers: map[string]string{
+				"Access-Control-Allow-Origin":      "https://ops.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name: "group override refuses", cfg: grouped, path: "/api/admin/keys", origin: "https://other.net",
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "group override preflight", cfg: grouped, method: http.MethodOptions, path: "/api/v1/admin/keys", origin: "https://ops.example.com", preflight: true,
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Max-Age": "3600"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			newCORSEngine(tt.cfg).ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			for name, want := range tt.headers {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"musiq/logging"
+	"musiq/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs, which end up in every
+// log line of the request
+const maxRequestIDLength = 128
+
+// RequestID returns a middleware that gives each request an ID, taken from
+// an incoming X-Request-ID header when it is usable, echoes it in the
+// response and puts a logger carrying it in the request context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, id)
+
+		logger := slog.Default().With("requestId", id)
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so a client
+// can't forge log structure
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// probeRoutes are polled by orchestrators and scrapers, so their successful
+// requests are only logged at debug level
+var probeRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// Logger returns a middleware that logs each request once it is served,
+// with the fields handlers added using logging.Annotate. Requests whose
+// client went away before the response ended are marked as disconnected.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case probeRoutes[route]:
+			level = slog.LevelDebug
+		}
+
+		ctx := c.Request.Context()
+		args := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"bytes", c.Writer.Size(),
+			"durationMs", float64(time.Since(start).Microseconds()) / 1000,
+			"clientIp", c.ClientIP(),
+			"disconnected", ctx.Err() != nil,
+		}
+		logging.FromContext(ctx).Log(ctx, level, "Request", append(args, logging.Fields(ctx)...)...)
+	}
+}
+
+// Recovery returns a middleware that turns panics into 500 responses and
+// logs them with the request's logger
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		logging.FromContext(c.Request.Context()).Error("Panic while serving request",
+			"error", err,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Internal server error",
+		})
+	})
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"time"
+
+	"musiq/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics returns a middleware that records request counts, latencies and
+// response sizes per route
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, c.Request.Method, c.Writer.Status(), time.Since(start), c.Writer.Size())
+	}
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"musiq/config"
+	"musiq/metrics"
+	"musiq/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the API key of a client
+const APIKeyHeader = "X-API-Key"
+
+// bucketSweepInterval is how often buckets that refilled completely are
+// dropped, so one-off clients don't accumulate
+const bucketSweepInterval = time.Minute
+
+// RateLimiter limits how often each client may call the API and start
+// streams, with a token bucket per client and budget. Clients are told
+// apart by API key when they authenticated and by IP otherwise. They are
+// told their budget in RateLimit-* headers and get 429 with Retry-After
+// once it runs out.
+type RateLimiter struct {
+	api     *tokenBuckets
+	streams *tokenBuckets
+
+	allowedPrefixes []netip.Prefix
+	allowedKeyNames []string
+}
+
+// NewRateLimiter creates the limiter for cfg. Allowlist entries that are
+// neither IPs nor CIDR ranges are API key names, which match requests that
+// Authenticate accepted with that key.
+func NewRateLimiter(cfg config.RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		api:     newTokenBuckets("api", cfg.APIPerMinute, cfg.APIBurst),
+		streams: newTokenBuckets("stream", cfg.StreamPerMinute, cfg.StreamBurst),
+	}
+	for _, entry := range cfg.Allowlist {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			l.allowedPrefixes = append(l.allowedPrefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			l.allowedPrefixes = append(l.allowedPrefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			l.allowedKeyNames = append(l.allowedKeyNames, entry)
+		}
+	}
+	return l
+}
+
+// API returns a middleware that spends from the budget of JSON API and web
+// UI requests
+func (l *RateLimiter) API() gin.HandlerFunc {
+	return l.limit(l.api)
+}
+
+// Streams returns a middleware that spends from the budget of streaming
+// requests, which cost an ffmpeg process and upstream bandwidth each
+func (l *RateLimiter) Streams() gin.HandlerFunc {
+	return l.limit(l.streams)
+}
+
+// FailedAuth returns a middleware for ahead of Authenticate that charges
+// requests refused with 401 to the API budget of the client's address, so
+// API keys can't be guessed faster than that budget allows. Once it is
+// spent, requests from the address get 429 before their key is checked.
+func (l *RateLimiter) FailedAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.api.disabled() || l.allowed(c) {
+			c.Next()
+			return
+		}
+
+		client := "ip:" + c.ClientIP()
+		if result := l.api.peek(client, time.Now()); !result.allowed {
+			refuse(c, l.api, result)
+			return
+		}
+		c.Next()
+		if c.Writer.Status() == http.StatusUnauthorized {
+			l.api.take(client, time.Now())
+		}
+	}
+}
+
+func (l *RateLimiter) limit(buckets *tokenBuckets) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if buckets.disabled() || l.allowed(c) {
+			c.Next()
+			return
+		}
+
+		// Clients with an API key share its budget wherever they connect from
+		client := "ip:" + c.ClientIP()
+		if key, ok := APIKey(c); ok {
+			client = "key:" + key.Name
+		}
+		result := buckets.take(client, time.Now())
+		if !result.allowed {
+			refuse(c, buckets, result)
+			return
+		}
+		setRateLimitHeaders(c, buckets, result)
+		c.Next()
+	}
+}
+
+// refuse answers 429 once a client's budget is spent
+func refuse(c *gin.Context, buckets *tokenBuckets, result takeResult) {
+	setRateLimitHeaders(c, buckets, result)
+	metrics.RateLimited(buckets.name)
+	retryAfter := ceilSeconds(result.retryAfter)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Error:   "Too many requests",
+		Message: fmt.Sprintf("%s rate limit exceeded, retry in %d seconds", buckets.name, retryAfter),
+	})
+}
+
+// setRateLimitHeaders tells the client its budget
+func setRateLimitHeaders(c *gin.Context, buckets *tokenBuckets, result takeResult) {
+	c.Header("RateLimit-Policy", buckets.policy)
+	c.Header("RateLimit-Limit", strconv.Itoa(buckets.burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+}
+
+// allowed reports whether the client is on the allowlist, by address or
+// by the name of the API key it authenticated with
+func (l *RateLimiter) allowed(c *gin.Context) bool {
+	if key, ok := APIKey(c); ok && slices.Contains(l.allowedKeyNames, key.Name) {
+		return true
+	}
+
+	if len(l.allowedPrefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.allowedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ceilSeconds rounds d up to whole seconds for headers
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// tokenBuckets are the buckets of one budget, by client
+type tokenBuckets struct {
+	name   string
+	policy string
+	// rate is in tokens per second
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// takeResult is the outcome of spending a token. reset is when the bucket
+// is full again, retryAfter when the next token is available.
+type takeResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func newTokenBuckets(name string, perMinute, burst int) *tokenBuckets {
+	return &tokenBuckets{
+		name:    name,
+		policy:  fmt.Sprintf("%d;w=60;burst=%d", perMinute, burst),
+		rate:    float64(perMinute) / 60,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (b *tokenBuckets) disabled() bool {
+	return b.rate <= 0
+}
+
+// take spends a token from the bucket of key, refilling it for the time
+// since it was last used. New clients start with a full bucket.
+func (b *tokenBuckets) take(key string, now time.Time) takeResult {
+	return b.use(key, now, true)
+}
+
+// peek reports whether the bucket of key has a token left without
+// spending it
+func (b *tokenBuckets) peek(key string, now time.Time) takeResult {
+	return b.use(key, now, false)
+}
+
+func (b *tokenBuckets) use(key string, now time.Time, spend bool) takeResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.lastSweep) >= bucketSweepInterval {
+		b.sweep(now)
+	}
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(b.burst), updated: now}
+		b.buckets[key] = bucket
+	}
+	bucket.tokens = b.refill(bucket, now)
+	bucket.updated = now
+
+	result := takeResult{}
+	if bucket.tokens >= 1 {
+		if spend {
+			bucket.tokens--
+		}
+		result.allowed = true
+	} else {
+		result.retryAfter = b.duration(1 - bucket.tokens)
+	}
+	result.remaining = int(bucket.tokens)
+	result.reset = b.duration(float64(b.burst) - bucket.tokens)
+	return result
+}
+
+func (b *tokenBuckets) refill(bucket *tokenBucket, now time.Time) float64 {
+	return min(float64(b.burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*b.rate)
+}
+
+// duration returns how long the bucket takes to gain tokens
+func (b *tokenBuckets) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that refilled completely, which are the same as
+// a new client's
+func (b *tokenBuckets) sweep(now time.Time) {
+	for key, bucket := range b.buckets {
+		if b.refill(bucket, now) >= float64(b.burst) {
+			delete(b.buckets, key)
+		}
+	}
+	b.lastSweep = now
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"musiq/config"
+	"musiq/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the test key store
+const (
+	partnerKey = "partnerpartner1234"
+	trustedKey = "trustedtrusted1234"
+)
+
+// newTestAuth returns an Auth with the partner and trusted keys
+func newTestAuth(t *testing.T) *Auth {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	keys := "keys:\n" +
+		"  - name: partner\n    key: " + partnerKey + "\n    scopes: [search]\n" +
+		"  - name: trusted\n    key: " + trustedKey + "\n    scopes: [search]\n"
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+	store, err := services.NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewAPIKeyStore() error = %v", err)
+	}
+	return NewAuth(store)
+}
+
+// newLimitedEngine serves /ping behind authentication and the API budget,
+// like the API routes
+func newLimitedEngine(auth *Auth, cfg config.RateLimit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	limits := NewRateLimiter(cfg)
+	r.GET("/ping", limits.FailedAuth(), auth.Authenticate(), limits.API(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+// statuses sends n requests from addr with key and returns their statuses
+func statuses(r http.Handler, n int, addr, key string) []int {
+	var codes []int
+	for range n {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = addr + ":1234"
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func TestRateLimiterAllowlist(t *testing.T) {
+	cfg := config.RateLimit{APIPerMinute: 1, APIBurst: 2, Allowlist: []string{"10.1.0.0/16", "trusted"}}
+
+	tests := []struct {
+		name string
+		addr string
+		key  string
+		// status is the status of the third request
+		status int
+	}{
+		{name: "partner key", addr: "192.0.2.1", key: partnerKey, status: http.StatusTooManyRequests},
+		{name: "trusted key", addr: "192.0.2.1", key: trustedKey, status: http.StatusNoContent},
+		{name: "allowed range", addr: "10.1.2.3", key: partnerKey, status: http.StatusNoContent},
+		// The allowlist names keys; sending the name as a key authenticates
+		// nothing
+		{name: "key name as secret", addr: "192.0.2.1", key: "trusted", status: http.StatusTooManyRequests},
+		{name: "key name from allowed range", addr: "10.1.2.3", key: "trusted", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLimitedEngine(newTestAuth(t), cfg)
+			if codes := statuses(r, 3, tt.addr, tt.key); codes[2] != tt.status {
+				t.Errorf("statuses = %v, want %d last", codes, tt.status)
+			}
+		})
+	}
+}
+
+func TestRateLimiterBucketsByKey(t *testing.T) {
+	r := newLimitedEngine(newTestAuth(t), config.RateLimit{APIPerMinute: 1, APIBurst: 2})
+
+	// A key shares its budget wherever it connects from
+	first := statuses(r, 2, "192.0.2.1", partnerKey)
+	second := statuses(r, 1, "198.51.100.1", partnerKey)
+	if first[1] != http.StatusNoContent || second[0] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v then %v, want the third request limited", first, second)
+	}
+
+	// Another key has its own budget on the same address
+	if codes := statuses(r, 1, "192.0.2.1", trustedKey); codes[0] != http.StatusNoContent {
+		t.Errorf("statuses of another key = %v, want 204", codes)
+	}
+}
+
+func TestRateLimiterFailedAuth(t *testing.T) {
+	r := newLimitedEngine(newTestAuth(t), config.RateLimit{APIPerMinute: 1, APIBurst: 2})
+
+	// Failed attempts spend the budget of the address until it runs out
+	want := []int{401, 401, 429, 429, 429}
+	if codes := statuses(r, 5, "192.0.2.1", "guessedguessed1234"); !slices.Equal(codes, want) {
+		t.Errorf("statuses of a bad key = %v, want %v", codes, want)
+	}
+	// Keys aren't checked from that address until it refilled
+	if codes := statuses(r, 1, "192.0.2.1", partnerKey); codes[0] != http.StatusTooManyRequests {
+		t.Errorf("statuses of a valid key = %v, want 429", codes)
+	}
+	if codes := statuses(r, 1, "198.51.100.1", partnerKey); codes[0] != http.StatusNoContent {
+		t.Errorf("statuses from another address = %v, want 204", codes)
+	}
+}
@@ -0,0 +1,58 @@
+package models
+
+// MusicSearchResponse represents the response for the /music/search endpoint
+type MusicSearchResponse struct {
+	Query     string          `json:"query"`
+	Songs     []MusicSong     `json:"songs"`
+	Albums    []MusicAlbum    `json:"albums"`
+	Artists   []MusicArtist   `json:"artists"`
+	Playlists []MusicPlaylist `json:"playlists"`
+}
+
+// MusicSong represents a track in YouTube Music search results.
+// AudioID is set when the result is the audio-only upload on the artist's
+// auto-generated "Topic" channel, which is the cleanest source for /listen.
+type MusicSong struct {
+	ID          string      `json:"id"`
+	Title       string      `json:"title"`
+	Artists     []MusicRef  `json:"artists"`
+	Album       *MusicRef   `json:"album,omitempty"`
+	Duration    string      `json:"duration"`
+	DurationSec int         `json:"durationSec"`
+	VideoType   string      `json:"videoType"`
+	AudioID     string      `json:"audioId,omitempty"`
+	Thumbnails  []Thumbnail `json:"thumbnails"`
+}
+
+// MusicAlbum represents an album, single or EP in YouTube Music search results
+type MusicAlbum struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	Type       string      `json:"type"`
+	Artists    []MusicRef  `json:"artists"`
+	Year       string      `json:"year,omitempty"`
+	Thumbnails []Thumbnail `json:"thumbnails"`
+}
+
+// MusicArtist represents an artist in YouTube Music search results
+type MusicArtist struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Subscribers string      `json:"subscribers,omitempty"`
+	Thumbnails  []Thumbnail `json:"thumbnails"`
+}
+
+// MusicPlaylist represents a playlist in YouTube Music search results
+type MusicPlaylist struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title"`
+	Author     string      `json:"author"`
+	ItemCount  string      `json:"itemCount,omitempty"`
+	Thumbnails []Thumbnail `json:"thumbnails"`
+}
+
+// MusicRef references an artist or album by browse ID and name
+type MusicRef struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
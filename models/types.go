@@ -1,12 +1,32 @@
 package models
 
-// RootResponse represents the response for the root endpoint
+import "time"
+
+// RootResponse represents the response for the root endpoint, which
+// describes the API
 type RootResponse struct {
+	Status  int     `json:"status"`
+	Version string  `json:"version"`
+	OpenAPI string  `json:"openapi"`
+	Docs    string  `json:"docs"`
+	Routes  []Route `json:"routes"`
+}
+
+// Route describes an API route
+type Route struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Summary string `json:"summary"`
+}
+
+// LegacyRootResponse is the root response of the unversioned API, kept
+// for the clients that read it
+type LegacyRootResponse struct {
 	Status int    `json:"status"`
 	Routes Routes `json:"routes"`
 }
 
-// Routes contains all available API routes
+// Routes contains the routes of the unversioned API
 type Routes struct {
 	SearchRoute       string `json:"searchRoute"`
 	ListenRoute       string `json:"listenRoute"`
@@ -17,15 +37,36 @@ type Routes struct {
 	PlaylistRouteByID string `json:"playlistRouteById"`
 }
 
-// VideoResult represents a video in search results
+// VideoResult represents a video in search results. Duration, Views and
+// Published keep YouTube's display strings; DurationSec, ViewCount and
+// PublishedAt are their parsed values for sorting and filtering.
 type VideoResult struct {
-	ID          string      `json:"id"`
-	Title       string      `json:"title"`
-	Author      string      `json:"author"`
-	Duration    string      `json:"duration"`
-	DurationSec int         `json:"durationSec"`
-	Views       string      `json:"views"`
-	Thumbnails  []Thumbnail `json:"thumbnails"`
+	ID          string         `json:"id"`
+	Title       string         `json:"title"`
+	Author      string         `json:"author"`
+	Duration    string         `json:"duration"`
+	DurationSec int            `json:"durationSec"`
+	Views       string         `json:"views"`
+	ViewCount   int64          `json:"viewCount"`
+	Published   string         `json:"published,omitempty"`
+	PublishedAt *time.Time     `json:"publishedAt,omitempty"`
+	IsLive      bool           `json:"isLive"`
+	IsNew       bool           `json:"isNew"`
+	HasCaptions bool           `json:"hasCaptions"`
+	Badges      []string       `json:"badges,omitempty"`
+	Thumbnails  []Thumbnail    `json:"thumbnails"`
+	Metadata    *TrackMetadata `json:"metadata,omitempty"`
+	Source      string         `json:"source,omitempty"`
+}
+
+// TrackMetadata holds the artist and track parsed out of a raw video title
+// and uploader channel, with upload noise like "(Official Video) [4K]" removed
+type TrackMetadata struct {
+	Artist    string   `json:"artist"`
+	Title     string   `json:"title"`
+	Featuring []string `json:"featuring,omitempty"`
+	Remix     string   `json:"remix,omitempty"`
+	Channel   string   `json:"channel"`
 }
 
 // Thumbnail represents a video thumbnail
@@ -37,16 +78,20 @@ type Thumbnail struct {
 
 // VideoInfo represents detailed video information
 type VideoInfo struct {
-	ID           string        `json:"id"`
-	Title        string        `json:"title"`
-	Author       string        `json:"author"`
-	Duration     string        `json:"duration"`
-	DurationSec  int           `json:"durationSec"`
-	Views        string        `json:"views"`
-	Description  string        `json:"description"`
-	Thumbnails   []Thumbnail   `json:"thumbnails"`
-	Formats      []VideoFormat `json:"formats"`
-	RelatedSongs []VideoResult `json:"relatedSongs,omitempty"`
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Author       string         `json:"author"`
+	Duration     string         `json:"duration"`
+	DurationSec  int            `json:"durationSec"`
+	Views        string         `json:"views"`
+	ViewCount    int64          `json:"viewCount"`
+	PublishedAt  *time.Time     `json:"publishedAt,omitempty"`
+	Description  string         `json:"description"`
+	Thumbnails   []Thumbnail    `json:"thumbnails"`
+	Formats      []VideoFormat  `json:"formats"`
+	RelatedSongs []VideoResult  `json:"relatedSongs,omitempty"`
+	Metadata     *TrackMetadata `json:"metadata,omitempty"`
+	Source       string         `json:"source,omitempty"`
 }
 
 // VideoFormat represents a video/audio format
@@ -73,12 +118,93 @@ type PlaylistResult struct {
 	Thumbnails []Thumbnail `json:"thumbnails"`
 }
 
+// Playlist represents a playlist's metadata and one page of its videos.
+// Endless playlists (YouTube mixes) grow as further pages are requested, so
+// VideoCount is only the number of videos loaded so far.
+type Playlist struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Author      string        `json:"author"`
+	Description string        `json:"description"`
+	VideoCount  int           `json:"videoCount"`
+	Offset      int           `json:"offset"`
+	Limit       int           `json:"limit"`
+	Endless     bool          `json:"endless,omitempty"`
+	Videos      []VideoResult `json:"videos"`
+}
+
 // RelatedResponse represents the response for the /related endpoint
 type RelatedResponse struct {
 	VideoDetails VideoInfo     `json:"videoDetails"`
 	RelatedSongs []VideoResult `json:"relatedSongs"`
 }
 
+// SuggestResponse represents the response for the /suggest endpoint
+type SuggestResponse struct {
+	Query       string   `json:"query"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// CacheStats reports the effectiveness of an in-process cache. NegativeHits
+// are lookups answered from a cached failure, StaleHits lookups answered
+// from an expired entry while it was refreshed.
+type CacheStats struct {
+	Entries      int     `json:"entries"`
+	Hits         int64   `json:"hits"`
+	NegativeHits int64   `json:"negativeHits,omitempty"`
+	StaleHits    int64   `json:"staleHits,omitempty"`
+	Misses       int64   `json:"misses"`
+	HitRate      float64 `json:"hitRate"`
+}
+
+// StatsResponse represents the response for the stats endpoint
+type StatsResponse struct {
+	VideoCache    CacheStats `json:"videoCache"`
+	SearchCache   CacheStats `json:"searchCache"`
+	PlaylistCache CacheStats `json:"playlistCache"`
+	MixCache      CacheStats `json:"mixCache"`
+}
+
+// Health statuses of the health and readiness endpoints and their checks.
+// A degraded server is ready but missing an optional feature.
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthResponse represents the response for the health and readiness
+// endpoints. Liveness reports no checks.
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the outcome of one readiness check. CheckedAt is when it
+// last ran, since expensive checks are cached.
+type HealthCheck struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// APIKeyUsage reports how much an API key was used since the server
+// started
+type APIKeyUsage struct {
+	Name     string     `json:"name"`
+	Scopes   []string   `json:"scopes"`
+	Requests int64      `json:"requests"`
+	Bytes    int64      `json:"bytes"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// APIKeysResponse represents the response for the API key usage endpoint
+type APIKeysResponse struct {
+	Since time.Time     `json:"since"`
+	Keys  []APIKeyUsage `json:"keys"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error   string `json:"error"`
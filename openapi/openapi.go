@@ -0,0 +1,396 @@
+// Package openapi builds the server's OpenAPI 3 document from its route
+// definitions, deriving the schemas of JSON bodies from the Go types the
+// handlers return.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents
+const Version = "3.0.3"
+
+// Operation describes an API route for the document
+type Operation struct {
+	Method string
+	// Path is the gin route pattern, such as /info/:id
+	Path        string
+	Summary     string
+	Description string
+	Tag         string
+	Params      []Param
+	// Response is a value of the type of successful JSON responses
+	Response any
+	// MediaTypes are the content types of successful non-JSON responses
+	MediaTypes []string
+	// Errors are the statuses the route answers with an error body
+	Errors []int
+	// Scope is the API key scope the route requires, if any
+	Scope string
+}
+
+// Param describes a path or query parameter. Path parameters are always
+// required.
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// Type is string, integer or boolean
+	Type string
+	Enum []string
+}
+
+// Security describes how API keys are sent, when the server requires them.
+// The query parameter is only accepted by operations with MediaTypes.
+type Security struct {
+	Header     string
+	QueryParam string
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                               `json:"openapi"`
+	Info       Info                                 `json:"info"`
+	Servers    []Server                             `json:"servers"`
+	Tags       []Tag                                `json:"tags,omitempty"`
+	Paths      map[string]map[string]*PathOperation `json:"paths"`
+	Components Components                           `json:"components"`
+	Security   []map[string][]string                `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is the base URL the paths are relative to
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathOperation is an operation of a path
+type PathOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Scope       string                `json:"x-scope,omitempty"`
+}
+
+// Parameter is a parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the body of a response in one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas of the model types and the security schemes
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is an API key scheme
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of OpenAPI schemas the model types need
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Build creates the document of ops, served under serverURL. errorBody is
+// a value of the type of error responses. Without security, operations
+// need no API key.
+func Build(info Info, serverURL string, ops []Operation, errorBody any, security *Security) *Document {
+	b := &builder{schemas: make(map[string]*Schema)}
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Servers: []Server{{URL: serverURL}},
+		Paths:   make(map[string]map[string]*PathOperation),
+	}
+	errorRef := b.schema(reflect.TypeOf(errorBody))
+
+	if security != nil {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			"apiKeyHeader": {Type: "apiKey", Name: security.Header, In: "header"},
+			"apiKeyQuery": {
+				Type:        "apiKey",
+				Name:        security.QueryParam,
+				In:          "query",
+				Description: "For media and thumbnails loaded by HTML elements, which can't set headers",
+			},
+		}
+		doc.Security = []map[string][]string{{"apiKeyHeader": {}}}
+	}
+
+	seenTags := make(map[string]bool)
+	for _, op := range ops {
+		if op.Tag != "" && !seenTags[op.Tag] {
+			seenTags[op.Tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: op.Tag})
+		}
+
+		path, pathParams := convertPath(op.Path)
+		operation := &PathOperation{
+			OperationID: operationID(op),
+			Summary:     op.Summary,
+			Description: op.Description,
+			Responses:   make(map[string]*Response),
+			Scope:       op.Scope,
+		}
+		if op.Tag != "" {
+			operation.Tags = []string{op.Tag}
+		}
+		if security != nil && len(op.MediaTypes) > 0 {
+			operation.Security = []map[string][]string{{"apiKeyHeader": {}}, {"apiKeyQuery": {}}}
+		}
+
+		for _, param := range op.Params {
+			parameter := Parameter{
+				Name:        param.Name,
+				In:          param.In,
+				Description: param.Description,
+				Required:    param.Required || param.In == "path",
+				Schema:      &Schema{Type: param.Type, Enum: param.Enum},
+			}
+			if parameter.Schema.Type == "" {
+				parameter.Schema.Type = "string"
+			}
+			operation.Parameters = append(operation.Parameters, parameter)
+		}
+		for _, name := range pathParams {
+			if !hasParam(op.Params, name) {
+				operation.Parameters = append(operation.Parameters, Parameter{
+					Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+				})
+			}
+		}
+
+		ok := &Response{Description: "OK", Content: make(map[string]*MediaType)}
+		if op.Response != nil {
+			ok.Content["application/json"] = &MediaType{Schema: b.schema(reflect.TypeOf(op.Response))}
+		}
+		for _, mediaType := range op.MediaTypes {
+			ok.Content[mediaType] = &MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+		operation.Responses["200"] = ok
+
+		// Missing keys, keys without the scope and rate limits apply to
+		// every route
+		statuses := op.Errors
+		if security != nil {
+			statuses = slices.Concat(statuses, []int{http.StatusUnauthorized})
+			if op.Scope != "" {
+				statuses = slices.Concat(statuses, []int{http.StatusForbidden})
+			}
+		}
+		statuses = slices.Concat(statuses, []int{http.StatusTooManyRequests})
+		for _, status := range statuses {
+			operation.Responses[strconv.Itoa(status)] = &Response{
+				Description: http.StatusText(status),
+				Content:     map[string]*MediaType{"application/json": {Schema: errorRef}},
+			}
+		}
+
+		method := strings.ToLower(op.Method)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*PathOperation)
+		}
+		doc.Paths[path][method] = operation
+	}
+
+	doc.Components.Schemas = b.schemas
+	return doc
+}
+
+// Path converts a gin route pattern to an OpenAPI path
+func Path(pattern string) string {
+	path, _ := convertPath(pattern)
+	return path
+}
+
+// convertPath turns :name and *name segments into {name} and returns the
+// parameter names
+func convertPath(pattern string) (string, []string) {
+	segments := strings.Split(pattern, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	path := strings.Join(segments, "/")
+	if path == "" {
+		path = "/"
+	}
+	return path, params
+}
+
+// operationID derives an ID such as getInfoById from the method and path
+func operationID(op Operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, segment := range strings.Split(op.Path, "/") {
+		by := strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*")
+		if by {
+			segment = segment[1:]
+			b.WriteString("By")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+func hasParam(params []Param, name string) bool {
+	return slices.ContainsFunc(params, func(p Param) bool {
+		return p.Name == name
+	})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// builder collects the schemas of named struct types as components
+type builder struct {
+	schemas map[string]*Schema
+}
+
+// schema returns the schema of t, referencing named structs
+func (b *builder) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return b.schema(t.Elem())
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			// Registered before its fields, so recursive types terminate
+			b.schemas[t.Name()] = &Schema{}
+			*b.schemas[t.Name()] = *b.structSchema(t)
+		}
+		return ref
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema lists the fields encoding/json writes. Fields without
+// omitempty are required; those that can be nil are nullable, since they
+// are written as null.
+func (b *builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		omitempty := strings.Contains(options, "omitempty")
+
+		if field.Anonymous && field.Tag.Get("json") == "" && field.Type.Kind() == reflect.Struct {
+			embedded := b.structSchema(field.Type)
+			for n, p := range embedded.Properties {
+				s.Properties[n] = p
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+
+		property := b.schema(field.Type)
+		if !omitempty {
+			s.Required = append(s.Required, name)
+			switch field.Type.Kind() {
+			case reflect.Pointer, reflect.Slice, reflect.Map:
+				property = nullable(property)
+			}
+		}
+		s.Properties[name] = property
+	}
+	return s
+}
+
+// nullable marks s as nullable. References can't carry siblings in
+// OpenAPI 3.0, so they are wrapped.
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{Nullable: true, AllOf: []*Schema{s}}
+	}
+	s.Nullable = true
+	return s
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+
+	"musiq/config"
+	"musiq/handlers"
+	"musiq/metrics"
+	"musiq/middleware"
+	"musiq/services"
+	"musiq/web"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter registers the routes of the web UI, the API and the
+// operational endpoints, with their middlewares. Handlers must have been
+// configured with svc.
+func newRouter(cfg *config.Config, svc *services.Services) (*gin.Engine, error) {
+	gin.SetMode(cfg.Server.GinMode)
+	r := gin.New()
+
+	// Route on the raw path so URL-encoded YouTube links fit in a single
+	// :id segment
+	r.UseRawPath = true
+
+	// Only trusted proxies may name the client in X-Forwarded-For, so
+	// clients can't dodge rate limits by claiming another address
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	limits := middleware.NewRateLimiter(cfg.RateLimit)
+	authn := middleware.NewAuth(svc.APIKeys)
+
+	// Tag requests with an ID and log them, recovering from panics, then
+	// record request metrics and apply CORS middleware
+	r.Use(middleware.RequestID(), middleware.Logger(), middleware.Recovery())
+	r.Use(middleware.Metrics())
+	r.Use(middleware.CORS(cfg.CORS))
+
+	// Liveness and readiness, and Prometheus metrics for admin keys. Failed
+	// authentications spend the API budget of the client's address, so
+	// keys can't be guessed at full speed.
+	r.GET("/metrics", limits.FailedAuth(), authn.Authenticate(), authn.Require(services.ScopeAdmin), gin.WrapH(metrics.Handler()))
+	r.GET("/healthz", handlers.Healthz)
+	r.GET("/readyz", handlers.Readyz)
+
+	// Serve static files
+	r.Static("/static", "./web/static")
+
+	// UI routes (templ-rendered HTML). With API keys required, the home
+	// page can be opened with ?key= to authenticate the rest of the UI.
+	r.GET("/", limits.FailedAuth(), authn.AuthenticateWithQuery(), limits.API(), authn.Require(services.ScopeSearch), authn.RememberAPIKey(), web.HomePage)
+	ui := r.Group("/ui", limits.FailedAuth(), authn.Authenticate(), limits.API(), authn.Require(services.ScopeSearch))
+	{
+		ui.GET("/search", web.SearchResultsView)
+		ui.GET("/suggest", web.SuggestView)
+		ui.GET("/play/:id", web.PlayerView)
+		ui.GET("/playlists", web.PlaylistSearchView)
+		ui.GET("/playlist/:id", web.PlaylistVideosView)
+	}
+
+	// API routes, served under /api/v1 and, for existing clients, /api. A
+	// route's scope picks its API key check and rate limit budget. Media
+	// routes, loaded by HTML elements that can't set headers, also take the
+	// key from the query.
+	authenticate, authenticateMedia := authn.Authenticate(), authn.AuthenticateWithQuery()
+	chains := map[string][]gin.HandlerFunc{
+		"":                   {limits.API()},
+		services.ScopeSearch: {limits.API(), authn.Require(services.ScopeSearch)},
+		services.ScopeStream: {limits.Streams(), authn.RequireMedia()},
+		services.ScopeAdmin:  {limits.API(), authn.Require(services.ScopeAdmin)},
+	}
+	for _, prefix := range []string{handlers.APIBasePath, handlers.LegacyAPIBasePath} {
+		api := r.Group(prefix, limits.FailedAuth())
+		for _, route := range handlers.APIRoutes() {
+			auth := authenticate
+			if len(route.MediaTypes) > 0 {
+				auth = authenticateMedia
+			}
+			handler := route.Handler
+			if prefix == handlers.LegacyAPIBasePath && route.LegacyHandler != nil {
+				handler = route.LegacyHandler
+			}
+			api.Handle(route.Method, route.Path, slices.Concat([]gin.HandlerFunc{auth}, chains[route.Scope], []gin.HandlerFunc{handler})...)
+		}
+	}
+
+	// OpenAPI document and its docs page
+	r.GET(handlers.OpenAPIPath, limits.API(), handlers.OpenAPI)
+	r.StaticFile(handlers.DocsPath, "./web/static/docs.html")
+
+	return r, nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"musiq/config"
+	"musiq/handlers"
+	"musiq/internal/fakeyoutube"
+	"musiq/middleware"
+	"musiq/models"
+	"musiq/openapi"
+	"musiq/services"
+	"musiq/web"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminKey is the API key of the test server, which grants every scope
+const adminKey = "adminadminadmin1234"
+
+// fakeFFmpeg lists the encoders the server needs and swallows its input
+const fakeFFmpeg = `#!/bin/sh
+if [ "$2" = "-encoders" ]; then
+cat <<'EOF'
+Encoders:
+ A..... = Audio
+ ------
+ V....D libwebp     libwebp WebP image
+ A....D aac         AAC (Advanced Audio Coding)
+ A....D libmp3lame  libmp3lame MP3
+EOF
+exit 0
+fi
+cat >/dev/null
+`
+
+// sampleRequests are the requests made to each JSON API route, relative
+// to the API base path. The IDs and queries are those fakeyoutube knows.
+var sampleRequests = map[string]string{
+	"":                    "",
+	"/search/:q":          "/search/lofi",
+	"/suggest":            "/suggest?q=lo",
+	"/music/search":       "/music/search?q=daft+punk",
+	"/info/:id":           "/info/dQw4w9WgXcQ",
+	"/getvideo/:id":       "/getvideo/dQw4w9WgXcQ",
+	"/related/:id":        "/related/dQw4w9WgXcQ",
+	"/playlist/search/:q": "/playlist/search/synthwave",
+	"/getplaylist/:id":    "/getplaylist/PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+	"/stats":              "/stats",
+	"/admin/keys":         "/admin/keys",
+}
+
+// testDir holds the test server's files, removed after the tests
+var testDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "musiq-router-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testRouter is built once, since the handlers are configured through
+// package variables
+var testRouter = sync.OnceValues(func() (*gin.Engine, error) {
+	dir := testDir
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffmpegPath, []byte(fakeFFmpeg), 0o755); err != nil {
+		return nil, err
+	}
+	keysFile := filepath.Join(dir, "keys.yaml")
+	keys := "keys:\n  - name: admin\n    key: " + adminKey + "\n    scopes: [admin]\n"
+	if err := os.WriteFile(keysFile, []byte(keys), 0o600); err != nil {
+		return nil, err
+	}
+	upstream := httptest.NewServer(fakeyoutube.New("services/testdata"))
+
+	cfg := config.Default()
+	cfg.Server.GinMode = gin.TestMode
+	cfg.FFmpeg.Path = ffmpegPath
+	cfg.FFmpeg.TempDir = dir
+	cfg.Thumbnails.CacheDir = filepath.Join(dir, "thumbnails")
+	cfg.YouTube.BaseURL = upstream.URL
+	cfg.YouTube.RetryBackoff = 0
+	cfg.YouTube.SuggestBaseURL = upstream.URL
+	cfg.Auth.KeysFile = keysFile
+
+	svc, err := services.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	handlers.Configure(svc)
+	web.Configure(svc)
+	return newRouter(cfg, svc)
+})
+
+// serve sends an authenticated GET request for path to the test router
+func serve(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	r, err := testRouter()
+	if err != nil {
+		t.Fatalf("failed to build the router: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(middleware.APIKeyHeader, adminKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// openAPIDocument fetches the document the router serves
+func openAPIDocument(t *testing.T) *openapi.Document {
+	t.Helper()
+	w := serve(t, handlers.OpenAPIPath)
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode the OpenAPI document: %v", err)
+	}
+	return &doc
+}
+
+// TestAPIRoutesDocumented checks that the document describes exactly the
+// routes registered under the API base path, and that each is served under
+// the unversioned path too
+func TestAPIRoutesDocumented(t *testing.T) {
+	r, err := testRouter()
+	if err != nil {
+		t.Fatalf("failed to build the router: %v", err)
+	}
+	doc := openAPIDocument(t)
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	var served []string
+	for _, route := range r.Routes() {
+		path, ok := strings.CutPrefix(route.Path, handlers.APIBasePath)
+		if !ok || (path != "" && !strings.HasPrefix(path, "/")) {
+			continue
+		}
+		served = append(served, strings.ToLower(route.Method)+" "+openapi.Path(path))
+		if !registered[route.Method+" "+handlers.LegacyAPIBasePath+path] {
+			t.Errorf("%s %s isn't served under %s", route.Method, route.Path, handlers.LegacyAPIBasePath)
+		}
+	}
+
+	var documented []string
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	for _, route := range served {
+		if !slices.Contains(documented, route) {
+			t.Errorf("registered route %s isn't documented", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(served, route) {
+			t.Errorf("documented route %s isn't registered", route)
+		}
+	}
+}
+
+// TestAPIResponsesMatchSchemas checks the JSON body of every API route
+// against the schema the document gives for it
+func TestAPIResponsesMatchSchemas(t *testing.T) {
+	doc := openAPIDocument(t)
+
+	for _, route := range handlers.APIRoutes() {
+		if route.Response == nil {
+			continue
+		}
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			sample, ok := sampleRequests[route.Path]
+			if !ok {
+				t.Fatalf("no sample request for %s", route.Path)
+			}
+
+			w := serve(t, handlers.APIBasePath+sample)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+				t.Fatalf("Content-Type = %q, want application/json", contentType)
+			}
+
+			operation := doc.Paths[openapi.Path(route.Path)][strings.ToLower(route.Method)]
+			if operation == nil {
+				t.Fatalf("%s isn't documented", route.Path)
+			}
+			var body any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+			schema := operation.Responses["200"].Content["application/json"].Schema
+			for _, mismatch := range validate(doc, "$", body, schema) {
+				t.Error(mismatch)
+			}
+		})
+	}
+}
+
+// TestLegacyRoot checks that the unversioned API keeps its root response
+func TestLegacyRoot(t *testing.T) {
+	w := serve(t, handlers.LegacyAPIBasePath)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	decoder := json.NewDecoder(w.Body)
+	decoder.DisallowUnknownFields()
+	var response models.LegacyRootResponse
+	if err := decoder.Decode(&response); err != nil {
+		t.Fatalf("response doesn't have the legacy shape: %v", err)
+	}
+	if response.Routes.SearchRoute != "/api/search/:q" || response.Routes.PlaylistRouteByID != "/api/getplaylist/:id" {
+		t.Errorf("routes = %+v", response.Routes)
+	}
+}
+
+// TestSuggestFromUpstream checks that completions come from the configured
+// suggest server
+func TestSuggestFromUpstream(t *testing.T) {
+	w := serve(t, handlers.APIBasePath+"/suggest?q=lofi")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var response models.SuggestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	if !slices.Contains(response.Suggestions, "lofi mix") {
+		t.Errorf("suggestions = %q, want the upstream's completions", response.Suggestions)
+	}
+}
+
+// TestSearchHistory checks that only submitted searches are completed from
+// the history
+func TestSearchHistory(t *testing.T) {
+	serve(t, handlers.APIBasePath+"/search/synth%20pop?submit=1")
+	serve(t, handlers.APIBasePath+"/search/synth%20po")
+
+	w := serve(t, handlers.APIBasePath+"/suggest?q=synth")
+	var response models.SuggestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	if !slices.Contains(response.Suggestions, "synth pop") {
+		t.Errorf("suggestions = %q, want the submitted search", response.Suggestions)
+	}
+	if slices.Contains(response.Suggestions, "synth po") {
+		t.Errorf("suggestions = %q, want no unsubmitted search", response.Suggestions)
+	}
+}
+
+// validate checks a decoded JSON value against schema and returns where
+// they don't match
+func validate(doc *openapi.Document, path string, value any, schema *openapi.Schema) []string {
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		component, ok := doc.Components.Schemas[name]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, schema.Ref)}
+		}
+		return validate(doc, path, value, component)
+	}
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return []string{path + ": null isn't allowed"}
+	}
+
+	var mismatches []string
+	for _, s := range schema.AllOf {
+		mismatches = append(mismatches, validate(doc, path, value, s)...)
+	}
+
+	mismatch := func(format string, args ...any) []string {
+		return append(mismatches, path+": "+fmt.Sprintf(format, args...))
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return mismatch("%T isn't an object", value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				mismatches = mismatch("missing required %s", name)
+			}
+		}
+		for name, v := range object {
+			property := schema.Properties[name]
+			if property == nil {
+				property = schema.AdditionalProperties
+			}
+			if property == nil {
+				mismatches = mismatch("undocumented property %s", name)
+				continue
+			}
+			mismatches = append(mismatches, validate(doc, path+"."+name, v, property)...)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return mismatch("%T isn't an array", value)
+		}
+		for i, item := range items {
+			mismatches = append(mismatches, validate(doc, fmt.Sprintf("%s[%d]", path, i), item, schema.Items)...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return mismatch("%T isn't a string", value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				mismatches = mismatch("%q isn't a date-time", s)
+			}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			mismatches = mismatch("%q isn't one of %q", s, schema.Enum)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return mismatch("%v isn't an integer", value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return mismatch("%T isn't a number", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch("%T isn't a boolean", value)
+		}
+	}
+	return mismatches
+}
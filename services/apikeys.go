@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"musiq/models"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Scopes an API key can be granted. Admin keys may do everything.
+const (
+	ScopeSearch   = "search"
+	ScopeStream   = "stream"
+	ScopeDownload = "download"
+	ScopeAdmin    = "admin"
+)
+
+// Scopes lists every scope a key file can grant
+var Scopes = []string{ScopeSearch, ScopeStream, ScopeDownload, ScopeAdmin}
+
+// minAPIKeyLength keeps guessable keys out of key files
+const minAPIKeyLength = 16
+
+// apiKeyReloadInterval is how often the key file is checked for changes
+const apiKeyReloadInterval = 10 * time.Second
+
+// APIKeyStore holds the API keys of a key file and counts what they are
+// used for. Keys are looked up by their SHA-256 digest, so files may hold
+// digests instead of the keys themselves.
+type APIKeyStore struct {
+	path  string
+	since time.Time
+
+	mu      sync.RWMutex
+	keys    map[[sha256.Size]byte]*APIKey
+	modTime time.Time
+	// usage is kept by key name, so counters survive reloads
+	usage map[string]*apiKeyUsage
+}
+
+// APIKey is a key of the store with the scopes it grants
+type APIKey struct {
+	Name   string
+	Scopes []string
+	usage  *apiKeyUsage
+}
+
+type apiKeyUsage struct {
+	requests atomic.Int64
+	bytes    atomic.Int64
+	// lastUsed is in Unix nanoseconds, zero when never used
+	lastUsed atomic.Int64
+}
+
+// apiKeyFile is the format of key files:
+//
+//	keys:
+//	  - name: partner
+//	    key: 0f3a...
+//	    scopes: [search, stream]
+//	  - name: ops
+//	    sha256: 9c1e...
+//	    scopes: [admin]
+type apiKeyFile struct {
+	Keys []struct {
+		Name   string   `yaml:"name"`
+		Key    string   `yaml:"key"`
+		SHA256 string   `yaml:"sha256"`
+		Scopes []string `yaml:"scopes"`
+	} `yaml:"keys"`
+}
+
+// NewAPIKeyStore loads the keys of the YAML file at path
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		path:  path,
+		since: time.Now(),
+		usage: make(map[string]*apiKeyUsage),
+	}
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Watch reloads the key file in the background every interval once it
+// changed. A file that fails to load leaves the current keys in place.
+func (s *APIKeyStore) Watch(interval time.Duration) {
+	s.mu.RLock()
+	checked := s.modTime
+	s.mu.RUnlock()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			info, err := os.Stat(s.path)
+			if err != nil {
+				slog.Error("Failed to check API key file", "error", err)
+				continue
+			}
+			// A broken file is reported once, not until it is fixed
+			if info.ModTime().Equal(checked) {
+				continue
+			}
+			checked = info.ModTime()
+
+			if err := s.Load(); err != nil {
+				slog.Error("Failed to reload API keys", "error", err)
+				continue
+			}
+			slog.Info("Reloaded API keys", "path", s.path)
+		}
+	}()
+}
+
+// Load reads the key file, replacing the current keys. Every problem in
+// the file is reported at once.
+func (s *APIKeyStore) Load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+	var file apiKeyFile
+	if err := yaml.UnmarshalWithOptions(data, &file, yaml.Strict()); err != nil {
+		return fmt.Errorf("failed to parse API key file %s: %w", s.path, err)
+	}
+
+	var errs []error
+	keys := make(map[[sha256.Size]byte]*APIKey, len(file.Keys))
+	names := make(map[string]bool, len(file.Keys))
+	for i, entry := range file.Keys {
+		field := fmt.Sprintf("keys[%d]", i)
+		if entry.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name must be set", field))
+		} else if names[entry.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name %q", field, entry.Name))
+		}
+		names[entry.Name] = true
+
+		digest, err := apiKeyDigest(entry.Key, entry.SHA256)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		} else if _, ok := keys[digest]; ok {
+			errs = append(errs, fmt.Errorf("%s: key is also used by another entry", field))
+		}
+
+		if len(entry.Scopes) == 0 {
+			errs = append(errs, fmt.Errorf("%s: scopes must not be empty", field))
+		}
+		for _, scope := range entry.Scopes {
+			if !slices.Contains(Scopes, scope) {
+				errs = append(errs, fmt.Errorf("%s: unknown scope %q", field, scope))
+			}
+		}
+
+		keys[digest] = &APIKey{Name: entry.Name, Scopes: entry.Scopes}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid API key file %s:\n%w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if s.usage[key.Name] == nil {
+			s.usage[key.Name] = &apiKeyUsage{}
+		}
+		key.usage = s.usage[key.Name]
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// apiKeyDigest returns the SHA-256 digest of a key file entry, which names
+// either the key or its hex-encoded digest
+func apiKeyDigest(key, digest string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	switch {
+	case key != "" && digest != "":
+		return sum, errors.New("only one of key and sha256 may be set")
+	case key != "":
+		if len(key) < minAPIKeyLength {
+			return sum, fmt.Errorf("key must be at least %d characters", minAPIKeyLength)
+		}
+		return sha256.Sum256([]byte(key)), nil
+	case digest != "":
+		decoded, err := hex.DecodeString(digest)
+		if err != nil || len(decoded) != sha256.Size {
+			return sum, errors.New("sha256 must be a hex-encoded SHA-256 digest")
+		}
+		copy(sum[:], decoded)
+		return sum, nil
+	default:
+		return sum, errors.New("key or sha256 must be set")
+	}
+}
+
+// Lookup returns the key matching secret
+func (s *APIKeyStore) Lookup(secret string) (*APIKey, bool) {
+	digest := sha256.Sum256([]byte(secret))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[digest]
+	return key, ok
+}
+
+// Usage reports the requests and bytes served for each key since the
+// server started
+func (s *APIKeyStore) Usage() models.APIKeysResponse {
+	s.mu.RLock()
+	keys := make([]models.APIKeyUsage, 0, len(s.keys))
+	for _, key := range s.keys {
+		usage := models.APIKeyUsage{
+			Name:     key.Name,
+			Scopes:   key.Scopes,
+			Requests: key.usage.requests.Load(),
+			Bytes:    key.usage.bytes.Load(),
+		}
+		if nanos := key.usage.lastUsed.Load(); nanos != 0 {
+			lastUsed := time.Unix(0, nanos)
+			usage.LastUsed = &lastUsed
+		}
+		keys = append(keys, usage)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return models.APIKeysResponse{Since: s.since, Keys: keys}
+}
+
+// Allows reports whether the key grants scope
+func (k *APIKey) Allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// Record counts a request made with the key and the bytes served to it
+func (k *APIKey) Record(bytes int64) {
+	k.usage.requests.Add(1)
+	k.usage.bytes.Add(bytes)
+	k.usage.lastUsed.Store(time.Now().UnixNano())
+}
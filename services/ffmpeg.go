@@ -1,35 +1,84 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+
+	"musiq/config"
+	"musiq/logging"
+	"musiq/metrics"
 
 	"github.com/google/uuid"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
+// fifoOpenInterval is how often opening a FIFO is retried while ffmpeg
+// hasn't opened it yet
+const fifoOpenInterval = 10 * time.Millisecond
+
+// ErrShuttingDown is returned for conversions requested after Shutdown
+var ErrShuttingDown = errors.New("server is shutting down")
+
 // FFmpegService handles audio/video conversion
-type FFmpegService struct{}
+type FFmpegService struct {
+	path          string
+	audioCodec    string
+	audioQuality  string
+	muxAudioCodec string
+	tempDir       string
+
+	// procs are the running ffmpeg processes, tracked so Shutdown can
+	// terminate them
+	mu       sync.Mutex
+	procs    map[*exec.Cmd]ffmpegProcess
+	shutdown bool
+}
 
 // NewFFmpegService creates a new FFmpeg service
-func NewFFmpegService() *FFmpegService {
-	return &FFmpegService{}
+func NewFFmpegService(cfg config.FFmpeg) *FFmpegService {
+	// Commands are logged with their request when they start instead
+	ffmpeg.LogCompiledCommand = false
+
+	return &FFmpegService{
+		path:          cfg.Path,
+		audioCodec:    cfg.AudioCodec,
+		audioQuality:  cfg.AudioQuality,
+		muxAudioCodec: cfg.MuxAudioCodec,
+		tempDir:       cfg.TempDir,
+		procs:         make(map[*exec.Cmd]ffmpegProcess),
+	}
 }
 
-// ConvertToMP3 converts an audio stream to MP3 format
-func (s *FFmpegService) ConvertToMP3(input io.Reader, output io.Writer) error {
-	err := ffmpeg.Input("pipe:0").
+// ConvertToMP3 converts an audio stream to MP3 format. ctx carries the
+// request logger, as it does for the other conversions.
+func (s *FFmpegService) ConvertToMP3(ctx context.Context, input io.Reader, output io.Writer) error {
+	err := s.run(ctx, "mp3", ffmpeg.Input("pipe:0").
 		Output("pipe:1", ffmpeg.KwArgs{
-			"acodec": "libmp3lame",
-			"q:a":    "0",
+			"acodec": s.audioCodec,
+			"q:a":    s.audioQuality,
 			"f":      "mp3",
 		}).
 		WithInput(input).
-		WithOutput(output, os.Stderr).
-		Run()
+		WithOutput(output).
+		SetFfmpegPath(s.path).
+		Compile())
 
 	if err != nil {
 		return fmt.Errorf("ffmpeg conversion failed: %w", err)
@@ -38,11 +87,39 @@ func (s *FFmpegService) ConvertToMP3(input io.Reader, output io.Writer) error {
 	return nil
 }
 
+// EncodeWebP encodes an image as WebP. Go has no WebP encoder, so the image
+// is piped through FFmpeg as PNG.
+func (s *FFmpegService) EncodeWebP(ctx context.Context, img image.Image) ([]byte, error) {
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	var output bytes.Buffer
+	err := s.run(ctx, "webp", ffmpeg.Input("pipe:0", ffmpeg.KwArgs{"f": "png_pipe"}).
+		Output("pipe:1", ffmpeg.KwArgs{
+			"c:v":      "libwebp",
+			"quality":  "80",
+			"f":        "webp",
+			"loglevel": "error",
+		}).
+		WithInput(&input).
+		WithOutput(&output).
+		SetFfmpegPath(s.path).
+		Compile())
+
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg webp encoding failed: %w", err)
+	}
+
+	return output.Bytes(), nil
+}
+
 // MuxVideoAudio muxes separate video and audio streams into MP4
 // This uses os/exec directly for better control over multiple input pipes
-func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output io.Writer) error {
+func (s *FFmpegService) MuxVideoAudio(ctx context.Context, videoStream, audioStream io.Reader, output io.Writer) error {
 	// Find ffmpeg path
-	ffmpegPath, err := exec.LookPath("ffmpeg")
+	ffmpegPath, err := exec.LookPath(s.path)
 	if err != nil {
 		return fmt.Errorf("ffmpeg not found in PATH: %w", err)
 	}
@@ -54,7 +131,7 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 		"-map", "0:v", // Map video from first input
 		"-map", "1:a", // Map audio from second input
 		"-c:v", "copy", // Copy video codec (no re-encoding)
-		"-c:a", "aac", // Convert audio to AAC for mobile compatibility
+		"-c:a", s.muxAudioCodec, // AAC by default, for mobile compatibility
 		"-movflags", "frag_keyframe+empty_moov", // Fragmented MP4 for streaming
 		"-f", "mp4", // Output format
 		"-loglevel", "error",
@@ -87,7 +164,6 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 
 	cmd.ExtraFiles = []*os.File{videoReader, audioReader}
 	cmd.Stdout = output.(io.Writer)
-	cmd.Stderr = os.Stderr
 
 	// Update command to use fd 3 and 4
 	cmd.Args = []string{
@@ -97,7 +173,7 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 		"-map", "0:v",
 		"-map", "1:a",
 		"-c:v", "copy",
-		"-c:a", "aac",
+		"-c:a", s.muxAudioCodec,
 		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
 		"-f", "mp4",
 		"-loglevel", "warning",
@@ -105,7 +181,7 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 	}
 
 	// Start the command
-	if err := cmd.Start(); err != nil {
+	if err := s.start(ctx, "mux", cmd); err != nil {
 		videoWriter.Close()
 		audioWriter.Close()
 		return fmt.Errorf("failed to start ffmpeg: %w", err)
@@ -139,7 +215,7 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 	}
 
 	// Wait for ffmpeg to finish
-	if err := cmd.Wait(); err != nil {
+	if err := s.wait(cmd); err != nil {
 		return fmt.Errorf("ffmpeg failed: %w", err)
 	}
 
@@ -148,16 +224,16 @@ func (s *FFmpegService) MuxVideoAudio(videoStream, audioStream io.Reader, output
 
 // MuxVideoAudioStream uses named pipes (FIFOs) for progressive streaming
 // This allows the browser to start playing while data is still being downloaded
-func (s *FFmpegService) MuxVideoAudioStream(videoStream, audioStream io.Reader, output io.Writer) error {
-	ffmpegPath, err := exec.LookPath("ffmpeg")
+func (s *FFmpegService) MuxVideoAudioStream(ctx context.Context, videoStream, audioStream io.Reader, output io.Writer) error {
+	ffmpegPath, err := exec.LookPath(s.path)
 	if err != nil {
 		return fmt.Errorf("ffmpeg not found: %w", err)
 	}
 
 	// Create unique FIFO paths
 	id := uuid.New().String()[:8]
-	videoFifo := fmt.Sprintf("/tmp/video_%s.fifo", id)
-	audioFifo := fmt.Sprintf("/tmp/audio_%s.fifo", id)
+	videoFifo := filepath.Join(s.tempDir, tempFilePrefix()+"video-"+id+".fifo")
+	audioFifo := filepath.Join(s.tempDir, tempFilePrefix()+"audio-"+id+".fifo")
 
 	// Create FIFOs
 	if err := syscall.Mkfifo(videoFifo, 0600); err != nil {
@@ -176,7 +252,7 @@ func (s *FFmpegService) MuxVideoAudioStream(videoStream, audioStream io.Reader,
 		"-i", videoFifo,
 		"-i", audioFifo,
 		"-c:v", "copy", // Copy H.264 video (no re-encoding needed)
-		"-c:a", "aac",
+		"-c:a", s.muxAudioCodec,
 		"-movflags", "frag_keyframe+empty_moov+default_base_moof", // Critical for streaming
 		"-frag_duration", "1000000", // 1 second fragments for faster start
 		"-f", "mp4",
@@ -184,19 +260,27 @@ func (s *FFmpegService) MuxVideoAudioStream(videoStream, audioStream io.Reader,
 		"-",
 	)
 	cmd.Stdout = output
-	cmd.Stderr = os.Stderr
 
 	// Start ffmpeg (it will block waiting for FIFO input)
-	if err := cmd.Start(); err != nil {
+	if err := s.start(ctx, "mux_fifo", cmd); err != nil {
 		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
 
+	// Wait for ffmpeg in the background, so writers stop waiting for it to
+	// open the FIFOs if it exits first, such as when killed on shutdown
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = s.wait(cmd)
+		close(exited)
+	}()
+
 	// Channel to collect errors from goroutines
 	errChan := make(chan error, 2)
 
 	// Write video stream to FIFO in goroutine
 	go func() {
-		f, err := os.OpenFile(videoFifo, os.O_WRONLY, 0)
+		f, err := openFifo(videoFifo, exited)
 		if err != nil {
 			errChan <- fmt.Errorf("failed to open video fifo: %w", err)
 			return
@@ -208,7 +292,7 @@ func (s *FFmpegService) MuxVideoAudioStream(videoStream, audioStream io.Reader,
 
 	// Write audio stream to FIFO in goroutine
 	go func() {
-		f, err := os.OpenFile(audioFifo, os.O_WRONLY, 0)
+		f, err := openFifo(audioFifo, exited)
 		if err != nil {
 			errChan <- fmt.Errorf("failed to open audio fifo: %w", err)
 			return
@@ -227,33 +311,55 @@ func (s *FFmpegService) MuxVideoAudioStream(videoStream, audioStream io.Reader,
 	}
 
 	// Wait for ffmpeg to finish
-	if err := cmd.Wait(); err != nil {
+	<-exited
+	if waitErr != nil {
 		// Ignore broken pipe errors (client closed connection)
 		if writeErr == nil {
-			return fmt.Errorf("ffmpeg failed: %w", err)
+			return fmt.Errorf("ffmpeg failed: %w", waitErr)
 		}
 	}
 
 	return writeErr
 }
 
+// openFifo opens a FIFO for writing once ffmpeg opens it for reading. A
+// blocking open would hang forever if ffmpeg exits first, so the open is
+// non-blocking and retried until exited is closed.
+func openFifo(path string, exited <-chan struct{}) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+
+		select {
+		case <-exited:
+			return nil, errors.New("ffmpeg exited before reading its input")
+		case <-time.After(fifoOpenInterval):
+		}
+	}
+}
+
 // MuxVideoAudioSimple is a simpler version that creates temporary files
 // Use this if the pipe-based version has issues
-func (s *FFmpegService) MuxVideoAudioSimple(videoStream, audioStream io.Reader, output io.Writer) error {
+func (s *FFmpegService) MuxVideoAudioSimple(ctx context.Context, videoStream, audioStream io.Reader, output io.Writer) error {
 	// Create temporary files for video and audio
-	videoTmp, err := os.CreateTemp("", "video-*.mp4")
+	videoTmp, err := os.CreateTemp(s.tempDir, tempFilePrefix()+"video-*.mp4")
 	if err != nil {
 		return fmt.Errorf("failed to create temp video file: %w", err)
 	}
 	defer os.Remove(videoTmp.Name())
 
-	audioTmp, err := os.CreateTemp("", "audio-*.m4a")
+	audioTmp, err := os.CreateTemp(s.tempDir, tempFilePrefix()+"audio-*.m4a")
 	if err != nil {
 		return fmt.Errorf("failed to create temp audio file: %w", err)
 	}
 	defer os.Remove(audioTmp.Name())
 
-	outputTmp, err := os.CreateTemp("", "output-*.mp4")
+	outputTmp, err := os.CreateTemp(s.tempDir, tempFilePrefix()+"output-*.mp4")
 	if err != nil {
 		return fmt.Errorf("failed to create temp output file: %w", err)
 	}
@@ -273,7 +379,7 @@ func (s *FFmpegService) MuxVideoAudioSimple(videoStream, audioStream io.Reader,
 	audioTmp.Close()
 
 	// Find ffmpeg path
-	ffmpegPath, err := exec.LookPath("ffmpeg")
+	ffmpegPath, err := exec.LookPath(s.path)
 	if err != nil {
 		return fmt.Errorf("ffmpeg not found: %w", err)
 	}
@@ -285,14 +391,13 @@ func (s *FFmpegService) MuxVideoAudioSimple(videoStream, audioStream io.Reader,
 		"-map", "0:v",
 		"-map", "1:a",
 		"-c:v", "copy",
-		"-c:a", "aac",
+		"-c:a", s.muxAudioCodec,
 		"-movflags", "frag_keyframe+empty_moov",
 		"-y",
 		outputTmp.Name(),
 	)
-	cmd.Stderr = os.Stderr
 
-	if err := cmd.Run(); err != nil {
+	if err := s.run(ctx, "mux_file", cmd); err != nil {
 		return fmt.Errorf("ffmpeg muxing failed: %w", err)
 	}
 
@@ -307,11 +412,238 @@ func (s *FFmpegService) MuxVideoAudioSimple(videoStream, audioStream io.Reader,
 	return err
 }
 
-// CheckFFmpegInstalled verifies FFmpeg is available
-func CheckFFmpegInstalled() error {
-	_, err := exec.LookPath("ffmpeg")
+// ffmpegProcess describes a running ffmpeg process for metrics and logs
+type ffmpegProcess struct {
+	operation string
+	started   time.Time
+	logger    *slog.Logger
+	stderr    *stderrTail
+}
+
+// start starts an ffmpeg process for an operation, such as "mp3", and
+// tracks it until wait is called. Its stderr is kept for the exit log line,
+// which goes to the logger of ctx.
+func (s *FFmpegService) start(ctx context.Context, operation string, cmd *exec.Cmd) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown {
+		return ErrShuttingDown
+	}
+	stderr := &stderrTail{}
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = childProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx).With("operation", operation, "pid", cmd.Process.Pid)
+	logger.Debug("FFmpeg started", "args", strings.Join(cmd.Args[1:], " "))
+	s.procs[cmd] = ffmpegProcess{operation: operation, started: time.Now(), logger: logger, stderr: stderr}
+	metrics.FFmpegStarted(operation)
+	return nil
+}
+
+// wait waits for a process started with start to exit
+func (s *FFmpegService) wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	s.mu.Lock()
+	proc := s.procs[cmd]
+	delete(s.procs, cmd)
+	s.mu.Unlock()
+
+	duration := time.Since(proc.started)
+	exitCode := cmd.ProcessState.ExitCode()
+	metrics.FFmpegExited(proc.operation, exitCode, duration)
+
+	args := []any{"exitCode", exitCode, "durationMs", duration.Milliseconds()}
+	if stderr := proc.stderr.String(); stderr != "" {
+		args = append(args, "stderr", stderr)
+	}
+	if err != nil {
+		proc.logger.Warn("FFmpeg failed", append(args, "error", err)...)
+	} else {
+		proc.logger.Debug("FFmpeg finished", args...)
+	}
+	return err
+}
+
+func (s *FFmpegService) run(ctx context.Context, operation string, cmd *exec.Cmd) error {
+	if err := s.start(ctx, operation, cmd); err != nil {
+		return err
+	}
+	return s.wait(cmd)
+}
+
+// Shutdown refuses new conversions and terminates running ffmpeg processes:
+// SIGTERM first, so they can exit cleanly, then SIGKILL for those still
+// running when ctx is done
+func (s *FFmpegService) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	s.shutdown = true
+	for cmd := range s.procs {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		running := len(s.procs)
+		if running == 0 {
+			s.mu.Unlock()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			slog.Warn("Killing ffmpeg processes", "count", running)
+			for cmd := range s.procs {
+				cmd.Process.Kill()
+			}
+			s.mu.Unlock()
+			return
+		default:
+		}
+		s.mu.Unlock()
+		<-ticker.C
+	}
+}
+
+// maxStderrTail is how much of an ffmpeg process's stderr is logged
+const maxStderrTail = 2048
+
+// stderrTail keeps the end of an ffmpeg process's stderr, which holds the
+// reason it failed
+type stderrTail struct {
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > maxStderrTail {
+		t.buf = t.buf[len(t.buf)-maxStderrTail:]
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	return strings.TrimSpace(string(t.buf))
+}
+
+// tempFilePrefix names FIFOs and temporary files after the process that
+// created them, so CleanupTempFiles can tell leftovers of a dead process
+// from files a running one still uses
+func tempFilePrefix() string {
+	return fmt.Sprintf("musiq-%d-", os.Getpid())
+}
+
+var (
+	tempFileName = regexp.MustCompile(`^musiq-(\d+)-(video|audio|output)-`)
+	// legacyFifoName matches FIFOs of versions that named them video_<id>.fifo
+	legacyFifoName = regexp.MustCompile(`^(video|audio)_[0-9a-f]{8}\.fifo$`)
+)
+
+// CleanupTempFiles removes FIFOs and temporary files left in the temp dir
+// by processes that died mid-stream. It must run before this process muxes
+// anything: files carrying its own PID are leftovers of an earlier process
+// with the same PID, as happens with PID 1 in containers.
+func (s *FFmpegService) CleanupTempFiles() (int, error) {
+	entries, err := os.ReadDir(s.tempDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read temp dir: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if match := tempFileName.FindStringSubmatch(name); match != nil {
+			pid, _ := strconv.Atoi(match[1])
+			if pid != os.Getpid() && processRunning(pid) {
+				continue
+			}
+		} else if !legacyFifoName.MatchString(name) || entry.Type()&fs.ModeNamedPipe == 0 {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.tempDir, name)); err != nil {
+			slog.Warn("Failed to remove stale temp file", "file", name, "error", err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// processRunning reports whether a process exists. EPERM means it exists
+// but belongs to another user.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// ErrWebPUnavailable is returned by CheckInstalled when FFmpeg has the audio
+// encoders but not libwebp. Streams still work; WebP thumbnails are served
+// as JPEG instead.
+var ErrWebPUnavailable error = degradedError("ffmpeg lacks the libwebp encoder, WebP thumbnails are served as JPEG")
+
+// ProbePath returns the ffprobe installed with the configured ffmpeg: the
+// one next to it when ffmpeg is a path, otherwise the one on PATH
+func (s *FFmpegService) ProbePath() string {
+	dir, name := filepath.Split(s.path)
+	probe := strings.Replace(name, "ffmpeg", "ffprobe", 1)
+	if probe == name {
+		probe = "ffprobe" + filepath.Ext(name)
+	}
+	return filepath.Join(dir, probe)
+}
+
+// CheckInstalled verifies FFmpeg is available with the encoders of the
+// configured audio codecs, and returns ErrWebPUnavailable when only libwebp
+// is missing
+func (s *FFmpegService) CheckInstalled() error {
+	path, err := exec.LookPath(s.path)
 	if err != nil {
 		return fmt.Errorf("ffmpeg not found. Please install ffmpeg and ensure it's in your PATH")
 	}
+
+	out, err := exec.Command(path, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list ffmpeg encoders: %w", err)
+	}
+	encoders := parseEncoders(out)
+
+	var missing []string
+	for _, codec := range []string{s.audioCodec, s.muxAudioCodec} {
+		if !encoders[codec] && !slices.Contains(missing, codec) {
+			missing = append(missing, codec)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("ffmpeg lacks required encoders: %s", strings.Join(missing, ", "))
+	}
+	if !encoders["libwebp"] {
+		return ErrWebPUnavailable
+	}
 	return nil
 }
+
+// parseEncoders reads the encoder names from the output of
+// ffmpeg -encoders, whose lines look like " A....D libmp3lame  description"
+// after a legend ending in " ------"
+func parseEncoders(out []byte) map[string]bool {
+	encoders := make(map[string]bool)
+	listing := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if !listing {
+			listing = len(fields) == 1 && strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders
+}
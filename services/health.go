@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"musiq/models"
+)
+
+// healthProbeTTL is how long the result of an expensive readiness check,
+// such as the upstream probe, is reused
+const healthProbeTTL = 30 * time.Second
+
+// Health checks whether the server can serve requests: FFmpeg with its
+// encoders, writable working directories and a reachable upstream
+type Health struct {
+	checks []*healthCheck
+}
+
+// healthCheck is a named readiness check. Checks with a ttl keep their
+// last result that long, so frequent readiness probes don't turn into
+// upstream traffic or process spawns.
+type healthCheck struct {
+	name  string
+	ttl   time.Duration
+	check func(ctx context.Context) error
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// NewHealth creates the readiness checks for the services. The thumbnail
+// cache is only checked when the thumbnail proxy is enabled.
+func NewHealth(s *Services, tempDir, thumbnailDir string) *Health {
+	h := &Health{}
+	h.add("ffmpeg", healthProbeTTL, func(context.Context) error {
+		err := s.FFmpeg.CheckInstalled()
+		if errors.Is(err, ErrWebPUnavailable) && s.Thumbnails == nil {
+			// Only proxied thumbnails are re-encoded
+			return nil
+		}
+		return err
+	})
+	h.add("tempDir", 0, func(context.Context) error {
+		return checkWritable(tempDir)
+	})
+	if s.Thumbnails != nil {
+		h.add("thumbnailCache", 0, func(context.Context) error {
+			return checkWritable(thumbnailDir)
+		})
+	}
+	h.add("upstream", healthProbeTTL, s.YouTube.Ping)
+	return h
+}
+
+func (h *Health) add(name string, ttl time.Duration, check func(context.Context) error) {
+	h.checks = append(h.checks, &healthCheck{name: name, ttl: ttl, check: check})
+}
+
+// degradedError is a check failure that leaves the server able to serve
+// streams with fewer features. It is reported as degraded and doesn't fail
+// readiness.
+type degradedError string
+
+func (e degradedError) Error() string { return string(e) }
+
+// Check runs every readiness check and reports whether none failed.
+// Degraded checks don't fail readiness but show in the overall status.
+func (h *Health) Check(ctx context.Context) (models.HealthResponse, bool) {
+	response := models.HealthResponse{Status: models.HealthOK}
+	ready := true
+
+	results := make([]models.HealthCheck, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		switch {
+		case result.Status == models.HealthUnavailable:
+			response.Status = models.HealthUnavailable
+			ready = false
+		case result.Status == models.HealthDegraded && ready:
+			response.Status = models.HealthDegraded
+		}
+	}
+	response.Checks = results
+	return response, ready
+}
+
+// run returns the check's cached result while it is fresh, and runs it
+// otherwise. Concurrent callers wait for a single run.
+func (c *healthCheck) run(ctx context.Context) models.HealthCheck {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checked.IsZero() || time.Since(c.checked) >= c.ttl {
+		// A probe abandoned by its caller must not be cached as a failure
+		c.err = c.check(context.WithoutCancel(ctx))
+		c.checked = time.Now()
+	}
+
+	result := models.HealthCheck{Name: c.name, Status: models.HealthOK, CheckedAt: c.checked}
+	var degraded degradedError
+	switch {
+	case errors.As(c.err, &degraded):
+		result.Status = models.HealthDegraded
+		result.Message = c.err.Error()
+	case c.err != nil:
+		result.Status = models.HealthUnavailable
+		result.Message = c.err.Error()
+	}
+	return result
+}
+
+// checkWritable verifies that files can be created in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".musiq-health-*")
+	if err != nil {
+		return fmt.Errorf("directory not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Ping checks that the YouTube frontend answers, using its generate_204
+// connectivity endpoint. Any response below 500 counts, since a rate
+// limited upstream is still reachable.
+func (s *YouTubeService) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.web.baseURL+"/generate_204", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", s.web.userAgent)
+
+	resp, err := s.web.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach YouTube: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("YouTube returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"musiq/config"
+	"musiq/models"
+)
+
+// fakeFFmpeg writes an ffmpeg stand-in that lists the given encoders
+func fakeFFmpeg(t *testing.T, encoders ...string) string {
+	t.Helper()
+	var listing strings.Builder
+	listing.WriteString("Encoders:\n A..... = Audio\n ------\n")
+	for _, encoder := range encoders {
+		listing.WriteString(" A....D " + encoder + "  description\n")
+	}
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\ncat <<'EOF'\n" + listing.String() + "EOF\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake ffmpeg: %v", err)
+	}
+	return path
+}
+
+func TestHealthFFmpegEncoders(t *testing.T) {
+	tests := []struct {
+		name       string
+		encoders   []string
+		thumbnails bool
+		// fatal means CheckInstalled fails startup
+		fatal  bool
+		status string
+		ready  bool
+	}{
+		{name: "all encoders", encoders: []string{"libmp3lame", "aac", "libwebp"}, thumbnails: true, status: models.HealthOK, ready: true},
+		{name: "no libwebp", encoders: []string{"libmp3lame", "aac"}, thumbnails: true, status: models.HealthDegraded, ready: true},
+		// Without the thumbnail proxy nothing is encoded as WebP
+		{name: "no libwebp or thumbnails", encoders: []string{"libmp3lame", "aac"}, status: models.HealthOK, ready: true},
+		{name: "no aac", encoders: []string{"libmp3lame", "libwebp"}, thumbnails: true, fatal: true, status: models.HealthUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Services{
+				YouTube: newFakeService(t),
+				FFmpeg: NewFFmpegService(config.FFmpeg{
+					Path:          fakeFFmpeg(t, tt.encoders...),
+					AudioCodec:    "libmp3lame",
+					MuxAudioCodec: "aac",
+				}),
+			}
+			if tt.thumbnails {
+				s.Thumbnails = &ThumbnailService{}
+			}
+
+			err := s.FFmpeg.CheckInstalled()
+			if fatal := err != nil && !errors.Is(err, ErrWebPUnavailable); fatal != tt.fatal {
+				t.Errorf("CheckInstalled() = %v, fatal %v, want fatal %v", err, fatal, tt.fatal)
+			}
+
+			response, ready := NewHealth(s, t.TempDir(), t.TempDir()).Check(context.Background())
+			if response.Status != tt.status || ready != tt.ready {
+				t.Errorf("Check() = %s, ready %v, want %s, ready %v", response.Status, ready, tt.status, tt.ready)
+			}
+			for _, check := range response.Checks {
+				if check.Name == "ffmpeg" && check.Status != tt.status {
+					t.Errorf("ffmpeg check = %+v, want %s", check, tt.status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"musiq/models"
+)
+
+// innertubeClient identifies an InnerTube API frontend, the client it
+// presents itself as and the transport used to reach it
+type innertubeClient struct {
+	baseURL    string
+	name       string
+	version    string
+	hl         string
+	gl         string
+	userAgent  string
+	httpClient *http.Client
+	timeout    time.Duration
+}
+
+var (
+	// webClient is the desktop YouTube frontend
+	webClient = innertubeClient{
+		baseURL: "https://www.youtube.com",
+		name:    "WEB",
+	}
+	// musicClient is the YouTube Music frontend
+	musicClient = innertubeClient{
+		baseURL: "https://music.youtube.com",
+		name:    "WEB_REMIX",
+	}
+)
+
+// innertubeContext returns the client context sent with every InnerTube request
+func (c innertubeClient) innertubeContext() map[string]interface{} {
+	return map[string]interface{}{
+		"client": map[string]interface{}{
+			"clientName":    c.name,
+			"clientVersion": c.version,
+			"hl":            c.hl,
+			"gl":            c.gl,
+		},
+	}
+}
+
+// request posts a payload to an InnerTube API endpoint (search, next, browse)
+// and decodes the JSON response into out. It is cancelled with ctx.
+func (c innertubeClient) request(ctx context.Context, endpoint string, payload map[string]interface{}, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	// Build InnerTube API request
+	apiURL := c.baseURL + "/youtubei/v1/" + endpoint + "?prettyPrint=false"
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(string(payloadBytes)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Origin", c.baseURL)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("innertube %s request failed with status %d", endpoint, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode innertube %s response: %w", endpoint, err)
+	}
+
+	return nil
+}
+
+// ParseError reports where an InnerTube response stopped matching the
+// structure we expect, so a YouTube layout change fails loudly instead of
+// returning empty results
+type ParseError struct {
+	Endpoint string
+	Path     string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unexpected innertube %s response: missing %s", e.Endpoint, e.Path)
+}
+
+// Shared InnerTube building blocks
+
+// itText is a text object: either simpleText or a list of runs
+type itText struct {
+	SimpleText string  `json:"simpleText"`
+	Runs       []itRun `json:"runs"`
+}
+
+// String returns the full text, concatenating every run
+func (t itText) String() string {
+	if t.SimpleText != "" {
+		return t.SimpleText
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// First returns the simple text or the first run, which for bylines is the
+// channel name without any trailing decoration
+func (t itText) First() string {
+	if t.SimpleText != "" {
+		return t.SimpleText
+	}
+	if len(t.Runs) > 0 {
+		return t.Runs[0].Text
+	}
+	return ""
+}
+
+type itRun struct {
+	Text               string                `json:"text"`
+	NavigationEndpoint *itNavigationEndpoint `json:"navigationEndpoint"`
+}
+
+type itNavigationEndpoint struct {
+	WatchEndpoint  *itWatchEndpoint  `json:"watchEndpoint"`
+	BrowseEndpoint *itBrowseEndpoint `json:"browseEndpoint"`
+}
+
+type itWatchEndpoint struct {
+	VideoID                            string `json:"videoId"`
+	PlaylistID                         string `json:"playlistId"`
+	WatchEndpointMusicSupportedConfigs struct {
+		WatchEndpointMusicConfig struct {
+			MusicVideoType string `json:"musicVideoType"`
+		} `json:"watchEndpointMusicConfig"`
+	} `json:"watchEndpointMusicSupportedConfigs"`
+}
+
+type itBrowseEndpoint struct {
+	BrowseID                              string `json:"browseId"`
+	BrowseEndpointContextSupportedConfigs struct {
+		BrowseEndpointContextMusicConfig struct {
+			PageType string `json:"pageType"`
+		} `json:"browseEndpointContextMusicConfig"`
+	} `json:"browseEndpointContextSupportedConfigs"`
+}
+
+// pageType returns the music page type a browse link points to, or ""
+func (e *itNavigationEndpoint) pageType() string {
+	if e == nil || e.BrowseEndpoint == nil {
+		return ""
+	}
+	return e.BrowseEndpoint.BrowseEndpointContextSupportedConfigs.BrowseEndpointContextMusicConfig.PageType
+}
+
+// browseID returns the browse ID a link points to, or ""
+func (e *itNavigationEndpoint) browseID() string {
+	if e == nil || e.BrowseEndpoint == nil {
+		return ""
+	}
+	return e.BrowseEndpoint.BrowseID
+}
+
+type itThumbnail struct {
+	Thumbnails []struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"thumbnails"`
+}
+
+// convert returns the thumbnails as API models, pointing at proxy
+func (t itThumbnail) convert(proxy thumbnailProxy) []models.Thumbnail {
+	thumbnails := make([]models.Thumbnail, 0, len(t.Thumbnails))
+	for _, thumb := range t.Thumbnails {
+		thumbnails = append(thumbnails, models.Thumbnail{
+			URL:    proxy.rewrite(thumb.URL, thumb.Width),
+			Width:  thumb.Width,
+			Height: thumb.Height,
+		})
+	}
+	return thumbnails
+}
+
+// WEB search response (youtubei/v1/search)
+
+type searchResponse struct {
+	Contents *struct {
+		TwoColumnSearchResultsRenderer *struct {
+			PrimaryContents *struct {
+				SectionListRenderer *struct {
+					Contents []struct {
+						ItemSectionRenderer *struct {
+							Contents []struct {
+								VideoRenderer *videoRenderer `json:"videoRenderer"`
+							} `json:"contents"`
+						} `json:"itemSectionRenderer"`
+					} `json:"contents"`
+				} `json:"sectionListRenderer"`
+			} `json:"primaryContents"`
+		} `json:"twoColumnSearchResultsRenderer"`
+	} `json:"contents"`
+}
+
+type videoRenderer struct {
+	VideoID           string      `json:"videoId"`
+	Title             itText      `json:"title"`
+	OwnerText         itText      `json:"ownerText"`
+	LengthText        itText      `json:"lengthText"`
+	ViewCountText     itText      `json:"viewCountText"`
+	PublishedTimeText itText      `json:"publishedTimeText"`
+	Thumbnail         itThumbnail `json:"thumbnail"`
+	Badges            []struct {
+		MetadataBadgeRenderer *struct {
+			Style string `json:"style"`
+			Label string `json:"label"`
+		} `json:"metadataBadgeRenderer"`
+	} `json:"badges"`
+	ThumbnailOverlays []struct {
+		ThumbnailOverlayTimeStatusRenderer *struct {
+			Style string `json:"style"`
+		} `json:"thumbnailOverlayTimeStatusRenderer"`
+	} `json:"thumbnailOverlays"`
+}
+
+// videoRenderers returns every video renderer in a search response
+func (r *searchResponse) videoRenderers() ([]*videoRenderer, error) {
+	missing := func(path string) error {
+		return &ParseError{Endpoint: "search", Path: path}
+	}
+
+	if r.Contents == nil {
+		return nil, missing("contents")
+	}
+	if r.Contents.TwoColumnSearchResultsRenderer == nil {
+		return nil, missing("contents.twoColumnSearchResultsRenderer")
+	}
+	if r.Contents.TwoColumnSearchResultsRenderer.PrimaryContents == nil {
+		return nil, missing("contents.twoColumnSearchResultsRenderer.primaryContents")
+	}
+	sectionList := r.Contents.TwoColumnSearchResultsRenderer.PrimaryContents.SectionListRenderer
+	if sectionList == nil {
+		return nil, missing("contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer")
+	}
+
+	renderers := make([]*videoRenderer, 0)
+	found := false
+	for _, section := range sectionList.Contents {
+		// Continuation items and ads live in other section types
+		if section.ItemSectionRenderer == nil {
+			continue
+		}
+		found = true
+		for _, item := range section.ItemSectionRenderer.Contents {
+			if item.VideoRenderer != nil && item.VideoRenderer.VideoID != "" {
+				renderers = append(renderers, item.VideoRenderer)
+			}
+		}
+	}
+	// Searches without results still have an item section holding the
+	// "No results" message, so a missing one means the layout changed
+	if !found {
+		return nil, missing("contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer.contents[].itemSectionRenderer")
+	}
+
+	return renderers, nil
+}
+
+// WEB watch-next response (youtubei/v1/next)
+
+type nextResponse struct {
+	Contents *struct {
+		TwoColumnWatchNextResults *struct {
+			Playlist *struct {
+				Playlist *playlistPanel `json:"playlist"`
+			} `json:"playlist"`
+		} `json:"twoColumnWatchNextResults"`
+	} `json:"contents"`
+}
+
+type playlistPanel struct {
+	Title     string `json:"title"`
+	OwnerName itText `json:"ownerName"`
+	Contents  []struct {
+		PlaylistPanelVideoRenderer *struct {
+			VideoID         string      `json:"videoId"`
+			Title           itText      `json:"title"`
+			ShortBylineText itText      `json:"shortBylineText"`
+			LengthText      itText      `json:"lengthText"`
+			Thumbnail       itThumbnail `json:"thumbnail"`
+		} `json:"playlistPanelVideoRenderer"`
+	} `json:"contents"`
+}
+
+// playlistPanel returns the playlist panel shown next to a video played
+// within a playlist
+func (r *nextResponse) playlistPanel() (*playlistPanel, error) {
+	missing := func(path string) error {
+		return &ParseError{Endpoint: "next", Path: path}
+	}
+
+	if r.Contents == nil {
+		return nil, missing("contents")
+	}
+	if r.Contents.TwoColumnWatchNextResults == nil {
+		return nil, missing("contents.twoColumnWatchNextResults")
+	}
+	if r.Contents.TwoColumnWatchNextResults.Playlist == nil {
+		return nil, missing("contents.twoColumnWatchNextResults.playlist")
+	}
+	if r.Contents.TwoColumnWatchNextResults.Playlist.Playlist == nil {
+		return nil, missing("contents.twoColumnWatchNextResults.playlist.playlist")
+	}
+
+	return r.Contents.TwoColumnWatchNextResults.Playlist.Playlist, nil
+}
+
+// WEB_REMIX search response (music.youtube.com youtubei/v1/search)
+
+type musicSearchResponse struct {
+	Contents *struct {
+		TabbedSearchResultsRenderer *struct {
+			Tabs []struct {
+				TabRenderer *struct {
+					Content *struct {
+						SectionListRenderer *struct {
+							Contents []struct {
+								MusicShelfRenderer *struct {
+									Contents []struct {
+										MusicResponsiveListItemRenderer *musicListItem `json:"musicResponsiveListItemRenderer"`
+									} `json:"contents"`
+								} `json:"musicShelfRenderer"`
+							} `json:"contents"`
+						} `json:"sectionListRenderer"`
+					} `json:"content"`
+				} `json:"tabRenderer"`
+			} `json:"tabs"`
+		} `json:"tabbedSearchResultsRenderer"`
+	} `json:"contents"`
+}
+
+type musicListItem struct {
+	FlexColumns []struct {
+		MusicResponsiveListItemFlexColumnRenderer struct {
+			Text itText `json:"text"`
+		} `json:"musicResponsiveListItemFlexColumnRenderer"`
+	} `json:"flexColumns"`
+	Thumbnail struct {
+		MusicThumbnailRenderer struct {
+			Thumbnail itThumbnail `json:"thumbnail"`
+		} `json:"musicThumbnailRenderer"`
+	} `json:"thumbnail"`
+	NavigationEndpoint *itNavigationEndpoint `json:"navigationEndpoint"`
+	PlaylistItemData   *struct {
+		VideoID string `json:"videoId"`
+	} `json:"playlistItemData"`
+}
+
+// listItems returns the list items of every shelf in a music search response.
+// The top result card is skipped as it duplicates an entry of the shelves
+// below it.
+func (r *musicSearchResponse) listItems() ([]*musicListItem, error) {
+	missing := func(path string) error {
+		return &ParseError{Endpoint: "music search", Path: path}
+	}
+
+	if r.Contents == nil {
+		return nil, missing("contents")
+	}
+	if r.Contents.TabbedSearchResultsRenderer == nil {
+		return nil, missing("contents.tabbedSearchResultsRenderer")
+	}
+	tabs := r.Contents.TabbedSearchResultsRenderer.Tabs
+	if len(tabs) == 0 || tabs[0].TabRenderer == nil {
+		return nil, missing("contents.tabbedSearchResultsRenderer.tabs[0].tabRenderer")
+	}
+	if tabs[0].TabRenderer.Content == nil || tabs[0].TabRenderer.Content.SectionListRenderer == nil {
+		return nil, missing("contents.tabbedSearchResultsRenderer.tabs[0].tabRenderer.content.sectionListRenderer")
+	}
+
+	items := make([]*musicListItem, 0)
+	for _, section := range tabs[0].TabRenderer.Content.SectionListRenderer.Contents {
+		if section.MusicShelfRenderer == nil {
+			continue
+		}
+		for _, item := range section.MusicShelfRenderer.Contents {
+			if item.MusicResponsiveListItemRenderer != nil {
+				items = append(items, item.MusicResponsiveListItemRenderer)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// WEB browse response for a playlist (youtubei/v1/browse with a VL browse
+// ID), and for the continuations that load the rest of its videos
+
+type browseResponse struct {
+	Header *struct {
+		PlaylistHeaderRenderer *playlistHeader `json:"playlistHeaderRenderer"`
+	} `json:"header"`
+	Contents *struct {
+		TwoColumnBrowseResultsRenderer *struct {
+			Tabs []struct {
+				TabRenderer *struct {
+					Content *struct {
+						SectionListRenderer *struct {
+							Contents []struct {
+								ItemSectionRenderer *struct {
+									Contents []struct {
+										PlaylistVideoListRenderer *struct {
+											Contents []playlistVideoItem `json:"contents"`
+										} `json:"playlistVideoListRenderer"`
+									} `json:"contents"`
+								} `json:"itemSectionRenderer"`
+							} `json:"contents"`
+						} `json:"sectionListRenderer"`
+					} `json:"content"`
+				} `json:"tabRenderer"`
+			} `json:"tabs"`
+		} `json:"twoColumnBrowseResultsRenderer"`
+	} `json:"contents"`
+	OnResponseReceivedActions []struct {
+		AppendContinuationItemsAction *struct {
+			ContinuationItems []playlistVideoItem `json:"continuationItems"`
+		} `json:"appendContinuationItemsAction"`
+	} `json:"onResponseReceivedActions"`
+}
+
+type playlistHeader struct {
+	Title           itText `json:"title"`
+	DescriptionText itText `json:"descriptionText"`
+	OwnerText       itText `json:"ownerText"`
+}
+
+// playlistVideoItem is an entry of a playlist's video list: a video, or the
+// continuation that loads the next page of videos
+type playlistVideoItem struct {
+	PlaylistVideoRenderer *struct {
+		VideoID         string      `json:"videoId"`
+		Title           itText      `json:"title"`
+		ShortBylineText itText      `json:"shortBylineText"`
+		LengthSeconds   string      `json:"lengthSeconds"`
+		Thumbnail       itThumbnail `json:"thumbnail"`
+	} `json:"playlistVideoRenderer"`
+	ContinuationItemRenderer *struct {
+		ContinuationEndpoint struct {
+			ContinuationCommand struct {
+				Token string `json:"token"`
+			} `json:"continuationCommand"`
+		} `json:"continuationEndpoint"`
+	} `json:"continuationItemRenderer"`
+}
+
+// playlistHeader returns the title, description and owner of a playlist
+func (r *browseResponse) playlistHeader() (*playlistHeader, error) {
+	if r.Header == nil || r.Header.PlaylistHeaderRenderer == nil {
+		return nil, &ParseError{Endpoint: "browse", Path: "header.playlistHeaderRenderer"}
+	}
+	return r.Header.PlaylistHeaderRenderer, nil
+}
+
+// playlistItems returns the first page of a playlist's video list
+func (r *browseResponse) playlistItems() ([]playlistVideoItem, error) {
+	missing := func(path string) error {
+		return &ParseError{Endpoint: "browse", Path: path}
+	}
+
+	if r.Contents == nil {
+		return nil, missing("contents")
+	}
+	if r.Contents.TwoColumnBrowseResultsRenderer == nil {
+		return nil, missing("contents.twoColumnBrowseResultsRenderer")
+	}
+	tabs := r.Contents.TwoColumnBrowseResultsRenderer.Tabs
+	if len(tabs) == 0 || tabs[0].TabRenderer == nil {
+		return nil, missing("contents.twoColumnBrowseResultsRenderer.tabs[0].tabRenderer")
+	}
+	if tabs[0].TabRenderer.Content == nil || tabs[0].TabRenderer.Content.SectionListRenderer == nil {
+		return nil, missing("contents.twoColumnBrowseResultsRenderer.tabs[0].tabRenderer.content.sectionListRenderer")
+	}
+
+	for _, section := range tabs[0].TabRenderer.Content.SectionListRenderer.Contents {
+		if section.ItemSectionRenderer == nil {
+			continue
+		}
+		for _, item := range section.ItemSectionRenderer.Contents {
+			if item.PlaylistVideoListRenderer != nil {
+				return item.PlaylistVideoListRenderer.Contents, nil
+			}
+		}
+	}
+	return nil, missing("contents.twoColumnBrowseResultsRenderer.tabs[0].tabRenderer.content.sectionListRenderer.contents[].itemSectionRenderer.contents[].playlistVideoListRenderer")
+}
+
+// continuationItems returns the videos a continuation request appended
+func (r *browseResponse) continuationItems() ([]playlistVideoItem, error) {
+	for _, action := range r.OnResponseReceivedActions {
+		if action.AppendContinuationItemsAction != nil {
+			return action.AppendContinuationItemsAction.ContinuationItems, nil
+		}
+	}
+	return nil, &ParseError{Endpoint: "browse", Path: "onResponseReceivedActions[].appendContinuationItemsAction"}
+}
+
+// playlistVideos converts the videos of a page of playlist items and
+// returns the continuation token of the next page, if any
+func playlistVideos(items []playlistVideoItem, proxy thumbnailProxy) ([]models.VideoResult, string) {
+	videos := make([]models.VideoResult, 0, len(items))
+	var continuation string
+	for _, item := range items {
+		if item.ContinuationItemRenderer != nil {
+			continuation = item.ContinuationItemRenderer.ContinuationEndpoint.ContinuationCommand.Token
+		}
+		r := item.PlaylistVideoRenderer
+		if r == nil || r.VideoID == "" {
+			continue
+		}
+
+		seconds, _ := strconv.Atoi(r.LengthSeconds)
+		videos = append(videos, models.VideoResult{
+			ID:          r.VideoID,
+			Title:       r.Title.String(),
+			Author:      r.ShortBylineText.First(),
+			Duration:    (time.Duration(seconds) * time.Second).String(),
+			DurationSec: seconds,
+			Thumbnails:  r.Thumbnail.convert(proxy),
+		})
+	}
+	return videos, continuation
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"musiq/models"
+)
+
+// loadFixture decodes a response saved in testdata
+func loadFixture(t *testing.T, name string, out any) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("failed to decode %s: %v", name, err)
+	}
+}
+
+func TestSearchResponseVideoRenderers(t *testing.T) {
+	var response searchResponse
+	loadFixture(t, "search_web.json", &response)
+
+	renderers, err := response.videoRenderers()
+	if err != nil {
+		t.Fatalf("videoRenderers() error = %v", err)
+	}
+
+	// The shorts shelf, channel card and continuation item are skipped
+	tests := []struct {
+		id          string
+		title       string
+		author      string
+		durationSec int
+		viewCount   int64
+		live        bool
+		badges      []string
+	}{
+		{
+			id:        "jfKfPfyJRdk",
+			title:     "lofi hip hop radio 📚 - beats to relax/study to",
+			author:    "Lofi Girl",
+			viewCount: 31118,
+			live:      true,
+			badges:    []string{"LIVE"},
+		},
+		{
+			id:          "dQw4w9WgXcQ",
+			title:       "Rick Astley - Never Gonna Give You Up (Official Music Video)",
+			author:      "Rick Astley",
+			durationSec: 213,
+			viewCount:   1612345678,
+			badges:      []string{"4K", "CC"},
+		},
+	}
+	if len(renderers) != len(tests) {
+		t.Fatalf("videoRenderers() returned %d renderers, want %d", len(renderers), len(tests))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			r := renderers[i]
+			if r.VideoID != tt.id {
+				t.Errorf("VideoID = %q, want %q", r.VideoID, tt.id)
+			}
+			if got := r.Title.String(); got != tt.title {
+				t.Errorf("Title = %q, want %q", got, tt.title)
+			}
+			if got := r.OwnerText.First(); got != tt.author {
+				t.Errorf("OwnerText = %q, want %q", got, tt.author)
+			}
+			if got := parseClockDuration(r.LengthText.String()); got != tt.durationSec {
+				t.Errorf("duration = %d, want %d", got, tt.durationSec)
+			}
+			if got := parseViewCount(r.ViewCountText.String()); got != tt.viewCount {
+				t.Errorf("view count = %d, want %d", got, tt.viewCount)
+			}
+
+			var video models.VideoResult
+			applyBadges(&video, r)
+			if video.IsLive != tt.live {
+				t.Errorf("IsLive = %v, want %v", video.IsLive, tt.live)
+			}
+			if !slices.Equal(video.Badges, tt.badges) {
+				t.Errorf("Badges = %q, want %q", video.Badges, tt.badges)
+			}
+		})
+	}
+}
+
+func TestNextResponsePlaylistPanel(t *testing.T) {
+	var response nextResponse
+	loadFixture(t, "next_mix.json", &response)
+
+	panel, err := response.playlistPanel()
+	if err != nil {
+		t.Fatalf("playlistPanel() error = %v", err)
+	}
+	if want := "Mix - Rick Astley - Never Gonna Give You Up"; panel.Title != want {
+		t.Errorf("Title = %q, want %q", panel.Title, want)
+	}
+	if got := panel.OwnerName.String(); got != "YouTube" {
+		t.Errorf("OwnerName = %q, want %q", got, "YouTube")
+	}
+
+	tests := []struct {
+		id          string
+		author      string
+		duration    string
+		durationSec int
+	}{
+		{id: "dQw4w9WgXcQ", author: "Rick Astley", duration: "3:33", durationSec: 213},
+		{id: "yPYZpwSpKmA", author: "Rick Astley", duration: "3:24", durationSec: 204},
+	}
+	videos := panel.videos("")
+	if len(videos) != len(tests) {
+		t.Fatalf("videos() returned %d videos, want %d", len(videos), len(tests))
+	}
+	for i, tt := range tests {
+		video := videos[i]
+		if video.ID != tt.id || video.Author != tt.author || video.Duration != tt.duration || video.DurationSec != tt.durationSec {
+			t.Errorf("videos()[%d] = %s by %q (%s, %ds), want %s by %q (%s, %ds)", i,
+				video.ID, video.Author, video.Duration, video.DurationSec,
+				tt.id, tt.author, tt.duration, tt.durationSec)
+		}
+		if video.Title == "" {
+			t.Errorf("videos()[%d] has no title", i)
+		}
+	}
+}
+
+func TestBrowseResponsePlaylist(t *testing.T) {
+	var response browseResponse
+	loadFixture(t, "browse_playlist.json", &response)
+
+	header, err := response.playlistHeader()
+	if err != nil {
+		t.Fatalf("playlistHeader() error = %v", err)
+	}
+	if header.Title.String() != "Synthwave Essentials" || header.OwnerText.First() != "Musiq Fixtures" || header.DescriptionText.String() != "Late night drives" {
+		t.Errorf("header = %q by %q: %q", header.Title.String(), header.OwnerText.First(), header.DescriptionText.String())
+	}
+
+	items, err := response.playlistItems()
+	if err != nil {
+		t.Fatalf("playlistItems() error = %v", err)
+	}
+	videos, continuation := playlistVideos(items, "")
+	if continuation != "" {
+		t.Errorf("continuation = %q, want none", continuation)
+	}
+
+	tests := []struct {
+		id          string
+		author      string
+		durationSec int
+	}{
+		{id: "MV_3Dpw-BRY", author: "KavinskyVEVO", durationSec: 258},
+		{id: "4NRXx6U8ABQ", author: "TheWeekndVEVO", durationSec: 203},
+	}
+	if len(videos) != len(tests) {
+		t.Fatalf("playlistVideos() returned %d videos, want %d", len(videos), len(tests))
+	}
+	for i, tt := range tests {
+		video := videos[i]
+		if video.ID != tt.id || video.Author != tt.author || video.DurationSec != tt.durationSec || video.Title == "" || len(video.Thumbnails) == 0 {
+			t.Errorf("videos[%d] = %+v, want %s by %q (%ds)", i, video, tt.id, tt.author, tt.durationSec)
+		}
+	}
+}
+
+func TestBrowseResponseContinuation(t *testing.T) {
+	body := `{"onResponseReceivedActions":[{"appendContinuationItemsAction":{"continuationItems":[
+		{"playlistVideoRenderer":{"videoId":"yPYZpwSpKmA","title":{"runs":[{"text":"Together Forever"}]},"lengthSeconds":"204"}},
+		{"continuationItemRenderer":{"continuationEndpoint":{"continuationCommand":{"token":"page3"}}}}
+	]}}]}`
+	var response browseResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	items, err := response.continuationItems()
+	if err != nil {
+		t.Fatalf("continuationItems() error = %v", err)
+	}
+	videos, continuation := playlistVideos(items, "")
+	if len(videos) != 1 || videos[0].ID != "yPYZpwSpKmA" || videos[0].DurationSec != 204 {
+		t.Errorf("videos = %+v", videos)
+	}
+	if continuation != "page3" {
+		t.Errorf("continuation = %q, want page3", continuation)
+	}
+}
+
+func TestMusicSearchResponseListItems(t *testing.T) {
+	var response musicSearchResponse
+	loadFixture(t, "search_music.json", &response)
+
+	items, err := response.listItems()
+	if err != nil {
+		t.Fatalf("listItems() error = %v", err)
+	}
+	// The top result card duplicates the first song and is skipped
+	if len(items) != 4 {
+		t.Fatalf("listItems() returned %d items, want 4", len(items))
+	}
+
+	result := &models.MusicSearchResponse{}
+	for _, item := range items {
+		addMusicItem(result, item, "")
+	}
+
+	if len(result.Songs) != 1 {
+		t.Fatalf("got %d songs, want 1", len(result.Songs))
+	}
+	song := result.Songs[0]
+	if song.ID != "h5EofwRzit0" || song.Title != "Get Lucky (feat. Pharrell Williams and Nile Rodgers)" {
+		t.Errorf("song = %s %q", song.ID, song.Title)
+	}
+	if song.VideoType != "song" || song.AudioID != "h5EofwRzit0" {
+		t.Errorf("song VideoType = %q, AudioID = %q, want song with its own ID as audio", song.VideoType, song.AudioID)
+	}
+	if song.Duration != "6:10" || song.DurationSec != 370 {
+		t.Errorf("song duration = %q (%ds), want 6:10 (370s)", song.Duration, song.DurationSec)
+	}
+	if len(song.Artists) != 1 || song.Artists[0] != (models.MusicRef{ID: "UC_kRDKYrUlrbtrSiyu5Tflg", Name: "Daft Punk"}) {
+		t.Errorf("song artists = %+v", song.Artists)
+	}
+	if song.Album == nil || *song.Album != (models.MusicRef{ID: "MPREb_9nqEki4ZDpp", Name: "Random Access Memories"}) {
+		t.Errorf("song album = %+v", song.Album)
+	}
+
+	if len(result.Albums) != 1 || result.Albums[0].ID != "MPREb_9nqEki4ZDpp" || result.Albums[0].Year != "2013" {
+		t.Errorf("albums = %+v", result.Albums)
+	}
+	if len(result.Artists) != 1 || result.Artists[0].Name != "Daft Punk" || result.Artists[0].Subscribers != "9.1M subscribers" {
+		t.Errorf("artists = %+v", result.Artists)
+	}
+	// Playlist browse IDs lose their VL prefix
+	if len(result.Playlists) != 1 || result.Playlists[0].ID != "RDCLAK5uy_kEWqD8g4mkmXrMrM8RTAm4BXS3O0Pv4Rg" || result.Playlists[0].ItemCount != "50 songs" {
+		t.Errorf("playlists = %+v", result.Playlists)
+	}
+}
+
+// TestParseErrors checks that responses whose layout changed fail with the
+// path where they stopped matching
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		body     string
+		parse    func(data []byte) error
+		endpoint string
+		path     string
+	}{
+		{
+			name:     "reshuffled search",
+			fixture:  "search_web_reshuffled.json",
+			parse:    decodeAndParse(func(r *searchResponse) error { _, err := r.videoRenderers(); return err }),
+			endpoint: "search",
+			path:     "contents.twoColumnSearchResultsRenderer",
+		},
+		{
+			name:     "empty search",
+			body:     `{}`,
+			parse:    decodeAndParse(func(r *searchResponse) error { _, err := r.videoRenderers(); return err }),
+			endpoint: "search",
+			path:     "contents",
+		},
+		{
+			name:     "search without an item section",
+			body:     `{"contents":{"twoColumnSearchResultsRenderer":{"primaryContents":{"sectionListRenderer":{"contents":[{"continuationItemRenderer":{}}]}}}}}`,
+			parse:    decodeAndParse(func(r *searchResponse) error { _, err := r.videoRenderers(); return err }),
+			endpoint: "search",
+			path:     "contents.twoColumnSearchResultsRenderer.primaryContents.sectionListRenderer.contents[].itemSectionRenderer",
+		},
+		{
+			name:     "watch page without a playlist",
+			body:     `{"contents":{"twoColumnWatchNextResults":{}}}`,
+			parse:    decodeAndParse(func(r *nextResponse) error { _, err := r.playlistPanel(); return err }),
+			endpoint: "next",
+			path:     "contents.twoColumnWatchNextResults.playlist",
+		},
+		{
+			name:     "browse without a header",
+			body:     `{"contents":{}}`,
+			parse:    decodeAndParse(func(r *browseResponse) error { _, err := r.playlistHeader(); return err }),
+			endpoint: "browse",
+			path:     "header.playlistHeaderRenderer",
+		},
+		{
+			name:     "browse without a video list",
+			body:     `{"contents":{"twoColumnBrowseResultsRenderer":{"tabs":[{"tabRenderer":{"content":{"sectionListRenderer":{"contents":[{"itemSectionRenderer":{"contents":[{"messageRenderer":{}}]}}]}}}}]}}}`,
+			parse:    decodeAndParse(func(r *browseResponse) error { _, err := r.playlistItems(); return err }),
+			endpoint: "browse",
+			path:     "contents.twoColumnBrowseResultsRenderer.tabs[0].tabRenderer.content.sectionListRenderer.contents[].itemSectionRenderer.contents[].playlistVideoListRenderer",
+		},
+		{
+			name:     "browse continuation without items",
+			body:     `{"onResponseReceivedActions":[]}`,
+			parse:    decodeAndParse(func(r *browseResponse) error { _, err := r.continuationItems(); return err }),
+			endpoint: "browse",
+			path:     "onResponseReceivedActions[].appendContinuationItemsAction",
+		},
+		{
+			name:     "music search without tabs",
+			body:     `{"contents":{"tabbedSearchResultsRenderer":{"tabs":[]}}}`,
+			parse:    decodeAndParse(func(r *musicSearchResponse) error { _, err := r.listItems(); return err }),
+			endpoint: "music search",
+			path:     "contents.tabbedSearchResultsRenderer.tabs[0].tabRenderer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.body)
+			if tt.fixture != "" {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("testdata", tt.fixture)); err != nil {
+					t.Fatalf("failed to read fixture: %v", err)
+				}
+			}
+
+			err := tt.parse(data)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("error = %v, want a *ParseError", err)
+			}
+			if parseErr.Endpoint != tt.endpoint || parseErr.Path != tt.path {
+				t.Errorf("ParseError = {%q, %q}, want {%q, %q}", parseErr.Endpoint, parseErr.Path, tt.endpoint, tt.path)
+			}
+		})
+	}
+}
+
+// decodeAndParse decodes a response into T and runs parse on it
+func decodeAndParse[T any](parse func(*T) error) func([]byte) error {
+	return func(data []byte) error {
+		var response T
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+		return parse(&response)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"musiq/metrics"
+)
+
+// instrumentedTransport records the latency and outcome of every upstream
+// request. Requests are classified by path rather than host, so traffic to
+// a configured base URL is labelled like traffic to YouTube itself.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// instrumentedClient returns a copy of client whose requests are recorded
+func instrumentedClient(client *http.Client) *http.Client {
+	instrumented := *client
+	instrumented.Transport = &instrumentedTransport{next: client.Transport}
+	return &instrumented
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+
+	upstream, endpoint := classifyUpstream(req)
+	metrics.ObserveUpstream(upstream, endpoint, upstreamResult(resp, err), time.Since(start))
+	return resp, err
+}
+
+// classifyUpstream names the upstream and endpoint of a request with a
+// fixed set of labels
+func classifyUpstream(req *http.Request) (upstream, endpoint string) {
+	path := req.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/youtubei/v1/"):
+		endpoint = strings.TrimPrefix(path, "/youtubei/v1/")
+		if i := strings.IndexByte(endpoint, '/'); i >= 0 {
+			endpoint = endpoint[:i]
+		}
+		switch endpoint {
+		case "player", "search", "browse", "next":
+		default:
+			endpoint = "other"
+		}
+		return "innertube", endpoint
+	case strings.HasSuffix(path, "/videoplayback"):
+		return "googlevideo", "videoplayback"
+	case strings.HasPrefix(path, "/vi/") || strings.HasPrefix(path, "/vi_webp/"):
+		return "thumbnail", "vi"
+	case strings.HasPrefix(path, "/complete/search"):
+		return "suggest", "complete"
+	case strings.HasPrefix(path, "/embed/"):
+		return "web", "embed"
+	case strings.HasPrefix(path, "/s/player/"):
+		return "web", "player_js"
+	case path == "/generate_204":
+		return "web", "ping"
+	default:
+		return "web", "other"
+	}
+}
+
+// upstreamResult classifies the outcome of an upstream request
+func upstreamResult(resp *http.Response, err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil && resp.StatusCode < 400:
+		return "ok"
+	case err == nil && resp.StatusCode == http.StatusForbidden:
+		return "forbidden"
+	case err == nil && resp.StatusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case err == nil && resp.StatusCode >= 500:
+		return "server_error"
+	case err == nil:
+		return "client_error"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "network"
+	}
+}
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"musiq/models"
+)
+
+const (
+	// maxLibraryResults caps how many local tracks a search returns
+	maxLibraryResults = 20
+	// libraryRescanInterval is how often the library directory is rescanned
+	libraryRescanInterval = 10 * time.Minute
+	// probeTimeout bounds reading the tags of a single file
+	probeTimeout = 10 * time.Second
+)
+
+// ErrTrackNotFound is returned for local IDs that aren't in the library
+var ErrTrackNotFound = errors.New("track not found in library")
+
+// libraryMimeTypes are the audio files the library indexes
+var libraryMimeTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".webm": "audio/webm",
+}
+
+// LocalLibrary is a media source serving audio files from a directory.
+// Tags are read with ffprobe; files without tags fall back to
+// "Artist - Title" parsing of the file name. Each directory is a playlist.
+type LocalLibrary struct {
+	root string
+	// probePath is the ffprobe binary tags are read with
+	probePath string
+
+	mu     sync.RWMutex
+	tracks map[string]*localTrack
+	albums map[string][]*localTrack
+}
+
+type localTrack struct {
+	id       string
+	path     string
+	dir      string
+	title    string
+	artist   string
+	album    string
+	track    int
+	duration time.Duration
+	size     int64
+	modTime  time.Time
+	mimeType string
+}
+
+// NewLocalLibrary creates a library for the audio files under root, read
+// with the ffprobe at probePath. The library is empty until Scan or Watch
+// is called.
+func NewLocalLibrary(root, probePath string) (*LocalLibrary, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open music library: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("music library %s is not a directory", root)
+	}
+
+	return &LocalLibrary{
+		root:      root,
+		probePath: probePath,
+		tracks: make(map[string]*localTrack),
+		albums: make(map[string][]*localTrack),
+	}, nil
+}
+
+// Watch scans the library in the background now and then every interval
+func (l *LocalLibrary) Watch(interval time.Duration) {
+	go func() {
+		for {
+			if err := l.Scan(); err != nil {
+				slog.Error("Music library scan failed", "error", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Scan indexes the library directory. Files unchanged since the last scan
+// keep their tags, so only new and modified files are probed.
+func (l *LocalLibrary) Scan() error {
+	l.mu.RLock()
+	previous := make(map[string]*localTrack, len(l.tracks))
+	for _, t := range l.tracks {
+		previous[t.path] = t
+	}
+	l.mu.RUnlock()
+
+	tracks := make(map[string]*localTrack)
+	albums := make(map[string][]*localTrack)
+
+	err := filepath.WalkDir(l.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			slog.Warn("Skipping library file", "path", path, "error", err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		mimeType, ok := libraryMimeTypes[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		t, ok := previous[path]
+		if !ok || !t.modTime.Equal(info.ModTime()) || t.size != info.Size() {
+			t = l.readTrack(path, info)
+			t.mimeType = mimeType
+		}
+
+		tracks[t.id] = t
+		albums[t.dir] = append(albums[t.dir], t)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan music library: %w", err)
+	}
+
+	for _, list := range albums {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].track != list[j].track {
+				return list[i].track < list[j].track
+			}
+			return list[i].path < list[j].path
+		})
+	}
+
+	l.mu.Lock()
+	l.tracks = tracks
+	l.albums = albums
+	l.mu.Unlock()
+
+	slog.Info("Music library scanned", "tracks", len(tracks), "folders", len(albums))
+	return nil
+}
+
+// readTrack builds a track from a file's tags, falling back to its name
+func (l *LocalLibrary) readTrack(path string, info fs.FileInfo) *localTrack {
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		rel = path
+	}
+	dir := filepath.Dir(rel)
+
+	t := &localTrack{
+		id:      libraryID(rel),
+		path:    path,
+		dir:     libraryID(dir),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+
+	if tags, duration, err := probeTags(l.probePath, path); err == nil {
+		t.title = tags["title"]
+		t.artist = firstNonEmpty(tags["artist"], tags["album_artist"])
+		t.album = tags["album"]
+		t.duration = duration
+		// Track numbers may be written as "3/12"
+		number, _, _ := strings.Cut(tags["track"], "/")
+		t.track, _ = strconv.Atoi(strings.TrimSpace(number))
+	} else {
+		slog.Warn("Reading tags failed", "path", path, "error", err)
+	}
+
+	if t.title == "" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		meta := CleanMetadata(name, "")
+		t.title = meta.Title
+		if t.artist == "" {
+			t.artist = meta.Artist
+		}
+	}
+	if t.album == "" && dir != "." {
+		t.album = filepath.Base(dir)
+	}
+
+	return t
+}
+
+// Name returns the media source prefix of local IDs
+func (l *LocalLibrary) Name() string {
+	return "local"
+}
+
+// Search returns tracks whose title, artist, album or path contain every
+// word of the query, title matches first
+func (l *LocalLibrary) Search(_ context.Context, query string, _ Locale) ([]models.VideoResult, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return []models.VideoResult{}, nil
+	}
+
+	l.mu.RLock()
+	matches := make([]*localTrack, 0)
+	for _, t := range l.tracks {
+		haystack := strings.ToLower(strings.Join([]string{t.title, t.artist, t.album, filepath.Base(t.path)}, " "))
+		if containsAll(haystack, words) {
+			matches = append(matches, t)
+		}
+	}
+	l.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		ti := containsAll(strings.ToLower(matches[i].title), words)
+		tj := containsAll(strings.ToLower(matches[j].title), words)
+		if ti != tj {
+			return ti
+		}
+		return matches[i].path < matches[j].path
+	})
+
+	if len(matches) > maxLibraryResults {
+		matches = matches[:maxLibraryResults]
+	}
+
+	results := make([]models.VideoResult, 0, len(matches))
+	for _, t := range matches {
+		results = append(results, t.result())
+	}
+	return results, nil
+}
+
+// Info returns the metadata of a track
+func (l *LocalLibrary) Info(_ context.Context, id string, _ Locale) (*models.VideoInfo, error) {
+	t, err := l.track(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.VideoInfo{
+		ID:          t.id,
+		Title:       t.title,
+		Author:      t.artist,
+		Duration:    t.duration.String(),
+		DurationSec: int(t.duration.Seconds()),
+		Description: t.album,
+		Thumbnails:  []models.Thumbnail{},
+		Formats: []models.VideoFormat{{
+			MimeType:  t.mimeType,
+			Quality:   "original",
+			AudioOnly: true,
+		}},
+		Metadata: t.metadata(),
+	}, nil
+}
+
+// AudioStream opens a track's file
+func (l *LocalLibrary) AudioStream(_ context.Context, id string) (*AudioStream, error) {
+	t, err := l.track(id)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open track: %w", err)
+	}
+
+	return &AudioStream{ReadCloser: file, MimeType: t.mimeType, Size: t.size}, nil
+}
+
+// Playlist returns a page of the tracks in a folder, or ErrTrackNotFound
+// for folders without tracks
+func (l *LocalLibrary) Playlist(_ context.Context, id string, offset, limit int, _ Locale) (*models.Playlist, error) {
+	l.mu.RLock()
+	tracks, ok := l.albums[id]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("album %s: %w", id, ErrTrackNotFound)
+	}
+
+	if limit <= 0 {
+		limit = DefaultPlaylistLimit
+	}
+
+	playlist := &models.Playlist{
+		ID:         id,
+		Title:      tracks[0].album,
+		Author:     tracks[0].artist,
+		VideoCount: len(tracks),
+		Offset:     offset,
+		Limit:      limit,
+		Videos:     []models.VideoResult{},
+	}
+	for i := offset; i < len(tracks) && i < offset+limit; i++ {
+		playlist.Videos = append(playlist.Videos, tracks[i].result())
+	}
+
+	return playlist, nil
+}
+
+func (l *LocalLibrary) track(id string) (*localTrack, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	t, ok := l.tracks[id]
+	if !ok {
+		return nil, ErrTrackNotFound
+	}
+	return t, nil
+}
+
+func (t *localTrack) result() models.VideoResult {
+	duration := ""
+	if t.duration > 0 {
+		duration = formatClockDuration(int(t.duration.Seconds()))
+	}
+	return models.VideoResult{
+		ID:          t.id,
+		Title:       t.title,
+		Author:      t.artist,
+		Duration:    duration,
+		DurationSec: int(t.duration.Seconds()),
+		Thumbnails:  []models.Thumbnail{},
+		Metadata:    t.metadata(),
+	}
+}
+
+func (t *localTrack) metadata() *models.TrackMetadata {
+	return &models.TrackMetadata{
+		Artist:    t.artist,
+		Title:     t.title,
+		Featuring: []string{},
+	}
+}
+
+// probeTags reads a file's tags and duration with ffprobe. Tag names are
+// lowercased since containers disagree on case, and Ogg files keep their
+// tags on the audio stream rather than the container.
+func probeTags(probePath, path string) (map[string]string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, probePath, "-v", "error", "-show_format", "-show_streams", "-of", "json", path).Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to probe %s: %w", filepath.Base(path), err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode ffprobe output: %w", err)
+	}
+
+	tags := make(map[string]string)
+	for _, stream := range probe.Streams {
+		for k, v := range stream.Tags {
+			tags[strings.ToLower(k)] = strings.TrimSpace(v)
+		}
+	}
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+
+	seconds, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	return tags, time.Duration(seconds * float64(time.Second)), nil
+}
+
+// libraryID derives a stable, URL-safe ID from a path within the library
+func libraryID(rel string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(rel)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// formatClockDuration formats seconds as "m:ss" or "h:mm:ss"
+func formatClockDuration(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func containsAll(text string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
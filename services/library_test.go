@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"musiq/config"
+)
+
+// fakeFFprobe reports the same tags for every file
+const fakeFFprobe = `#!/bin/sh
+cat <<'EOF'
+{"format": {"duration": "187.5", "tags": {"TITLE": "Tagged Title", "ARTIST": "Tagged Artist"}}, "streams": []}
+EOF
+`
+
+func TestFFmpegProbePath(t *testing.T) {
+	tests := []struct {
+		ffmpeg string
+		want   string
+	}{
+		{ffmpeg: "ffmpeg", want: "ffprobe"},
+		{ffmpeg: "/opt/ffmpeg/bin/ffmpeg", want: "/opt/ffmpeg/bin/ffprobe"},
+		{ffmpeg: "/usr/local/bin/ffmpeg-7", want: "/usr/local/bin/ffprobe-7"},
+		{ffmpeg: "/opt/ffmpeg/bin/ffmpeg.exe", want: "/opt/ffmpeg/bin/ffprobe.exe"},
+		{ffmpeg: "/opt/encoder", want: "/opt/ffprobe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ffmpeg, func(t *testing.T) {
+			s := NewFFmpegService(config.FFmpeg{Path: tt.ffmpeg})
+			if got := s.ProbePath(); got != filepath.FromSlash(tt.want) {
+				t.Errorf("ProbePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalLibraryProbesWithConfiguredFFprobe(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ffprobe"), []byte(fakeFFprobe), 0o755); err != nil {
+		t.Fatalf("failed to write fake ffprobe: %v", err)
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Named Artist - Named Title.mp3"), []byte("audio"), 0o644); err != nil {
+		t.Fatalf("failed to write track: %v", err)
+	}
+
+	ffmpeg := NewFFmpegService(config.FFmpeg{Path: filepath.Join(bin, "ffmpeg")})
+	library, err := NewLocalLibrary(root, ffmpeg.ProbePath())
+	if err != nil {
+		t.Fatalf("NewLocalLibrary() error = %v", err)
+	}
+	if err := library.Scan(); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	results, err := library.Search(context.Background(), "tagged", Locale{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "Tagged Title" || results[0].Author != "Tagged Artist" || results[0].DurationSec != 187 {
+		t.Errorf("Search() = %+v, want the track with its probed tags", results)
+	}
+}
+
+func TestLocalLibraryPlaylist(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "Album"), 0o755); err != nil {
+		t.Fatalf("failed to create album: %v", err)
+	}
+	for _, name := range []string{"Artist - One.mp3", "Artist - Two.mp3"} {
+		if err := os.WriteFile(filepath.Join(root, "Album", name), []byte("audio"), 0o644); err != nil {
+			t.Fatalf("failed to write track: %v", err)
+		}
+	}
+	// Without ffprobe, tracks are named after their files
+	library, err := NewLocalLibrary(root, filepath.Join(t.TempDir(), "ffprobe"))
+	if err != nil {
+		t.Fatalf("NewLocalLibrary() error = %v", err)
+	}
+	if err := library.Scan(); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		tracks int
+		err    error
+	}{
+		{name: "album", id: libraryID("Album"), tracks: 2},
+		{name: "unknown album", id: libraryID("Missing"), err: ErrTrackNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := library.Playlist(context.Background(), tt.id, 0, 0, Locale{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Playlist() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && (playlist.VideoCount != tt.tracks || len(playlist.Videos) != tt.tracks) {
+				t.Errorf("Playlist() = %+v, want %d tracks", playlist, tt.tracks)
+			}
+		})
+	}
+}
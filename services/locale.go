@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale is the interface language (hl) and content region (gl) YouTube
+// ranks and labels results for. Empty fields fall back to the service
+// defaults.
+type Locale struct {
+	HL string `json:"hl"`
+	GL string `json:"gl"`
+}
+
+var (
+	// hlRegex matches YouTube language codes such as "en", "pt-BR", "es-419"
+	hlRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,4})?$`)
+	// glRegex matches ISO 3166 region codes
+	glRegex = regexp.MustCompile(`^[a-zA-Z]{2}$`)
+)
+
+// regionalLanguages are the hl values YouTube offers with a region suffix.
+// Other Accept-Language tags are reduced to their language, with the region
+// used as gl.
+var regionalLanguages = map[string]bool{
+	"en-GB": true, "en-IN": true, "es-419": true, "es-US": true, "fr-CA": true,
+	"pt-BR": true, "pt-PT": true, "zh-CN": true, "zh-HK": true, "zh-TW": true,
+}
+
+// Key returns the locale in a form suitable for cache keys
+func (l Locale) Key() string {
+	return l.HL + "_" + l.GL
+}
+
+// ParseLocale builds a locale from explicit hl/gl query parameters, falling
+// back to the Accept-Language header for whichever is missing. It returns an
+// error when an explicit parameter is malformed; a malformed header is
+// ignored.
+func ParseLocale(hl, gl, acceptLanguage string) (Locale, error) {
+	var locale Locale
+
+	if hl != "" {
+		if !hlRegex.MatchString(hl) {
+			return Locale{}, fmt.Errorf("invalid hl %q", hl)
+		}
+		locale.HL = normalizeLanguageTag(hl)
+	}
+	if gl != "" {
+		if !glRegex.MatchString(gl) {
+			return Locale{}, fmt.Errorf("invalid gl %q", gl)
+		}
+		locale.GL = strings.ToUpper(gl)
+	}
+
+	if locale.HL == "" || locale.GL == "" {
+		fromHeader := localeFromAcceptLanguage(acceptLanguage)
+		if locale.HL == "" {
+			locale.HL = fromHeader.HL
+		}
+		if locale.GL == "" {
+			locale.GL = fromHeader.GL
+		}
+	}
+
+	return locale, nil
+}
+
+// localeFromAcceptLanguage picks the preferred language of an
+// Accept-Language header, e.g. "de-AT,de;q=0.9,en;q=0.8" becomes hl=de, gl=AT
+func localeFromAcceptLanguage(header string) Locale {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	tags := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if hlRegex.MatchString(tag) && q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	if len(tags) == 0 {
+		return Locale{}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	tag := normalizeLanguageTag(tags[0].tag)
+	if regionalLanguages[tag] {
+		_, region, _ := strings.Cut(tag, "-")
+		if !glRegex.MatchString(region) {
+			region = ""
+		}
+		return Locale{HL: tag, GL: region}
+	}
+
+	language, region, _ := strings.Cut(tag, "-")
+	if !glRegex.MatchString(region) {
+		region = ""
+	}
+	return Locale{HL: language, GL: region}
+}
+
+// normalizeLanguageTag lowercases the language and uppercases the region
+func normalizeLanguageTag(tag string) string {
+	language, region, ok := strings.Cut(tag, "-")
+	if !ok {
+		return strings.ToLower(language)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
+
+type localeContextKey struct{}
+
+// withLocale attaches a locale to a context so the player transport can
+// apply it to requests made by the player library
+func withLocale(ctx context.Context, locale Locale) context.Context {
+	return context.WithValue(ctx, localeContextKey{}, locale)
+}
+
+func localeFromContext(ctx context.Context) (Locale, bool) {
+	locale, ok := ctx.Value(localeContextKey{}).(Locale)
+	return locale, ok
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"musiq/models"
+)
+
+var (
+	// bracketGroupRegex matches (...), [...] and 【...】 groups in a title
+	bracketGroupRegex = regexp.MustCompile(`\s*(\([^()]*\)|\[[^\[\]]*\]|【[^【】]*】)`)
+	// featRegex matches an inline "feat. X" / "ft. X" / "featuring X" tail
+	featRegex = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.?|featuring)\s+(.+)$`)
+	// featGroupRegex matches a bracket group that only credits featured artists
+	featGroupRegex = regexp.MustCompile(`(?i)^(?:feat\.?|ft\.?|featuring|with)\s+(.+)$`)
+	// remixRegex matches remix-like credits such as "Skrillex Remix"
+	remixRegex = regexp.MustCompile(`(?i)\b(remix|rework|bootleg|flip|edit|mix)\b`)
+	// artistSplitRegex splits a list of artist credits
+	artistSplitRegex = regexp.MustCompile(`(?i)\s*(?:,|&|\band\b)\s*`)
+	// titleSeparators split "Artist - Track" titles, in order of preference
+	titleSeparators = []string{" - ", " – ", " — ", " -- ", " ~ "}
+)
+
+// noiseWords mark a bracket group or " | " suffix as upload noise rather than
+// part of the track name
+var noiseWords = []string{
+	"official", "video", "audio", "lyric", "lyrics", "visualizer", "visualiser",
+	"hd", "hq", "4k", "1080p", "720p", "mv", "m/v", "explicit", "clean",
+	"full song", "music video", "color coded", "subtitulado", "legendado",
+}
+
+// CleanMetadata splits a raw YouTube title into artist, track, featured
+// artists and remix credit. The uploader channel, with "- Topic" and "VEVO"
+// removed, stands in for the artist when the title doesn't name one.
+func CleanMetadata(title, channel string) models.TrackMetadata {
+	meta := models.TrackMetadata{
+		Channel: CleanChannelName(channel),
+	}
+
+	cleaned := stripNoiseSuffix(title)
+
+	// Pull credits out of bracket groups and drop the noise ones
+	cleaned = bracketGroupRegex.ReplaceAllStringFunc(cleaned, func(group string) string {
+		inner := bracketContents(group)
+
+		if m := featGroupRegex.FindStringSubmatch(inner); m != nil {
+			meta.Featuring = append(meta.Featuring, splitArtists(m[1])...)
+			return ""
+		}
+		if remixRegex.MatchString(inner) && !isNoise(inner) {
+			meta.Remix = inner
+			return ""
+		}
+		if isNoise(inner) {
+			return ""
+		}
+		return group
+	})
+
+	artist, track := splitArtistTrack(cleaned)
+
+	// Inline "feat." credits may trail either the artist or the track
+	if m := featRegex.FindStringSubmatch(artist); m != nil {
+		meta.Featuring = append(meta.Featuring, splitArtists(m[1])...)
+		artist = artist[:len(artist)-len(m[0])]
+	}
+	if m := featRegex.FindStringSubmatch(track); m != nil {
+		meta.Featuring = append(meta.Featuring, splitArtists(m[1])...)
+		track = track[:len(track)-len(m[0])]
+	}
+
+	if artist == "" {
+		artist = meta.Channel
+	}
+
+	meta.Artist = collapseSpaces(artist)
+	meta.Title = strings.Trim(collapseSpaces(track), `"'“”‘’`)
+	if meta.Title == "" {
+		meta.Title = collapseSpaces(title)
+	}
+
+	return meta
+}
+
+// CleanChannelName strips the " - Topic" suffix of auto-generated artist
+// channels and the VEVO branding of label channels
+func CleanChannelName(channel string) string {
+	name := strings.TrimSpace(channel)
+	name = strings.TrimSuffix(name, " - Topic")
+
+	if trimmed, ok := strings.CutSuffix(name, "VEVO"); ok && trimmed != "" {
+		name = strings.TrimSpace(trimmed)
+		// "TaylorSwiftVEVO" becomes "Taylor Swift"
+		if !strings.Contains(name, " ") {
+			name = splitCamelCase(name)
+		}
+	}
+
+	return name
+}
+
+// annotateVideos attaches cleaned metadata to each video result
+func annotateVideos(videos []models.VideoResult) {
+	for i := range videos {
+		meta := CleanMetadata(videos[i].Title, videos[i].Author)
+		videos[i].Metadata = &meta
+	}
+}
+
+// splitArtistTrack splits "Artist - Track" on the first separator found
+func splitArtistTrack(title string) (artist, track string) {
+	for _, sep := range titleSeparators {
+		if before, after, ok := strings.Cut(title, sep); ok {
+			return strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+	}
+	return "", strings.TrimSpace(title)
+}
+
+// bracketContents returns the text inside a bracket group
+func bracketContents(group string) string {
+	group = strings.TrimSpace(group)
+	_, first := utf8.DecodeRuneInString(group)
+	_, last := utf8.DecodeLastRuneInString(group)
+	return strings.TrimSpace(group[first : len(group)-last])
+}
+
+// stripNoiseSuffix drops " | Official Video"-style tails
+func stripNoiseSuffix(title string) string {
+	for _, sep := range []string{" | ", " // "} {
+		if before, after, ok := strings.Cut(title, sep); ok && isNoise(after) {
+			return before
+		}
+	}
+	return title
+}
+
+func isNoise(text string) bool {
+	lower := strings.ToLower(text)
+	for _, word := range noiseWords {
+		if containsWord(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether word appears in text on word boundaries
+func containsWord(text, word string) bool {
+	for i := 0; ; {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return false
+		}
+		start := i + j
+		end := start + len(word)
+		if (start == 0 || !isWordRune(rune(text[start-1]))) && (end == len(text) || !isWordRune(rune(text[end]))) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func splitArtists(credits string) []string {
+	artists := make([]string, 0)
+	for _, name := range artistSplitRegex.Split(credits, -1) {
+		if name = strings.TrimSpace(name); name != "" {
+			artists = append(artists, name)
+		}
+	}
+	return artists
+}
+
+func splitCamelCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
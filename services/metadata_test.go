@@ -0,0 +1,102 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"musiq/models"
+)
+
+func TestCleanMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		channel string
+		want    models.TrackMetadata
+	}{
+		{
+			name: "artist and track", title: "Daft Punk - Get Lucky", channel: "Daft Punk",
+			want: models.TrackMetadata{Artist: "Daft Punk", Title: "Get Lucky", Channel: "Daft Punk"},
+		},
+		{
+			name: "noise groups", title: "Adele - Hello (Official Video) [4K]", channel: "AdeleVEVO",
+			want: models.TrackMetadata{Artist: "Adele", Title: "Hello", Channel: "Adele"},
+		},
+		{
+			name: "noise suffix", title: "Queen - Bohemian Rhapsody | Official Music Video", channel: "Queen Official",
+			want: models.TrackMetadata{Artist: "Queen", Title: "Bohemian Rhapsody", Channel: "Queen Official"},
+		},
+		{
+			name: "feat. group", title: "Calvin Harris - Feels (feat. Pharrell Williams, Katy Perry & Big Sean)", channel: "CalvinHarrisVEVO",
+			want: models.TrackMetadata{
+				Artist: "Calvin Harris", Title: "Feels", Channel: "Calvin Harris",
+				Featuring: []string{"Pharrell Williams", "Katy Perry", "Big Sean"},
+			},
+		},
+		{
+			name: "inline ft. after the artist", title: "Eminem ft. Rihanna - Love The Way You Lie", channel: "EminemVEVO",
+			want: models.TrackMetadata{Artist: "Eminem", Title: "Love The Way You Lie", Channel: "Eminem", Featuring: []string{"Rihanna"}},
+		},
+		{
+			name: "inline featuring after the track", title: "Major Lazer - Lean On featuring MØ and DJ Snake", channel: "Major Lazer Official",
+			want: models.TrackMetadata{Artist: "Major Lazer", Title: "Lean On", Channel: "Major Lazer Official", Featuring: []string{"MØ", "DJ Snake"}},
+		},
+		{
+			name: "remix", title: "Avicii - Levels (Skrillex Remix) [Official Audio]", channel: "Avicii",
+			want: models.TrackMetadata{Artist: "Avicii", Title: "Levels", Channel: "Avicii", Remix: "Skrillex Remix"},
+		},
+		{
+			name: "other groups kept", title: "Nirvana - Smells Like Teen Spirit (Live at Reading 1992)", channel: "Nirvana",
+			want: models.TrackMetadata{Artist: "Nirvana", Title: "Smells Like Teen Spirit (Live at Reading 1992)", Channel: "Nirvana"},
+		},
+		{
+			name: "topic channel as artist", title: "Clair de Lune", channel: "Claude Debussy - Topic",
+			want: models.TrackMetadata{Artist: "Claude Debussy", Title: "Clair de Lune", Channel: "Claude Debussy"},
+		},
+		{
+			name: "quoted track", title: `Hozier - "Take Me to Church"`, channel: "Hozier",
+			want: models.TrackMetadata{Artist: "Hozier", Title: "Take Me to Church", Channel: "Hozier"},
+		},
+		{
+			name: "en dash", title: "Sigur Rós – Hoppípolla", channel: "Sigur Rós",
+			want: models.TrackMetadata{Artist: "Sigur Rós", Title: "Hoppípolla", Channel: "Sigur Rós"},
+		},
+		// A title that is all noise keeps the raw title
+		{
+			name: "only noise", title: "(Official Video)", channel: "Someone",
+			want: models.TrackMetadata{Artist: "Someone", Title: "(Official Video)", Channel: "Someone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CleanMetadata(tt.title, tt.channel)
+			if got.Artist != tt.want.Artist || got.Title != tt.want.Title || got.Remix != tt.want.Remix ||
+				got.Channel != tt.want.Channel || !slices.Equal(got.Featuring, tt.want.Featuring) {
+				t.Errorf("CleanMetadata(%q, %q) = %+v, want %+v", tt.title, tt.channel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanChannelName(t *testing.T) {
+	tests := []struct {
+		channel string
+		want    string
+	}{
+		{channel: "Daft Punk - Topic", want: "Daft Punk"},
+		{channel: "TaylorSwiftVEVO", want: "Taylor Swift"},
+		{channel: "Lady Gaga VEVO", want: "Lady Gaga"},
+		{channel: "  Radiohead  ", want: "Radiohead"},
+		{channel: "VEVO", want: "VEVO"},
+		{channel: "Topic Records", want: "Topic Records"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			if got := CleanChannelName(tt.channel); got != tt.want {
+				t.Errorf("CleanChannelName(%q) = %q, want %q", tt.channel, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"musiq/models"
+)
+
+// maxMixRounds bounds how many watch-next requests one page of a mix may
+// take, so a huge offset can't turn into an unbounded crawl
+const maxMixRounds = 20
+
+// mixSeedPrefixes are the mix ID prefixes followed by the seed video ID,
+// longest first so RDAMVM (YouTube Music) wins over plain RD
+var mixSeedPrefixes = []string{"RDAMVM", "RDMM", "RD"}
+
+// IsMixPlaylistID reports whether a playlist ID is an auto-generated
+// mix / radio playlist, which the regular playlist loader can't read
+func IsMixPlaylistID(playlistID string) bool {
+	return strings.HasPrefix(playlistID, "RD")
+}
+
+// mixSeedVideoID returns the video a mix was generated from, or "" when the
+// ID does not embed one
+func mixSeedVideoID(playlistID string) string {
+	for _, prefix := range mixSeedPrefixes {
+		if rest, ok := strings.CutPrefix(playlistID, prefix); ok && videoIDRegex.MatchString(rest) {
+			return rest
+		}
+	}
+	return ""
+}
+
+// mixCrawl is a mix loaded as far as pages have asked for. Pages are cut
+// from it and it grows from its last video, so paging doesn't restart the
+// crawl from the seed, and since the watch-next panel isn't deterministic,
+// pages cut from one crawl neither overlap nor skip videos.
+type mixCrawl struct {
+	mu       sync.Mutex
+	playlist models.Playlist
+	seen     map[string]bool
+	// next is the video the next watch-next request starts from
+	next string
+	// exhausted is set once the mix stops returning new videos
+	exhausted bool
+}
+
+// startMix loads the first round of a mix
+func (s *YouTubeService) startMix(ctx context.Context, playlistID string) (*mixCrawl, error) {
+	crawl := &mixCrawl{
+		playlist: models.Playlist{ID: playlistID, Endless: true},
+		seen:     make(map[string]bool),
+		next:     mixSeedVideoID(playlistID),
+	}
+	if err := crawl.round(ctx, s); err != nil {
+		return nil, fmt.Errorf("failed to get mix: %w", err)
+	}
+	return crawl, nil
+}
+
+// getMixPlaylist returns the mix cached under key, extended until at least
+// want videos are loaded or the mix stops growing
+func (s *YouTubeService) getMixPlaylist(ctx context.Context, key, playlistID string, want int) (*models.Playlist, error) {
+	crawl, err := s.mixes.get(ctx, key, func(ctx context.Context) (*mixCrawl, error) {
+		return s.startMix(ctx, playlistID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crawl.extend(ctx, s, want), nil
+}
+
+// extend follows the mix until it holds want videos and returns a snapshot
+// of it. Requests for the same mix wait for each other, so the crawl is
+// only extended once. A failed round ends the extension; the next page
+// retries it.
+func (m *mixCrawl) extend(ctx context.Context, s *YouTubeService, want int) *models.Playlist {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for round := 0; round < maxMixRounds && !m.exhausted && len(m.playlist.Videos) < want; round++ {
+		if err := m.round(ctx, s); err != nil {
+			break
+		}
+	}
+
+	playlist := m.playlist
+	playlist.VideoCount = len(playlist.Videos)
+	return &playlist
+}
+
+// round requests the watch-next panel from the crawl's last video and
+// appends the videos it hasn't seen yet
+func (m *mixCrawl) round(ctx context.Context, s *YouTubeService) error {
+	panel, err := s.fetchPlaylistPanel(ctx, m.playlist.ID, m.next)
+	if err != nil {
+		return err
+	}
+
+	if m.playlist.Title == "" {
+		m.playlist.Title = panel.Title
+		m.playlist.Author = panel.OwnerName.String()
+	}
+
+	added := 0
+	for _, video := range panel.videos(s.thumbnailProxy) {
+		if m.seen[video.ID] {
+			continue
+		}
+		m.seen[video.ID] = true
+		m.playlist.Videos = append(m.playlist.Videos, video)
+		added++
+	}
+
+	// Mixes that aren't infinite (or ran dry) stop returning new videos
+	if added == 0 {
+		m.exhausted = true
+		return nil
+	}
+	m.next = m.playlist.Videos[len(m.playlist.Videos)-1].ID
+	return nil
+}
+
+// fetchPlaylistPanel requests the watch-next page of a video within a
+// playlist and returns its playlist panel. An empty videoID starts at the
+// beginning of the playlist.
+func (s *YouTubeService) fetchPlaylistPanel(ctx context.Context, playlistID, videoID string) (*playlistPanel, error) {
+	payload := map[string]interface{}{
+		"context":    s.web.innertubeContext(),
+		"playlistId": playlistID,
+	}
+	if videoID != "" {
+		payload["videoId"] = videoID
+	}
+
+	var response nextResponse
+	if err := s.web.request(ctx, "next", payload, &response); err != nil {
+		return nil, err
+	}
+
+	return response.playlistPanel()
+}
+
+// videos converts the playlistPanelVideoRenderer items of a playlist panel
+// into video results
+func (p *playlistPanel) videos(proxy thumbnailProxy) []models.VideoResult {
+	videos := make([]models.VideoResult, 0, len(p.Contents))
+	for _, item := range p.Contents {
+		r := item.PlaylistPanelVideoRenderer
+		if r == nil || r.VideoID == "" {
+			continue
+		}
+
+		videos = append(videos, models.VideoResult{
+			ID:          r.VideoID,
+			Title:       r.Title.String(),
+			Author:      r.ShortBylineText.First(),
+			Duration:    r.LengthText.String(),
+			DurationSec: parseClockDuration(r.LengthText.String()),
+			Thumbnails:  r.Thumbnail.convert(proxy),
+		})
+	}
+	return videos
+}
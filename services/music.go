@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"musiq/models"
+)
+
+// musicSearchParams are the WEB_REMIX search params that restrict results to a
+// single shelf type
+var musicSearchParams = map[string]string{
+	"songs":     "EgWKAQIIAWoKEAMQBBAJEAoQBQ%3D%3D",
+	"albums":    "EgWKAQIYAWoKEAMQBBAJEAoQBQ%3D%3D",
+	"artists":   "EgWKAQIgAWoKEAMQBBAJEAoQBQ%3D%3D",
+	"playlists": "EgWKAQIoAWoKEAMQBBAJEAoQBQ%3D%3D",
+}
+
+// Music page and video types used to classify list items
+const (
+	musicPageTypeAlbum    = "MUSIC_PAGE_TYPE_ALBUM"
+	musicPageTypeArtist   = "MUSIC_PAGE_TYPE_ARTIST"
+	musicPageTypeChannel  = "MUSIC_PAGE_TYPE_USER_CHANNEL"
+	musicPageTypePlaylist = "MUSIC_PAGE_TYPE_PLAYLIST"
+	musicVideoTypeATV     = "MUSIC_VIDEO_TYPE_ATV"
+)
+
+var clockDurationRegex = regexp.MustCompile(`^\d+(:\d{2})+$`)
+
+// IsMusicSearchFilter reports whether filter is a supported music search type
+func IsMusicSearchFilter(filter string) bool {
+	_, ok := musicSearchParams[filter]
+	return ok
+}
+
+// SearchMusic searches YouTube Music for songs, albums, artists and playlists.
+// An empty filter returns every shelf; otherwise filter must be one of songs,
+// albums, artists or playlists.
+func (s *YouTubeService) SearchMusic(ctx context.Context, query, filter string) (*models.MusicSearchResponse, error) {
+	payload := map[string]interface{}{
+		"context": s.music.innertubeContext(),
+		"query":   query,
+	}
+	if filter != "" {
+		params, ok := musicSearchParams[filter]
+		if !ok {
+			return nil, fmt.Errorf("unknown music search filter %q", filter)
+		}
+		payload["params"] = params
+	}
+
+	var result musicSearchResponse
+	if err := s.music.request(ctx, "search", payload, &result); err != nil {
+		return nil, err
+	}
+
+	items, err := result.listItems()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.MusicSearchResponse{
+		Query:     query,
+		Songs:     []models.MusicSong{},
+		Albums:    []models.MusicAlbum{},
+		Artists:   []models.MusicArtist{},
+		Playlists: []models.MusicPlaylist{},
+	}
+
+	for _, item := range items {
+		addMusicItem(response, item, s.thumbnailProxy)
+	}
+
+	return response, nil
+}
+
+// addMusicItem classifies a list item and appends it to the matching result list
+func addMusicItem(response *models.MusicSearchResponse, item *musicListItem, proxy thumbnailProxy) {
+	if len(item.FlexColumns) == 0 || len(item.FlexColumns[0].MusicResponsiveListItemFlexColumnRenderer.Text.Runs) == 0 {
+		return
+	}
+
+	title := item.FlexColumns[0].MusicResponsiveListItemFlexColumnRenderer.Text.Runs[0]
+	var details []itRun
+	if len(item.FlexColumns) > 1 {
+		details = item.FlexColumns[1].MusicResponsiveListItemFlexColumnRenderer.Text.Runs
+	}
+	thumbnails := item.Thumbnail.MusicThumbnailRenderer.Thumbnail.convert(proxy)
+
+	// Songs and videos carry a watch endpoint on their title, or at least
+	// the video ID in playlistItemData
+	var watch *itWatchEndpoint
+	if title.NavigationEndpoint != nil {
+		watch = title.NavigationEndpoint.WatchEndpoint
+	}
+	videoID := ""
+	if watch != nil {
+		videoID = watch.VideoID
+	} else if item.PlaylistItemData != nil {
+		videoID = item.PlaylistItemData.VideoID
+	}
+
+	if videoID != "" {
+		song := models.MusicSong{
+			ID:         videoID,
+			Title:      title.Text,
+			Artists:    []models.MusicRef{},
+			VideoType:  "video",
+			Thumbnails: thumbnails,
+		}
+		if watch != nil && watch.WatchEndpointMusicSupportedConfigs.WatchEndpointMusicConfig.MusicVideoType == musicVideoTypeATV {
+			song.VideoType = "song"
+			song.AudioID = videoID
+		}
+		parseSongDetails(&song, details)
+		response.Songs = append(response.Songs, song)
+		return
+	}
+
+	// Everything else links to a browse page
+	browseID := item.NavigationEndpoint.browseID()
+
+	switch item.NavigationEndpoint.pageType() {
+	case musicPageTypeAlbum:
+		album := models.MusicAlbum{
+			ID:         browseID,
+			Title:      title.Text,
+			Type:       "Album",
+			Artists:    []models.MusicRef{},
+			Thumbnails: thumbnails,
+		}
+		parseAlbumDetails(&album, details)
+		response.Albums = append(response.Albums, album)
+
+	case musicPageTypeArtist, musicPageTypeChannel:
+		artist := models.MusicArtist{
+			ID:         browseID,
+			Name:       title.Text,
+			Thumbnails: thumbnails,
+		}
+		for _, text := range musicPlainTexts(details) {
+			if strings.Contains(text, "subscriber") || strings.Contains(text, "audience") {
+				artist.Subscribers = text
+			}
+		}
+		response.Artists = append(response.Artists, artist)
+
+	case musicPageTypePlaylist:
+		playlist := models.MusicPlaylist{
+			// Browse IDs of playlists are the playlist ID prefixed with VL
+			ID:         strings.TrimPrefix(browseID, "VL"),
+			Title:      title.Text,
+			Thumbnails: thumbnails,
+		}
+		for _, text := range musicPlainTexts(details) {
+			switch {
+			case isMusicTypeLabel(text):
+			case strings.HasSuffix(text, "songs") || strings.HasSuffix(text, "views") || strings.HasSuffix(text, "tracks"):
+				playlist.ItemCount = text
+			case playlist.Author == "":
+				playlist.Author = text
+			}
+		}
+		response.Playlists = append(response.Playlists, playlist)
+	}
+}
+
+// parseSongDetails reads artists, album and duration from a song's second
+// column: [type •] artist [& artist] • album • 3:45
+func parseSongDetails(song *models.MusicSong, runs []itRun) {
+	for i, run := range runs {
+		text := run.Text
+		if isMusicSeparator(text) {
+			continue
+		}
+
+		switch run.NavigationEndpoint.pageType() {
+		case musicPageTypeArtist, musicPageTypeChannel:
+			song.Artists = append(song.Artists, models.MusicRef{ID: run.NavigationEndpoint.browseID(), Name: text})
+			continue
+		case musicPageTypeAlbum:
+			song.Album = &models.MusicRef{ID: run.NavigationEndpoint.browseID(), Name: text}
+			continue
+		}
+
+		switch {
+		case clockDurationRegex.MatchString(text):
+			song.Duration = text
+			song.DurationSec = parseClockDuration(text)
+		case i == 0 && isMusicTypeLabel(text):
+		case strings.HasSuffix(text, "views") || strings.HasSuffix(text, "plays"):
+		case song.Album == nil && song.Duration == "":
+			// Artists without a channel link are plain text
+			song.Artists = append(song.Artists, models.MusicRef{Name: text})
+		}
+	}
+}
+
+// parseAlbumDetails reads type, artists and year from an album's second
+// column: Album • artist • 2021
+func parseAlbumDetails(album *models.MusicAlbum, runs []itRun) {
+	for i, run := range runs {
+		text := run.Text
+		if isMusicSeparator(text) {
+			continue
+		}
+
+		if pageType := run.NavigationEndpoint.pageType(); pageType == musicPageTypeArtist || pageType == musicPageTypeChannel {
+			album.Artists = append(album.Artists, models.MusicRef{ID: run.NavigationEndpoint.browseID(), Name: text})
+			continue
+		}
+
+		switch {
+		case i == 0 && isMusicTypeLabel(text):
+			album.Type = text
+		case len(text) == 4 && isDigits(text):
+			album.Year = text
+		default:
+			album.Artists = append(album.Artists, models.MusicRef{Name: text})
+		}
+	}
+}
+
+// musicPlainTexts returns the texts of runs that are neither separators nor links
+func musicPlainTexts(runs []itRun) []string {
+	texts := make([]string, 0, len(runs))
+	for _, run := range runs {
+		if isMusicSeparator(run.Text) || run.NavigationEndpoint != nil {
+			continue
+		}
+		texts = append(texts, run.Text)
+	}
+	return texts
+}
+
+func isMusicSeparator(text string) bool {
+	switch strings.TrimSpace(text) {
+	case "", "•", "&", ",":
+		return true
+	}
+	return false
+}
+
+func isMusicTypeLabel(text string) bool {
+	switch text {
+	case "Song", "Video", "Album", "Single", "EP", "Artist", "Playlist", "Profile":
+		return true
+	}
+	return false
+}
+
+func isDigits(text string) bool {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return text != ""
+}
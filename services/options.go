@@ -0,0 +1,433 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"musiq/config"
+)
+
+// youtubeHosts are the hosts rewritten to the configured base URL. Stream
+// URLs on googlevideo.com come from the player response, so a stand-in
+// server controls them by returning its own URLs.
+var youtubeHosts = map[string]bool{
+	"youtube.com":       true,
+	"www.youtube.com":   true,
+	"m.youtube.com":     true,
+	"music.youtube.com": true,
+}
+
+// Option configures a YouTubeService
+type Option func(*serviceConfig)
+
+type serviceConfig struct {
+	httpClient         *http.Client
+	baseURL            string
+	musicBaseURL       string
+	timeout            time.Duration
+	userAgent          string
+	clientVersion      string
+	musicClientVersion string
+	hl                 string
+	gl                 string
+	searchCacheTTL     time.Duration
+	playlistCacheTTL   time.Duration
+	cacheStaleTTL      time.Duration
+	videoCacheSize     int
+	responseCacheSize  int
+	thumbnailBaseURL   string
+	suggestBaseURL     string
+	thumbnailProxyURL  string
+	retryAttempts      int
+	retryBackoff       time.Duration
+	playerClients      []string
+}
+
+// defaultServiceConfig applies the configuration defaults, so a service
+// created without options behaves like a server started without settings
+func defaultServiceConfig() serviceConfig {
+	defaults := config.Default().YouTube
+	return serviceConfig{
+		httpClient:         http.DefaultClient,
+		timeout:            defaults.Timeout,
+		userAgent:          defaults.UserAgent,
+		clientVersion:      defaults.ClientVersion,
+		musicClientVersion: defaults.MusicClientVersion,
+		hl:                 defaults.HL,
+		gl:                 defaults.GL,
+		searchCacheTTL:     defaults.SearchCacheTTL,
+		playlistCacheTTL:   defaults.PlaylistCacheTTL,
+		cacheStaleTTL:      defaults.CacheStaleTTL,
+		videoCacheSize:     defaults.VideoCacheSize,
+		responseCacheSize:  defaults.ResponseCacheSize,
+		thumbnailBaseURL:   defaults.ThumbnailBaseURL,
+		suggestBaseURL:     defaults.SuggestBaseURL,
+		retryAttempts:      defaults.RetryAttempts,
+		retryBackoff:       defaults.RetryBackoff,
+		playerClients:      defaults.PlayerClients,
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all upstream requests,
+// including media streams, so its Timeout should be left at zero; use
+// WithTimeout to bound API calls instead
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *serviceConfig) {
+		if client != nil {
+			c.httpClient = client
+		}
+	}
+}
+
+// WithBaseURL points every youtube.com request, InnerTube API and player
+// alike, at another server such as a proxy or a local stand-in
+func WithBaseURL(baseURL string) Option {
+	return func(c *serviceConfig) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithMusicBaseURL points YouTube Music API requests at another server.
+// It defaults to the base URL when one is set.
+func WithMusicBaseURL(baseURL string) Option {
+	return func(c *serviceConfig) {
+		c.musicBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithThumbnailBaseURL points thumbnail requests, normally sent to
+// i.ytimg.com, at another server
+func WithThumbnailBaseURL(baseURL string) Option {
+	return func(c *serviceConfig) {
+		if baseURL != "" {
+			c.thumbnailBaseURL = strings.TrimSuffix(baseURL, "/")
+		}
+	}
+}
+
+// WithThumbnailProxyURL makes result thumbnails point at the thumbnail
+// proxy, such as "/api/thumb", instead of i.ytimg.com
+func WithThumbnailProxyURL(proxyURL string) Option {
+	return func(c *serviceConfig) {
+		c.thumbnailProxyURL = strings.TrimSuffix(proxyURL, "/")
+	}
+}
+
+// WithSuggestBaseURL points search completion requests, normally sent to
+// suggestqueries.google.com, at another server
+func WithSuggestBaseURL(baseURL string) Option {
+	return func(c *serviceConfig) {
+		if baseURL != "" {
+			c.suggestBaseURL = strings.TrimSuffix(baseURL, "/")
+		}
+	}
+}
+
+// WithTimeout bounds each API and metadata request. Media streams are not
+// bounded, since a song can take longer than any sensible API timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *serviceConfig) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with InnerTube API requests.
+// Player requests keep the user agent of the client they impersonate.
+func WithUserAgent(userAgent string) Option {
+	return func(c *serviceConfig) {
+		if userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// WithClientVersion sets the WEB InnerTube client version
+func WithClientVersion(version string) Option {
+	return func(c *serviceConfig) {
+		if version != "" {
+			c.clientVersion = version
+		}
+	}
+}
+
+// WithMusicClientVersion sets the WEB_REMIX InnerTube client version
+func WithMusicClientVersion(version string) Option {
+	return func(c *serviceConfig) {
+		if version != "" {
+			c.musicClientVersion = version
+		}
+	}
+}
+
+// WithLocale sets the interface language (hl) and content region (gl) sent
+// with InnerTube requests
+func WithLocale(hl, gl string) Option {
+	return func(c *serviceConfig) {
+		if hl != "" {
+			c.hl = hl
+		}
+		if gl != "" {
+			c.gl = gl
+		}
+	}
+}
+
+// WithSearchCacheTTL sets how long search results are served from cache.
+// Zero disables the cache.
+func WithSearchCacheTTL(ttl time.Duration) Option {
+	return func(c *serviceConfig) {
+		if ttl >= 0 {
+			c.searchCacheTTL = ttl
+		}
+	}
+}
+
+// WithPlaylistCacheTTL sets how long playlists are served from cache. Zero
+// disables the cache.
+func WithPlaylistCacheTTL(ttl time.Duration) Option {
+	return func(c *serviceConfig) {
+		if ttl >= 0 {
+			c.playlistCacheTTL = ttl
+		}
+	}
+}
+
+// WithCacheStaleTTL sets how long an expired search or playlist entry is
+// still served while it is refreshed in the background. Zero makes callers
+// wait for the refresh.
+func WithCacheStaleTTL(ttl time.Duration) Option {
+	return func(c *serviceConfig) {
+		if ttl >= 0 {
+			c.cacheStaleTTL = ttl
+		}
+	}
+}
+
+// WithCacheSizes caps the number of cached player responses, and of
+// cached searches and playlists each. Values below one keep the defaults.
+func WithCacheSizes(videos, responses int) Option {
+	return func(c *serviceConfig) {
+		if videos > 0 {
+			c.videoCacheSize = videos
+		}
+		if responses > 0 {
+			c.responseCacheSize = responses
+		}
+	}
+}
+
+// WithRetryAttempts sets how many times a player request is tried with each
+// client before moving on to the next
+func WithRetryAttempts(attempts int) Option {
+	return func(c *serviceConfig) {
+		if attempts > 0 {
+			c.retryAttempts = attempts
+		}
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry; later retries
+// double it, with jitter
+func WithRetryBackoff(backoff time.Duration) Option {
+	return func(c *serviceConfig) {
+		if backoff >= 0 {
+			c.retryBackoff = backoff
+		}
+	}
+}
+
+// WithPlayerClients sets the InnerTube clients player requests fall back
+// across, in order: any of "android", "ios" and "tv"
+func WithPlayerClients(names ...string) Option {
+	return func(c *serviceConfig) {
+		if len(names) > 0 {
+			c.playerClients = names
+		}
+	}
+}
+
+// OptionsFromConfig returns the service options for a YouTube configuration
+func OptionsFromConfig(cfg config.YouTube) []Option {
+	return []Option{
+		WithBaseURL(cfg.BaseURL),
+		WithMusicBaseURL(cfg.MusicBaseURL),
+		WithThumbnailBaseURL(cfg.ThumbnailBaseURL),
+		WithSuggestBaseURL(cfg.SuggestBaseURL),
+		WithTimeout(cfg.Timeout),
+		WithUserAgent(cfg.UserAgent),
+		WithClientVersion(cfg.ClientVersion),
+		WithMusicClientVersion(cfg.MusicClientVersion),
+		WithLocale(cfg.HL, cfg.GL),
+		WithSearchCacheTTL(cfg.SearchCacheTTL),
+		WithPlaylistCacheTTL(cfg.PlaylistCacheTTL),
+		WithCacheStaleTTL(cfg.CacheStaleTTL),
+		WithCacheSizes(cfg.VideoCacheSize, cfg.ResponseCacheSize),
+		WithRetryAttempts(cfg.RetryAttempts),
+		WithRetryBackoff(cfg.RetryBackoff),
+		WithPlayerClients(cfg.PlayerClients...),
+	}
+}
+
+// retryPolicy returns the retry policy for player requests
+func (c serviceConfig) retryPolicy() retryPolicy {
+	clients := parsePlayerClients(c.playerClients)
+	if len(clients) == 0 {
+		clients = parsePlayerClients(config.Default().YouTube.PlayerClients)
+	}
+	return retryPolicy{
+		attempts: c.retryAttempts,
+		backoff:  c.retryBackoff,
+		clients:  clients,
+	}
+}
+
+// playerHTTPClient returns the HTTP client for the player library, which
+// hard-codes youtube.com URLs, an en/US locale and its InnerTube client.
+// Its requests are rewritten to the base URL, when one is set, and to the
+// locale and client of the calling service.
+func (c serviceConfig) playerHTTPClient() *http.Client {
+	transport := &playerTransport{next: c.httpClient.Transport}
+
+	if c.baseURL != "" {
+		target, err := url.Parse(c.baseURL)
+		if err != nil || target.Host == "" {
+			slog.Warn("Ignoring invalid YouTube base URL", "url", c.baseURL)
+		} else {
+			transport.target = target
+		}
+	}
+
+	client := *c.httpClient
+	client.Transport = transport
+	return &client
+}
+
+// playerTransport redirects youtube.com requests to another server, and
+// localizes InnerTube request bodies and sets their client identity
+type playerTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *playerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	client, hasClient := playerClientFromContext(req.Context())
+
+	if !youtubeHosts[req.URL.Hostname()] {
+		// Stream servers check that downloads come from the client that
+		// requested the player response
+		if hasClient {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", client.userAgent)
+		}
+		return t.roundTripper().RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+
+	if req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/youtubei/") {
+		locale, hasLocale := localeFromContext(req.Context())
+		isPlayer := hasClient && req.URL.Path == "/youtubei/v1/player"
+		if hasLocale || isPlayer {
+			err := rewriteBody(req, func(ctx, c map[string]interface{}) {
+				if hasLocale {
+					localize(c, locale)
+				}
+				if isPlayer {
+					impersonate(ctx, c, client)
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if isPlayer {
+			req.Header.Set("User-Agent", client.userAgent)
+			req.Header.Set("X-Youtube-Client-Name", client.nameID)
+			req.Header.Set("X-Youtube-Client-Version", client.version)
+		}
+	}
+
+	if t.target != nil {
+		req.URL.Scheme = t.target.Scheme
+		req.URL.Host = t.target.Host
+		req.URL.Path = strings.TrimSuffix(t.target.Path, "/") + req.URL.Path
+		req.Host = t.target.Host
+	}
+
+	return t.roundTripper().RoundTrip(req)
+}
+
+func (t *playerTransport) roundTripper() http.RoundTripper {
+	if t.next != nil {
+		return t.next
+	}
+	return http.DefaultTransport
+}
+
+// rewriteBody lets edit change the context and context.client objects of an
+// InnerTube request body
+func rewriteBody(req *http.Request, edit func(ctx, client map[string]interface{})) error {
+	if req.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err == nil {
+		if ctx, ok := payload["context"].(map[string]interface{}); ok {
+			if client, ok := ctx["client"].(map[string]interface{}); ok {
+				edit(ctx, client)
+				if rewritten, err := json.Marshal(payload); err == nil {
+					data = rewritten
+				}
+			}
+		}
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// localize sets hl and gl in an InnerTube context.client
+func localize(client map[string]interface{}, locale Locale) {
+	if locale.HL != "" {
+		client["hl"] = locale.HL
+	}
+	if locale.GL != "" {
+		client["gl"] = locale.GL
+	}
+}
+
+// impersonate replaces the client identity of an InnerTube context
+func impersonate(ctx, c map[string]interface{}, client playerClient) {
+	c["clientName"] = client.name
+	c["clientVersion"] = client.version
+	c["userAgent"] = client.userAgent
+	delete(c, "androidSdkVersion")
+	delete(c, "deviceModel")
+	if client.deviceModel != "" {
+		c["deviceModel"] = client.deviceModel
+	}
+
+	delete(ctx, "thirdParty")
+	if client.embedded {
+		ctx["thirdParty"] = map[string]interface{}{"embedUrl": "https://www.youtube.com/"}
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// viewMultipliers maps the short-form suffixes YouTube uses for view counts,
+// across the locales we serve, to their value. A suffix only matches a whole
+// word, so "mil" is not read as "mi" or "m".
+var viewMultipliers = []struct {
+	suffix string
+	value  float64
+}{
+	{"mrd", 1e9},
+	{"bn", 1e9},
+	{"b", 1e9},
+	{"mio", 1e6},
+	{"mln", 1e6},
+	{"млн", 1e6},
+	{"mi", 1e6},
+	{"m", 1e6},
+	{"億", 1e8},
+	{"万", 1e4},
+	{"萬", 1e4},
+	{"тыс", 1e3},
+	{"tys", 1e3},
+	{"mil", 1e3},
+	{"k", 1e3},
+}
+
+// relativeUnits maps the first letters of relative time units, in the
+// locales we serve, to their approximate length
+var relativeUnits = []struct {
+	prefixes []string
+	unit     time.Duration
+}{
+	{[]string{"sec", "seg", "sek"}, time.Second},
+	{[]string{"min"}, time.Minute},
+	{[]string{"hour", "hora", "heure", "stunde"}, time.Hour},
+	{[]string{"day", "día", "dia", "jour", "tag"}, 24 * time.Hour},
+	{[]string{"week", "semana", "semaine", "woche"}, 7 * 24 * time.Hour},
+	{[]string{"month", "mes", "mês", "mois", "monat"}, 30 * 24 * time.Hour},
+	{[]string{"year", "año", "ano", "an", "jahr"}, 365 * 24 * time.Hour},
+}
+
+var (
+	// shortCountRegex matches "1.2M", "1,2 M", "12万" style counts
+	shortCountRegex = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*([^\d\s.,]+)`)
+	// relativeTimeRegex matches "3 years", "hace 2 días", "vor 5 Monaten"
+	relativeTimeRegex = regexp.MustCompile(`(\d+)\s+(\pL+)`)
+)
+
+// parseClockDuration converts a "h:mm:ss" or "m:ss" duration to seconds
+func parseClockDuration(text string) int {
+	seconds := 0
+	for _, part := range strings.Split(strings.TrimSpace(text), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// parseViewCount converts a view count display string such as
+// "1,234,567 views", "1.2M views", "1,2 M de visualizaciones" or "12万 回視聴"
+// to a number. It returns 0 when the text holds no count ("No views").
+func parseViewCount(text string) int64 {
+	lower := strings.ToLower(strings.TrimSpace(text))
+
+	// Short forms carry a multiplier suffix right after the number
+	if m := shortCountRegex.FindStringSubmatch(lower); m != nil {
+		for _, mult := range viewMultipliers {
+			if strings.HasPrefix(m[2], mult.suffix) && isSuffixEnd(m[2], mult.suffix) {
+				n, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+				if err != nil {
+					return 0
+				}
+				return int64(n * mult.value)
+			}
+		}
+	}
+
+	// Full counts use ",", "." or spaces as group separators depending on locale
+	digits := make([]rune, 0, len(lower))
+	started := false
+	for _, r := range lower {
+		switch {
+		case unicode.IsDigit(r):
+			digits = append(digits, r)
+			started = true
+		case started && (r == ',' || r == '.' || r == ' ' || r == ' ' || r == ' ' || r == '\''):
+		case started:
+			// Stop at the first word after the number
+			n, _ := strconv.ParseInt(string(digits), 10, 64)
+			return n
+		}
+	}
+
+	n, _ := strconv.ParseInt(string(digits), 10, 64)
+	return n
+}
+
+// isSuffixEnd reports whether suffix is a whole word at the start of word,
+// so "m" matches "m" and "m." but not "mil". CJK suffixes run straight into
+// the following word ("12万回視聴") and always match.
+func isSuffixEnd(word, suffix string) bool {
+	rest := word[len(suffix):]
+	if rest == "" {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(suffix)
+	if unicode.Is(unicode.Han, last) {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(rest)
+	return !unicode.IsLetter(next)
+}
+
+// parsePublishedTime converts a relative publish time such as "3 years ago"
+// or "Streamed 2 days ago" to an approximate timestamp relative to now.
+// It returns nil when the text can't be parsed.
+func parsePublishedTime(text string, now time.Time) *time.Time {
+	m := relativeTimeRegex.FindStringSubmatch(strings.ToLower(text))
+	if m == nil {
+		return nil
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil
+	}
+
+	for _, u := range relativeUnits {
+		for _, prefix := range u.prefixes {
+			if strings.HasPrefix(m[2], prefix) {
+				t := now.Add(-time.Duration(n) * u.unit).Truncate(time.Second)
+				return &t
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseViewCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int64
+	}{
+		{text: "1,234,567 views", want: 1234567},
+		{text: "1.2M views", want: 1200000},
+		{text: "3,4 Mio. Aufrufe", want: 3400000},
+		{text: "12K views", want: 12000},
+		{text: "1.2B views", want: 1200000000},
+		{text: "2,5 mil visualizações", want: 2500},
+		{text: "1,2 M de visualizaciones", want: 1200000},
+		{text: "12万 回視聴", want: 120000},
+		{text: "1.234 Aufrufe", want: 1234},
+		{text: "1 234 просмотра", want: 1234},
+		{text: "No views", want: 0},
+		{text: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseViewCount(tt.text); got != tt.want {
+				t.Errorf("parseViewCount(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePublishedTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		text string
+		// ago is how long before now the result is, or 0 for no result
+		ago time.Duration
+	}{
+		{text: "30 seconds ago", ago: 30 * time.Second},
+		{text: "1 minute ago", ago: time.Minute},
+		{text: "5 hours ago", ago: 5 * time.Hour},
+		{text: "Streamed 2 days ago", ago: 2 * day},
+		{text: "3 weeks ago", ago: 21 * day},
+		{text: "4 months ago", ago: 120 * day},
+		{text: "3 years ago", ago: 3 * 365 * day},
+		{text: "hace 2 semanas", ago: 14 * day},
+		{text: "vor 5 Monaten", ago: 150 * day},
+		{text: "il y a 1 an", ago: 365 * day},
+		{text: "Premieres soon"},
+		{text: "5 fortnights ago"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := parsePublishedTime(tt.text, now)
+			if tt.ago == 0 {
+				if got != nil {
+					t.Errorf("parsePublishedTime(%q) = %v, want nil", tt.text, got)
+				}
+				return
+			}
+			if want := now.Add(-tt.ago); got == nil || !got.Equal(want) {
+				t.Errorf("parsePublishedTime(%q) = %v, want %v", tt.text, got, want)
+			}
+		})
+	}
+}
+
+func TestParseClockDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "3:45", want: 225},
+		{text: "1:02:03", want: 3723},
+		{text: "0:07", want: 7},
+		{text: " 4:05 ", want: 245},
+		{text: "45", want: 45},
+		{text: "LIVE", want: 0},
+		{text: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseClockDuration(tt.text); got != tt.want {
+				t.Errorf("parseClockDuration(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package services
+
+import "syscall"
+
+// childProcAttr has the kernel kill ffmpeg if the server dies without
+// terminating it, so a crash doesn't leave orphans behind
+func childProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package services
+
+import "syscall"
+
+// childProcAttr leaves ffmpeg to exit on its own on platforms without a
+// parent death signal; its pipes close when the server dies
+func childProcAttr() *syscall.SysProcAttr {
+	return nil
+}
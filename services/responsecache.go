@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"musiq/logging"
+	"musiq/models"
+)
+
+// responseCache caches upstream responses with stale-while-revalidate:
+// fresh entries are returned as is, stale ones are returned while a single
+// background fetch refreshes them, and concurrent misses for the same key
+// share one fetch. A TTL of zero disables caching but keeps coalescing.
+//
+// A shared fetch is cancelled once every caller waiting on it is gone, and
+// refreshes outlive the request that triggered them. Both keep the values
+// of the first caller's context, such as its logger.
+type responseCache[T any] struct {
+	name     string
+	ttl      time.Duration
+	staleTTL time.Duration
+	// maxEntries caps the cache; the entry closest to expiry is evicted
+	// first
+	maxEntries int
+
+	mu       sync.Mutex
+	entries  map[string]*responseCacheEntry[T]
+	inflight map[string]*responseCall[T]
+
+	hits      atomic.Int64
+	staleHits atomic.Int64
+	misses    atomic.Int64
+}
+
+type responseCacheEntry[T any] struct {
+	value      T
+	fresh      time.Time
+	staleUntil time.Time
+	refreshing bool
+}
+
+// responseCall is a fetch shared by every caller that missed on its key
+type responseCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+	// waiters counts the callers still waiting, under the cache's mutex
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newResponseCache[T any](name string, ttl, staleTTL time.Duration, maxEntries int) *responseCache[T] {
+	return &responseCache[T]{
+		name:       name,
+		ttl:        ttl,
+		staleTTL:   staleTTL,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*responseCacheEntry[T]),
+		inflight:   make(map[string]*responseCall[T]),
+	}
+}
+
+// get returns the cached value for key, calling fetch when there is none.
+// It returns early with ctx's error when ctx ends first.
+func (c *responseCache[T]) get(ctx context.Context, key string, fetch func(context.Context) (T, error)) (T, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		switch {
+		case now.Before(entry.fresh):
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return entry.value, nil
+		case now.Before(entry.staleUntil):
+			if !entry.refreshing {
+				entry.refreshing = true
+				go c.refresh(context.WithoutCancel(ctx), key, fetch)
+			}
+			c.mu.Unlock()
+			c.staleHits.Add(1)
+			return entry.value, nil
+		default:
+			delete(c.entries, key)
+		}
+	}
+	c.misses.Add(1)
+
+	call, ok := c.inflight[key]
+	if ok {
+		call.waiters++
+	} else {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &responseCall[T]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.inflight[key] = call
+		go c.fetch(fetchCtx, key, call, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+		}
+		c.mu.Unlock()
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// fetch runs a shared fetch and stores its value
+func (c *responseCache[T]) fetch(ctx context.Context, key string, call *responseCall[T], fetch func(context.Context) (T, error)) {
+	defer call.cancel()
+
+	call.value, call.err = fetch(ctx)
+	if call.err == nil {
+		c.store(key, call.value)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// refresh replaces a stale entry. On failure the stale value keeps being
+// served until it runs out of stale time.
+func (c *responseCache[T]) refresh(ctx context.Context, key string, fetch func(context.Context) (T, error)) {
+	value, err := fetch(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to refresh cache entry", "cache", c.name, "key", key, "error", err)
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok {
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, value)
+}
+
+func (c *responseCache[T]) store(key string, value T) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.staleUntil) {
+			delete(c.entries, k)
+		}
+	}
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, entry := range c.entries {
+			if oldest == "" || entry.staleUntil.Before(c.entries[oldest].staleUntil) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = &responseCacheEntry[T]{
+		value:      value,
+		fresh:      now.Add(c.ttl),
+		staleUntil: now.Add(c.ttl + c.staleTTL),
+	}
+}
+
+// stats returns the cache's counters since startup. Stale hits count
+// towards the hit rate since they didn't wait on the upstream.
+func (c *responseCache[T]) stats() models.CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := models.CacheStats{
+		Entries:   entries,
+		Hits:      c.hits.Load(),
+		StaleHits: c.staleHits.Load(),
+		Misses:    c.misses.Load(),
+	}
+	if lookups := stats.Hits + stats.StaleHits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits+stats.StaleHits) / float64(lookups)
+	}
+	return stats
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFetch returns a fetch that counts its calls and returns value
+func countingFetch(calls *atomic.Int64, value string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		calls.Add(1)
+		return value, nil
+	}
+}
+
+// expire moves an entry's fresh and stale deadlines by d into the past
+func expire(c *responseCache[string], key string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	entry.fresh = entry.fresh.Add(-d)
+	entry.staleUntil = entry.staleUntil.Add(-d)
+}
+
+func TestResponseCacheGet(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// age is how far the first value is moved into the past before the
+		// second lookup
+		age time.Duration
+		// want is the value of the second lookup, and fetches the number
+		// of fetches once any refresh is done
+		want    string
+		fetches int64
+	}{
+		{name: "fresh", ttl: time.Minute, want: "first", fetches: 1},
+		// Stale entries are served while a refresh runs in the background
+		{name: "stale", ttl: time.Minute, age: 2 * time.Minute, want: "first", fetches: 2},
+		{name: "expired", ttl: time.Minute, age: 2 * time.Hour, want: "second", fetches: 2},
+		{name: "disabled", want: "second", fetches: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newResponseCache[string]("test", tt.ttl, time.Hour, 10)
+			ctx := context.Background()
+			var calls atomic.Int64
+
+			if _, err := c.get(ctx, "k", countingFetch(&calls, "first")); err != nil {
+				t.Fatalf("get() error = %v", err)
+			}
+			if tt.age > 0 {
+				expire(c, "k", tt.age)
+			}
+			got, err := c.get(ctx, "k", countingFetch(&calls, "second"))
+			if err != nil || got != tt.want {
+				t.Fatalf("get() = %q, %v, want %q", got, err, tt.want)
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for calls.Load() < tt.fetches && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if n := calls.Load(); n != tt.fetches {
+				t.Errorf("fetches = %d, want %d", n, tt.fetches)
+			}
+		})
+	}
+}
+
+func TestResponseCacheRefresh(t *testing.T) {
+	c := newResponseCache[string]("test", time.Minute, time.Hour, 10)
+	ctx := context.Background()
+	var calls atomic.Int64
+
+	c.get(ctx, "k", countingFetch(&calls, "first"))
+	expire(c, "k", 2*time.Minute)
+
+	refreshed := make(chan struct{})
+	release := make(chan struct{})
+	refresh := func(context.Context) (string, error) {
+		calls.Add(1)
+		close(refreshed)
+		<-release
+		return "second", nil
+	}
+
+	// Lookups during the refresh get the stale value and start no fetch of
+	// their own
+	for range 3 {
+		if got, _ := c.get(ctx, "k", refresh); got != "first" {
+			t.Fatalf("get() during refresh = %q, want first", got)
+		}
+	}
+	<-refreshed
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		refreshing := c.entries["k"].refreshing
+		c.mu.Unlock()
+		if !refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got, _ := c.get(ctx, "k", countingFetch(&calls, "third")); got != "second" {
+		t.Errorf("get() after refresh = %q, want second", got)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+	if stats := c.stats(); stats.StaleHits != 3 {
+		t.Errorf("stats = %+v, want 3 stale hits", stats)
+	}
+}
+
+func TestResponseCacheRefreshFailure(t *testing.T) {
+	c := newResponseCache[string]("test", time.Minute, time.Hour, 10)
+	ctx := context.Background()
+
+	c.get(ctx, "k", func(context.Context) (string, error) { return "first", nil })
+	expire(c, "k", 2*time.Minute)
+
+	failed := make(chan struct{})
+	c.get(ctx, "k", func(context.Context) (string, error) {
+		defer close(failed)
+		return "", errors.New("upstream down")
+	})
+	<-failed
+
+	// The stale value is kept and the next lookup tries again
+	retried := make(chan struct{})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		got, _ := c.get(ctx, "k", func(context.Context) (string, error) {
+			close(retried)
+			return "second", nil
+		})
+		if got != "first" {
+			t.Fatalf("get() after failed refresh = %q, want first", got)
+		}
+		select {
+		case <-retried:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("no refresh after the failed one")
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	tests := []struct {
+		name string
+		// cancelled is how many of the waiters give up before the fetch
+		// returns
+		waiters, cancelled int
+		// fetchCancelled means the shared fetch's context ends
+		fetchCancelled bool
+	}{
+		{name: "all wait", waiters: 3},
+		{name: "some give up", waiters: 3, cancelled: 2},
+		{name: "all give up", waiters: 3, cancelled: 3, fetchCancelled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newResponseCache[string]("test", time.Minute, time.Hour, 10)
+			var calls atomic.Int64
+			started := make(chan struct{})
+			release := make(chan struct{})
+			fetchErr := make(chan error, 1)
+			fetch := func(ctx context.Context) (string, error) {
+				if calls.Add(1) == 1 {
+					close(started)
+				}
+				select {
+				case <-release:
+					fetchErr <- nil
+					return "value", nil
+				case <-ctx.Done():
+					fetchErr <- ctx.Err()
+					return "", ctx.Err()
+				}
+			}
+
+			type result struct {
+				value string
+				err   error
+			}
+			results := make(chan result, tt.waiters)
+			cancels := make([]context.CancelFunc, tt.waiters)
+			for i := range tt.waiters {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancels[i] = cancel
+				go func() {
+					value, err := c.get(ctx, "k", fetch)
+					results <- result{value, err}
+				}()
+				if i == 0 {
+					<-started
+				}
+			}
+			// Wait until every caller joined the shared fetch
+			deadline := time.Now().Add(time.Second)
+			for time.Now().Before(deadline) {
+				c.mu.Lock()
+				waiters := c.inflight["k"].waiters
+				c.mu.Unlock()
+				if waiters == tt.waiters {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			for i := range tt.cancelled {
+				cancels[i]()
+				if r := <-results; !errors.Is(r.err, context.Canceled) {
+					t.Errorf("cancelled get() = %q, %v, want context.Canceled", r.value, r.err)
+				}
+			}
+			if !tt.fetchCancelled {
+				close(release)
+			}
+			for range tt.waiters - tt.cancelled {
+				if r := <-results; r.err != nil || r.value != "value" {
+					t.Errorf("get() = %q, %v, want value", r.value, r.err)
+				}
+			}
+			for _, cancel := range cancels {
+				cancel()
+			}
+
+			if err := <-fetchErr; (err != nil) != tt.fetchCancelled {
+				t.Errorf("fetch ended with %v, want cancelled %v", err, tt.fetchCancelled)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("fetches = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	c := newResponseCache[string]("test", time.Minute, time.Hour, 2)
+	ctx := context.Background()
+	var calls atomic.Int64
+
+	c.get(ctx, "a", countingFetch(&calls, "a"))
+	c.get(ctx, "b", countingFetch(&calls, "b"))
+	// a is now closest to running out of stale time
+	expire(c, "a", time.Second)
+	c.get(ctx, "c", countingFetch(&calls, "c"))
+
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		c.mu.Lock()
+		_, ok := c.entries[key]
+		c.mu.Unlock()
+		if ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
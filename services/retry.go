@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"musiq/logging"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const maxRetryBackoff = 5 * time.Second
+
+// playerClient is an InnerTube client identity for player requests. YouTube
+// applies different restrictions per client, so a video refused to one is
+// often playable with another.
+type playerClient struct {
+	name        string
+	nameID      string
+	version     string
+	userAgent   string
+	deviceModel string
+	// embedded clients claim to play inside a third-party page
+	embedded bool
+}
+
+// playerClients are the supported fallbacks by their youtube.playerClients
+// name, which config.PlayerClients lists for validation
+var playerClients = map[string]playerClient{
+	"android": {
+		name:      "ANDROID",
+		nameID:    "3",
+		version:   "20.10.38",
+		userAgent: "com.google.android.youtube/20.10.38 (Linux; U; Android 11) gzip",
+	},
+	"ios": {
+		name:        "IOS",
+		nameID:      "5",
+		version:     "19.45.4",
+		userAgent:   "com.google.ios.youtube/19.45.4 (iPhone16,2; U; CPU iOS 18_1_0 like Mac OS X;)",
+		deviceModel: "iPhone16,2",
+	},
+	"tv": {
+		name:      "TVHTML5_SIMPLY_EMBEDDED_PLAYER",
+		nameID:    "85",
+		version:   "2.0",
+		userAgent: "Mozilla/5.0 (PlayStation; PlayStation 4/12.00) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.4 Safari/605.1.15",
+		embedded:  true,
+	},
+}
+
+// retryPolicy retries failed player requests: transient failures with the
+// same client after a jittered backoff, client-specific refusals with the
+// next client
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	clients  []playerClient
+}
+
+type retryAction int
+
+const (
+	retrySameClient retryAction = iota
+	retryNextClient
+	giveUp
+)
+
+// run calls fetch with each client from the one at index from on, and
+// returns the video with the index of the client that fetched it. Failures
+// are logged with the logger of ctx.
+func (p retryPolicy) run(ctx context.Context, videoID string, from int, fetch func(playerClient) (*youtube.Video, error)) (*youtube.Video, int, error) {
+	logger := logging.FromContext(ctx)
+	var lastErr error
+	for i := from; i < len(p.clients); i++ {
+		client := p.clients[i]
+		for attempt := 0; attempt < p.attempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(p.delay(attempt))
+			}
+
+			video, err := fetch(client)
+			if err == nil {
+				return video, i, nil
+			}
+			lastErr = err
+
+			action := classifyPlayerError(err)
+			if action == giveUp {
+				return nil, i, err
+			}
+			if action == retryNextClient {
+				logger.Warn("Player request failed, trying next client",
+					"videoId", videoID, "client", client.name, "error", err)
+				break
+			}
+			logger.Warn("Player request failed",
+				"videoId", videoID, "client", client.name, "attempt", attempt+1, "attempts", p.attempts, "error", err)
+		}
+	}
+	return nil, len(p.clients), lastErr
+}
+
+// delay returns an exponential backoff with jitter, so concurrent retries
+// don't hit the upstream in lockstep
+func (p retryPolicy) delay(attempt int) time.Duration {
+	backoff := min(p.backoff<<(attempt-1), maxRetryBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// classifyPlayerError decides how to retry a failed player request
+func classifyPlayerError(err error) retryAction {
+	var status youtube.ErrUnexpectedStatusCode
+	var playability *youtube.ErrPlayabiltyStatus
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrInvalidVideoRef),
+		errors.Is(err, youtube.ErrVideoPrivate),
+		errors.Is(err, youtube.ErrInvalidCharactersInVideoID),
+		errors.Is(err, youtube.ErrVideoIDMinLength):
+		return giveUp
+	case errors.As(err, &playability):
+		// ERROR is YouTube's status for removed or nonexistent videos
+		if playability.Status == "ERROR" {
+			return giveUp
+		}
+		return retryNextClient
+	case errors.As(err, &status):
+		if status == http.StatusTooManyRequests || status >= 500 {
+			return retrySameClient
+		}
+		return retryNextClient
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return retrySameClient
+	default:
+		// Login required, embedding disabled, cipher and signature errors
+		return retryNextClient
+	}
+}
+
+// isRefused reports whether a stream request was refused because its signed
+// URL expired or was rejected, which a fresh player response fixes
+func isRefused(err error) bool {
+	var status youtube.ErrUnexpectedStatusCode
+	return errors.As(err, &status) && status >= 400 && status < 500 && status != http.StatusTooManyRequests
+}
+
+// parsePlayerClients resolves youtube.playerClients names, skipping unknown
+// ones
+func parsePlayerClients(names []string) []playerClient {
+	clients := make([]playerClient, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		client, ok := playerClients[name]
+		if !ok {
+			slog.Warn("Ignoring unknown player client", "client", name)
+			continue
+		}
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+type playerClientContextKey struct{}
+
+// withPlayerClient attaches a client identity to a context so the player
+// transport can apply it to requests made by the player library
+func withPlayerClient(ctx context.Context, client playerClient) context.Context {
+	return context.WithValue(ctx, playerClientContextKey{}, client)
+}
+
+func playerClientFromContext(ctx context.Context) (playerClient, bool) {
+	client, ok := ctx.Value(playerClientContextKey{}).(playerClient)
+	return client, ok
+}
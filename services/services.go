@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+
+	"musiq/config"
+)
+
+// Services are the long-lived services built from the server
+// configuration. Handlers and the web UI share one set, so they share
+// caches and the library is only scanned once.
+type Services struct {
+	YouTube *YouTubeService
+	FFmpeg  *FFmpegService
+	Suggest *SuggestService
+	// History records submitted searches and completes queries from them
+	History *HistorySuggestProvider
+	Sources *Sources
+	// Thumbnails is nil when the thumbnail cache can't be created
+	Thumbnails *ThumbnailService
+	// Library is nil when no library directory is configured
+	Library *LocalLibrary
+	// APIKeys is nil when no key file is configured, which allows every
+	// request
+	APIKeys *APIKeyStore
+	Health  *Health
+}
+
+// New creates the services for cfg and starts their background work:
+// library rescans and thumbnail cache pruning. Muxing leftovers of earlier
+// processes are removed from the temp dir. It fails when FFmpeg or one of
+// its required encoders is missing, since no stream could be served.
+func New(cfg *config.Config) (*Services, error) {
+	opts := append(OptionsFromConfig(cfg.YouTube), WithThumbnailProxyURL(cfg.Thumbnails.ProxyURL))
+
+	s := &Services{
+		YouTube: NewYouTubeService(opts...),
+		FFmpeg:  NewFFmpegService(cfg.FFmpeg),
+		History: NewHistorySuggestProvider(historyLimit),
+	}
+	s.Suggest = NewSuggestService(cfg.Suggest.Provider, s.History, opts...)
+	ffmpegErr := s.FFmpeg.CheckInstalled()
+	if ffmpegErr != nil && !errors.Is(ffmpegErr, ErrWebPUnavailable) {
+		return nil, ffmpegErr
+	}
+
+	if cfg.Library.Dir != "" {
+		library, err := NewLocalLibrary(cfg.Library.Dir, s.FFmpeg.ProbePath())
+		if err != nil {
+			return nil, err
+		}
+		library.Watch(libraryRescanInterval)
+		s.Library = library
+	}
+	s.Sources = DefaultSources(s.YouTube, s.Library)
+
+	if cfg.Auth.KeysFile != "" {
+		keys, err := NewAPIKeyStore(cfg.Auth.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys.Watch(apiKeyReloadInterval)
+		s.APIKeys = keys
+	}
+
+	thumbnails, err := NewThumbnailService(cfg.Thumbnails.CacheDir, s.FFmpeg, opts...)
+	if err != nil {
+		slog.Warn("Thumbnail proxy disabled", "error", err)
+	} else {
+		thumbnails.Watch(thumbnailPruneInterval)
+		s.Thumbnails = thumbnails
+		if ffmpegErr != nil {
+			slog.Warn("WebP thumbnails unavailable", "error", ffmpegErr)
+		}
+	}
+	s.Health = NewHealth(s, cfg.FFmpeg.TempDir, cfg.Thumbnails.CacheDir)
+	if removed, err := s.FFmpeg.CleanupTempFiles(); err != nil {
+		slog.Error("Failed to clean up temp files", "error", err)
+	} else if removed > 0 {
+		slog.Info("Removed stale FIFOs and temp files", "count", removed)
+	}
+
+	return s, nil
+}
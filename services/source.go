@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"musiq/logging"
+	"musiq/models"
+)
+
+// ErrUnknownSource is returned for media IDs with an unregistered prefix
+var ErrUnknownSource = errors.New("unknown media source")
+
+// MediaSource is a catalogue of playable audio, such as YouTube or a local
+// music library. IDs passed to a source have its prefix removed, and
+// contexts carry the request logger.
+type MediaSource interface {
+	// Name is the source's ID prefix, as in "local:<id>"
+	Name() string
+	Search(ctx context.Context, query string, locale Locale) ([]models.VideoResult, error)
+	Info(ctx context.Context, id string, locale Locale) (*models.VideoInfo, error)
+	AudioStream(ctx context.Context, id string) (*AudioStream, error)
+	Playlist(ctx context.Context, id string, offset, limit int, locale Locale) (*models.Playlist, error)
+}
+
+// AudioStream is an open audio stream. MimeType is empty when the source
+// doesn't know the container, in which case callers should transcode.
+type AudioStream struct {
+	io.ReadCloser
+	MimeType string
+	Size     int64
+}
+
+// Sources routes source-prefixed media IDs to their source. IDs without a
+// prefix belong to the first source, so plain YouTube IDs keep working.
+type Sources struct {
+	sources []MediaSource
+	byName  map[string]MediaSource
+}
+
+// NewSources creates a registry of the given sources; nil sources are skipped
+func NewSources(sources ...MediaSource) *Sources {
+	s := &Sources{byName: make(map[string]MediaSource)}
+	for _, source := range sources {
+		if source == nil {
+			continue
+		}
+		s.sources = append(s.sources, source)
+		s.byName[source.Name()] = source
+	}
+	return s
+}
+
+// Resolve returns the source of a media ID and the ID within that source
+func (s *Sources) Resolve(id string) (MediaSource, string, error) {
+	if len(s.sources) == 0 {
+		return nil, "", ErrUnknownSource
+	}
+
+	if prefix, rest, ok := strings.Cut(id, ":"); ok && isSourceName(prefix) {
+		source, found := s.byName[prefix]
+		if !found {
+			return nil, "", fmt.Errorf("%w %q", ErrUnknownSource, prefix)
+		}
+		return source, rest, nil
+	}
+
+	return s.sources[0], id, nil
+}
+
+// Search queries every source and concatenates the results, secondary
+// sources first since a local match is usually what the user meant. An
+// error is only returned when every source fails.
+func (s *Sources) Search(ctx context.Context, query string, locale Locale) ([]models.VideoResult, error) {
+	results := make([]models.VideoResult, 0)
+	var primary []models.VideoResult
+	var lastErr error
+	failed := 0
+
+	for i, source := range s.sources {
+		found, err := source.Search(ctx, query, locale)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Search failed", "source", source.Name(), "error", err)
+			lastErr = err
+			failed++
+			continue
+		}
+		found = s.prefixed(source, found)
+		if i == 0 {
+			primary = found
+			continue
+		}
+		results = append(results, found...)
+	}
+
+	if failed == len(s.sources) && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return append(results, primary...), nil
+}
+
+// Info returns metadata for a source-prefixed media ID
+func (s *Sources) Info(ctx context.Context, id string, locale Locale) (*models.VideoInfo, error) {
+	source, localID, err := s.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := source.Info(ctx, localID, locale)
+	if err != nil {
+		return nil, err
+	}
+	info.ID = s.qualify(source, info.ID)
+	info.Source = source.Name()
+	return info, nil
+}
+
+// AudioStream opens the audio of a source-prefixed media ID
+func (s *Sources) AudioStream(ctx context.Context, id string) (*AudioStream, error) {
+	source, localID, err := s.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	return source.AudioStream(ctx, localID)
+}
+
+// Playlist returns a page of a source-prefixed playlist
+func (s *Sources) Playlist(ctx context.Context, id string, offset, limit int, locale Locale) (*models.Playlist, error) {
+	source, localID, err := s.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := source.Playlist(ctx, localID, offset, limit, locale)
+	if err != nil {
+		return nil, err
+	}
+	playlist.ID = s.qualify(source, playlist.ID)
+	playlist.Videos = s.prefixed(source, playlist.Videos)
+	return playlist, nil
+}
+
+// IsPrimary reports whether a media ID belongs to the first source
+func (s *Sources) IsPrimary(id string) bool {
+	source, _, err := s.Resolve(id)
+	return err == nil && source == s.sources[0]
+}
+
+// prefixed tags results with their source and qualifies the IDs of results
+// from a secondary source
+func (s *Sources) prefixed(source MediaSource, results []models.VideoResult) []models.VideoResult {
+	for i := range results {
+		results[i].ID = s.qualify(source, results[i].ID)
+		results[i].Source = source.Name()
+	}
+	return results
+}
+
+func (s *Sources) qualify(source MediaSource, id string) string {
+	if source == s.sources[0] || strings.HasPrefix(id, source.Name()+":") {
+		return id
+	}
+	return source.Name() + ":" + id
+}
+
+// isSourceName tells a source prefix from the scheme of a pasted URL
+func isSourceName(prefix string) bool {
+	if prefix == "" || prefix == "http" || prefix == "https" {
+		return false
+	}
+	for _, r := range prefix {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultSources returns YouTube as the primary source, followed by the
+// local library when there is one
+func DefaultSources(youtube *YouTubeService, library *LocalLibrary) *Sources {
+	sources := []MediaSource{youtube}
+	if library != nil {
+		sources = append(sources, library)
+	}
+	return NewSources(sources...)
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"musiq/logging"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	// maxStreamResumes bounds how often a stream is resumed after a failed
+	// read before the error reaches the caller
+	maxStreamResumes = 5
+	// resumeChunkSize is the size of each range request of a resumed stream.
+	// googlevideo.com throttles larger ranges.
+	resumeChunkSize = 10 << 20
+)
+
+// formatPicker chooses the format to stream from a player response
+type formatPicker func(*youtube.Video) (*youtube.Format, error)
+
+// openStream opens the format pick chooses. When no stream URL can be made
+// for it, such as when deciphering the signature fails, the video is
+// re-fetched with the remaining player clients. ctx carries the request
+// logger, which the stream keeps for logging resumes.
+func (s *YouTubeService) openStream(ctx context.Context, videoID string, pick formatPicker) (io.ReadCloser, *youtube.Video, *youtube.Format, int64, error) {
+	key := videoCacheKey(videoID, s.Locale())
+
+	video, client, err := s.video(ctx, videoID)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("failed to get video: %w", err)
+	}
+
+	for {
+		format, err := pick(video)
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+
+		stream, size, err := s.client.GetStreamContext(s.streamContext(client), video, format)
+		if err == nil {
+			return &resumableStream{
+				ctx:     ctx,
+				service: s,
+				key:     key,
+				videoID: videoID,
+				client:  client,
+				video:   video,
+				format:  format,
+				size:    size,
+				stream:  stream,
+			}, video, format, size, nil
+		}
+
+		if client+1 >= len(s.retry.clients) || classifyPlayerError(err) == giveUp {
+			return nil, nil, nil, 0, fmt.Errorf("failed to get stream: %w", err)
+		}
+		logging.FromContext(ctx).Warn("Stream request failed, trying next client",
+			"videoId", videoID, "client", s.retry.clients[client].name, "error", err)
+
+		s.videos.invalidate(key)
+		video, client, err = s.fetchVideo(ctx, key, videoID, client+1)
+		if err != nil {
+			return nil, nil, nil, 0, fmt.Errorf("failed to get video: %w", err)
+		}
+	}
+}
+
+// streamContext carries the locale and the player client that fetched a
+// video to its stream downloads. Streams are not bounded by the timeout.
+func (s *YouTubeService) streamContext(client int) context.Context {
+	ctx := withLocale(context.Background(), s.Locale())
+	return withPlayerClient(ctx, s.retry.clients[client])
+}
+
+// resumableStream is a stream that survives dropped connections and
+// refused URLs: a failed read is retried from the last byte delivered, with
+// a fresh player response when YouTube refused the signed URL. Errors only
+// reach the caller once maxStreamResumes is exhausted.
+type resumableStream struct {
+	// ctx carries the logger of the request that opened the stream
+	ctx     context.Context
+	service *YouTubeService
+	key     string
+	videoID string
+	client  int
+	video   *youtube.Video
+	format  *youtube.Format
+	// size is 0 when YouTube doesn't report the length
+	size int64
+
+	stream  io.ReadCloser
+	read    int64
+	resumes int
+}
+
+func (r *resumableStream) Read(p []byte) (int, error) {
+	for {
+		n, err := r.stream.Read(p)
+		r.read += int64(n)
+		// Readers repeat their error on the next call, so data is
+		// returned first
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		if err == io.EOF {
+			if r.size == 0 || r.read >= r.size {
+				return 0, io.EOF
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		if errors.Is(err, context.Canceled) || r.resumes >= maxStreamResumes {
+			return 0, err
+		}
+
+		r.resumes++
+		logger := logging.FromContext(r.ctx)
+		logger.Warn("Stream failed, resuming",
+			"videoId", r.videoID, "itag", r.format.ItagNo, "bytesRead", r.read,
+			"resume", r.resumes, "maxResumes", maxStreamResumes, "error", err)
+		if resumeErr := r.resume(isRefused(err)); resumeErr != nil {
+			logger.Error("Failed to resume stream", "videoId", r.videoID, "error", resumeErr)
+			return 0, err
+		}
+	}
+}
+
+func (r *resumableStream) Close() error {
+	return r.stream.Close()
+}
+
+// resume reopens the stream at the current offset, fetching a fresh player
+// response first when refresh is set. The refresh starts with the client
+// that fetched the refused response and falls back from there.
+func (r *resumableStream) resume(refresh bool) error {
+	r.stream.Close()
+	s := r.service
+	time.Sleep(s.retry.delay(r.resumes))
+
+	if refresh {
+		s.videos.invalidate(r.key)
+		video, client, err := s.fetchVideo(r.ctx, r.key, r.videoID, r.client)
+		if err != nil {
+			return err
+		}
+		format, err := r.sameFormat(video)
+		if err != nil {
+			return err
+		}
+		r.video, r.format, r.client = video, format, client
+	}
+
+	ctx := s.streamContext(r.client)
+	streamURL, err := s.client.GetStreamURLContext(ctx, r.video, r.format)
+	if err != nil {
+		return fmt.Errorf("failed to get stream URL: %w", err)
+	}
+
+	r.stream = &rangeReader{
+		ctx:    ctx,
+		client: s.client.HTTPClient,
+		url:    streamURL,
+		offset: r.read,
+		size:   r.size,
+	}
+	return nil
+}
+
+// sameFormat finds the format being streamed in a fresh player response
+func (r *resumableStream) sameFormat(video *youtube.Video) (*youtube.Format, error) {
+	audioTrack := audioTrackID(r.format)
+	for i := range video.Formats {
+		if video.Formats[i].ItagNo == r.format.ItagNo && audioTrackID(&video.Formats[i]) == audioTrack {
+			return &video.Formats[i], nil
+		}
+	}
+	return nil, fmt.Errorf("format %d no longer available", r.format.ItagNo)
+}
+
+// rangeReader downloads a stream from offset on in sequential chunks, using
+// the range parameter googlevideo.com accepts. Streams of unknown size are
+// requested with a Range header instead.
+type rangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	offset int64
+	size   int64
+
+	body      io.ReadCloser
+	bodyBytes int64
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if r.size > 0 && r.offset >= r.size {
+				return 0, io.EOF
+			}
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		r.bodyBytes += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+
+		r.body.Close()
+		r.body = nil
+		switch {
+		case r.size == 0:
+			return n, io.EOF
+		case n > 0:
+			return n, nil
+		case r.bodyBytes == 0:
+			// An empty chunk would be requested again forever
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// open requests the chunk starting at the current offset
+func (r *rangeReader) open() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create stream request: %w", err)
+	}
+	if r.size > 0 {
+		end := min(r.offset+resumeChunkSize, r.size) - 1
+		query := req.URL.Query()
+		query.Set("range", fmt.Sprintf("%d-%d", r.offset, end))
+		req.URL.RawQuery = query.Encode()
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return youtube.ErrUnexpectedStatusCode(resp.StatusCode)
+	}
+
+	// A server that ignored the Range header sent the stream from the start
+	if r.size == 0 && r.offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to skip to offset %d: %w", r.offset, err)
+		}
+	}
+
+	r.body = resp.Body
+	r.bodyBytes = 0
+	return nil
+}
+
+func audioTrackID(format *youtube.Format) string {
+	if format.AudioTrack == nil {
+		return ""
+	}
+	return format.AudioTrack.ID
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSuggestions caps how many completions are returned for a query
+	maxSuggestions = 10
+	// suggestCacheTTL is short so completions stay fresh while still
+	// absorbing the burst of identical requests a debounced input produces
+	suggestCacheTTL = 5 * time.Minute
+	// suggestTimeout caps the configured timeout for suggest requests, to
+	// keep the dropdown responsive when the upstream is slow
+	suggestTimeout = 2 * time.Second
+	// historyLimit bounds how many distinct queries the local history keeps
+	historyLimit = 1000
+)
+
+// SuggestProvider returns query completions for a partial search query.
+// Providers that can't localize ignore the locale.
+type SuggestProvider interface {
+	Suggest(ctx context.Context, query string, locale Locale) ([]string, error)
+}
+
+// SuggestService returns cached query completions from a chain of providers
+type SuggestService struct {
+	providers []SuggestProvider
+
+	mu    sync.Mutex
+	cache map[string]suggestCacheEntry
+}
+
+type suggestCacheEntry struct {
+	suggestions []string
+	expires     time.Time
+}
+
+// NewSuggestService creates a suggest service backed by the YouTube suggest
+// API with the search history as fallback. The "local" provider uses the
+// search history only, for offline deployments.
+func NewSuggestService(provider string, history *HistorySuggestProvider, opts ...Option) *SuggestService {
+	if provider == "local" {
+		return NewSuggestServiceWithProviders(history)
+	}
+	return NewSuggestServiceWithProviders(NewYouTubeSuggestProvider(opts...), history)
+}
+
+// NewSuggestServiceWithProviders creates a suggest service that merges
+// completions from the given providers in order
+func NewSuggestServiceWithProviders(providers ...SuggestProvider) *SuggestService {
+	return &SuggestService{
+		providers: providers,
+		cache:     make(map[string]suggestCacheEntry),
+	}
+}
+
+// Suggest returns completions for a partial query. Results from every
+// provider are merged in provider order with duplicates removed; an error is
+// only returned when all providers fail.
+func (s *SuggestService) Suggest(ctx context.Context, query string, locale Locale) ([]string, error) {
+	normalized := normalizeQuery(query)
+	if normalized == "" {
+		return []string{}, nil
+	}
+	key := locale.Key() + "|" + normalized
+
+	if cached, ok := s.cached(key); ok {
+		return cached, nil
+	}
+
+	suggestions := make([]string, 0, maxSuggestions)
+	seen := make(map[string]bool)
+	var lastErr error
+	failed := 0
+
+	for _, provider := range s.providers {
+		results, err := provider.Suggest(ctx, query, locale)
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, r := range results {
+			n := normalizeQuery(r)
+			if n == "" || seen[n] {
+				continue
+			}
+			seen[n] = true
+			suggestions = append(suggestions, r)
+			if len(suggestions) == maxSuggestions {
+				break
+			}
+		}
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+
+	if failed == len(s.providers) && lastErr != nil {
+		return nil, lastErr
+	}
+
+	s.store(key, suggestions)
+	return suggestions, nil
+}
+
+func (s *SuggestService) cached(key string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.cache, key)
+		return nil, false
+	}
+	return entry.suggestions, true
+}
+
+func (s *SuggestService) store(key string, suggestions []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Sweep expired entries so the cache does not grow with every keystroke
+	for k, entry := range s.cache {
+		if now.After(entry.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = suggestCacheEntry{
+		suggestions: suggestions,
+		expires:     now.Add(suggestCacheTTL),
+	}
+}
+
+// YouTubeSuggestProvider fetches completions from the YouTube suggest API
+type YouTubeSuggestProvider struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	userAgent  string
+}
+
+// NewYouTubeSuggestProvider creates a provider for the YouTube suggest API.
+// It honours the HTTP client, timeout, user agent and suggest base URL
+// options.
+func NewYouTubeSuggestProvider(opts ...Option) *YouTubeSuggestProvider {
+	cfg := defaultServiceConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &YouTubeSuggestProvider{
+		baseURL:    cfg.suggestBaseURL,
+		httpClient: instrumentedClient(cfg.httpClient),
+		timeout:    min(cfg.timeout, suggestTimeout),
+		userAgent:  cfg.userAgent,
+	}
+}
+
+// Suggest returns YouTube's completions for a partial query
+func (p *YouTubeSuggestProvider) Suggest(ctx context.Context, query string, locale Locale) ([]string, error) {
+	params := url.Values{}
+	// client=firefox returns plain JSON instead of a JSONP callback
+	params.Set("client", "firefox")
+	params.Set("ds", "yt")
+	params.Set("q", query)
+	if locale.HL != "" {
+		params.Set("hl", locale.HL)
+	}
+	if locale.GL != "" {
+		params.Set("gl", locale.GL)
+	}
+	apiURL := p.baseURL + "/complete/search?" + params.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("suggest request failed with status %d", resp.StatusCode)
+	}
+
+	// Response shape: ["query", ["completion", ...], ...]
+	var result []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode suggestions: %w", err)
+	}
+	if len(result) < 2 {
+		return []string{}, nil
+	}
+
+	var suggestions []string
+	if err := json.Unmarshal(result[1], &suggestions); err != nil {
+		return nil, fmt.Errorf("failed to decode suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// HistorySuggestProvider completes queries from previously searched queries,
+// ranked by how often they were searched
+type HistorySuggestProvider struct {
+	mu      sync.Mutex
+	limit   int
+	entries map[string]*historyEntry
+}
+
+type historyEntry struct {
+	query    string
+	count    int
+	lastUsed time.Time
+}
+
+// NewHistorySuggestProvider creates a history provider remembering up to
+// limit distinct queries
+func NewHistorySuggestProvider(limit int) *HistorySuggestProvider {
+	return &HistorySuggestProvider{
+		limit:   limit,
+		entries: make(map[string]*historyEntry),
+	}
+}
+
+// Record adds a searched query to the history
+func (h *HistorySuggestProvider) Record(query string) {
+	key := normalizeQuery(query)
+	if key == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if entry, ok := h.entries[key]; ok {
+		entry.count++
+		entry.lastUsed = time.Now()
+		return
+	}
+
+	// Evict the least recently used query when full
+	if len(h.entries) >= h.limit {
+		var oldest string
+		var oldestTime time.Time
+		for k, entry := range h.entries {
+			if oldest == "" || entry.lastUsed.Before(oldestTime) {
+				oldest = k
+				oldestTime = entry.lastUsed
+			}
+		}
+		delete(h.entries, oldest)
+	}
+
+	h.entries[key] = &historyEntry{
+		query:    strings.TrimSpace(query),
+		count:    1,
+		lastUsed: time.Now(),
+	}
+}
+
+// Suggest returns recorded queries starting with the given prefix
+func (h *HistorySuggestProvider) Suggest(_ context.Context, query string, _ Locale) ([]string, error) {
+	prefix := normalizeQuery(query)
+
+	h.mu.Lock()
+	matches := make([]historyEntry, 0)
+	for k, entry := range h.entries {
+		if strings.HasPrefix(k, prefix) {
+			matches = append(matches, *entry)
+		}
+	}
+	h.mu.Unlock()
+
+	// Most searched first, then most recent
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].count != matches[j].count {
+			return matches[i].count > matches[j].count
+		}
+		return matches[i].lastUsed.After(matches[j].lastUsed)
+	})
+
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	suggestions := make([]string, 0, len(matches))
+	for _, m := range matches {
+		suggestions = append(suggestions, m.query)
+	}
+	return suggestions, nil
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
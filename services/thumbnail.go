@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"musiq/logging"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	defaultThumbnailBaseURL = "https://i.ytimg.com"
+	// MaxThumbnailWidth is the widest thumbnail YouTube serves
+	MaxThumbnailWidth = 1280
+	// thumbnailCacheTTL is how long a processed thumbnail is served from disk
+	thumbnailCacheTTL = 7 * 24 * time.Hour
+	// thumbnailPruneInterval is how often expired thumbnails are deleted
+	thumbnailPruneInterval = time.Hour
+	// thumbnailMaxSourceBytes guards against oversized upstream responses
+	thumbnailMaxSourceBytes = 5 << 20
+	thumbnailJPEGQuality    = 85
+)
+
+// ErrThumbnailNotFound is returned when YouTube has no thumbnail for a video
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+// thumbnailFormats maps the accepted fmt values to file extensions
+var thumbnailFormats = map[string]string{
+	"jpeg": "jpg",
+	"jpg":  "jpg",
+	"png":  "png",
+	"webp": "webp",
+}
+
+// IsThumbnailFormat reports whether format is a supported output format
+func IsThumbnailFormat(format string) bool {
+	_, ok := thumbnailFormats[format]
+	return ok
+}
+
+// ThumbnailOptions selects the size, crop and format of a thumbnail. A zero
+// Width keeps the source width; Square crops the center for album art.
+type ThumbnailOptions struct {
+	Width  int
+	Square bool
+	Format string
+}
+
+// Thumbnail is an encoded thumbnail image
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+}
+
+// ThumbnailService fetches YouTube thumbnails, crops, resizes and re-encodes
+// them, and caches the results on disk
+type ThumbnailService struct {
+	cacheDir   string
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	userAgent  string
+	ffmpeg     *FFmpegService
+}
+
+// NewThumbnailService creates a thumbnail service caching into cacheDir and
+// encoding WebP with ffmpeg. It honours the HTTP client, timeout, user agent
+// and thumbnail base URL options.
+func NewThumbnailService(cacheDir string, ffmpeg *FFmpegService, opts ...Option) (*ThumbnailService, error) {
+	cfg := defaultServiceConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.httpClient = instrumentedClient(cfg.httpClient)
+
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail cache: %w", err)
+	}
+
+	return &ThumbnailService{
+		cacheDir:   cacheDir,
+		baseURL:    cfg.thumbnailBaseURL,
+		httpClient: cfg.httpClient,
+		timeout:    cfg.timeout,
+		userAgent:  cfg.userAgent,
+		ffmpeg:     ffmpeg,
+	}, nil
+}
+
+// Watch prunes expired thumbnails in the background every interval
+func (s *ThumbnailService) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.Prune()
+		}
+	}()
+}
+
+// Get returns a video's thumbnail, processed according to opts. Upstream
+// requests end with ctx.
+func (s *ThumbnailService) Get(ctx context.Context, videoID string, opts ThumbnailOptions) (*Thumbnail, error) {
+	id, err := ParseVideoID(videoID)
+	if err != nil {
+		return nil, err
+	}
+	ext, ok := thumbnailFormats[opts.Format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported thumbnail format %q", opts.Format)
+	}
+	width := min(max(opts.Width, 0), MaxThumbnailWidth)
+
+	crop := "wide"
+	if opts.Square {
+		crop = "square"
+	}
+	path := filepath.Join(s.cacheDir, fmt.Sprintf("%s_%d_%s.%s", id, width, crop, ext))
+
+	if data, ok := s.cached(path); ok {
+		return &Thumbnail{Data: data, ContentType: http.DetectContentType(data)}, nil
+	}
+
+	// A square crop is as wide as the 16:9 source is tall
+	sourceWidth := width
+	if opts.Square {
+		sourceWidth = width * 16 / 9
+	}
+	source, err := s.fetch(ctx, id, sourceWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.encode(ctx, resizeThumbnail(source, width, opts.Square), ext)
+	if err != nil {
+		return nil, err
+	}
+
+	// A JPEG fallback for WebP isn't cached so WebP is retried next time
+	contentType := http.DetectContentType(data)
+	if ext != "webp" || contentType == "image/webp" {
+		if err := s.store(path, data); err != nil {
+			logging.FromContext(ctx).Warn("Failed to cache thumbnail", "file", filepath.Base(path), "error", err)
+		}
+	}
+
+	return &Thumbnail{Data: data, ContentType: contentType}, nil
+}
+
+// Prune deletes cached thumbnails past their TTL
+func (s *ThumbnailService) Prune() {
+	entries, err := os.ReadDir(s.cacheDir)
+	if err != nil {
+		slog.Error("Failed to prune thumbnail cache", "error", err)
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < thumbnailCacheTTL {
+			continue
+		}
+		os.Remove(filepath.Join(s.cacheDir, entry.Name()))
+	}
+}
+
+func (s *ThumbnailService) cached(path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > thumbnailCacheTTL {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// store writes through a temp file so readers never see a partial image
+func (s *ThumbnailService) store(path string, data []byte) error {
+	tmp, err := os.CreateTemp(s.cacheDir, ".thumb-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fetch downloads the smallest upstream variant that covers width. Not every
+// video has maxresdefault, so hqdefault is the fallback for all sizes.
+func (s *ThumbnailService) fetch(ctx context.Context, videoID string, width int) (image.Image, error) {
+	var variants []string
+	switch {
+	case width > 0 && width <= 320:
+		variants = []string{"mqdefault", "hqdefault"}
+	case width > 0 && width <= 480:
+		variants = []string{"hqdefault"}
+	default:
+		variants = []string{"maxresdefault", "hqdefault"}
+	}
+
+	for _, variant := range variants {
+		img, err := s.fetchVariant(ctx, videoID, variant)
+		if errors.Is(err, ErrThumbnailNotFound) {
+			continue
+		}
+		return img, err
+	}
+	return nil, ErrThumbnailNotFound
+}
+
+func (s *ThumbnailService) fetchVariant(ctx context.Context, videoID, variant string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	thumbURL := fmt.Sprintf("%s/vi/%s/%s.jpg", s.baseURL, videoID, variant)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, thumbURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail request: %w", err)
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrThumbnailNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("thumbnail request returned status %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(io.LimitReader(resp.Body, thumbnailMaxSourceBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	return img, nil
+}
+
+// encode writes the image in the format of ext. WebP is encoded with
+// FFmpeg; when that fails the thumbnail is served as JPEG instead.
+func (s *ThumbnailService) encode(ctx context.Context, img image.Image, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch ext {
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		return buf.Bytes(), nil
+	case "webp":
+		data, err := s.ffmpeg.EncodeWebP(ctx, img)
+		if err == nil {
+			return data, nil
+		}
+		logging.FromContext(ctx).Warn("WebP encoding failed, serving JPEG", "error", err)
+	}
+
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeThumbnail center-crops an image to 16:9, or to a square, which also
+// removes the letterbox bars of 4:3 variants, then scales it down to width
+func resizeThumbnail(src image.Image, width int, square bool) image.Image {
+	bounds := src.Bounds()
+	cropW, cropH := bounds.Dx(), bounds.Dy()
+	if square {
+		cropW = min(cropW, cropH)
+		cropH = cropW
+	} else if cropW*9 < cropH*16 {
+		cropH = cropW * 9 / 16
+	} else {
+		cropW = cropH * 16 / 9
+	}
+
+	x := bounds.Min.X + (bounds.Dx()-cropW)/2
+	y := bounds.Min.Y + (bounds.Dy()-cropH)/2
+	crop := image.Rect(x, y, x+cropW, y+cropH)
+
+	outW, outH := cropW, cropH
+	if width > 0 && width < cropW {
+		outW = width
+		outH = cropH * width / cropW
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return dst
+}
+
+// thumbnailProxy is the base of proxied thumbnail URLs, such as
+// "/api/thumb". When set, API and UI thumbnails point at the proxy instead
+// of i.ytimg.com.
+type thumbnailProxy string
+
+// videoURL returns the URL of a video's thumbnail at the given width,
+// proxied when a proxy URL is set
+func (p thumbnailProxy) videoURL(videoID string, width int) string {
+	if p == "" {
+		return fmt.Sprintf("%s/vi/%s/hqdefault.jpg", defaultThumbnailBaseURL, videoID)
+	}
+	return p.proxied(videoID, width)
+}
+
+// rewrite points an i.ytimg.com video thumbnail URL at the proxy. Other
+// URLs, such as album art on googleusercontent.com, are kept.
+func (p thumbnailProxy) rewrite(rawURL string, width int) string {
+	if p == "" {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !strings.HasSuffix(parsed.Hostname(), "ytimg.com") {
+		return rawURL
+	}
+
+	// Paths look like /vi/<id>/hqdefault.jpg or /vi_webp/<id>/...
+	parts := strings.Split(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if len(parts) < 3 || !strings.HasPrefix(parts[0], "vi") || !videoIDRegex.MatchString(parts[1]) {
+		return rawURL
+	}
+	return p.proxied(parts[1], width)
+}
+
+func (p thumbnailProxy) proxied(videoID string, width int) string {
+	if width <= 0 {
+		return string(p) + "/" + videoID
+	}
+	return string(p) + "/" + videoID + "?w=" + strconv.Itoa(width)
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"musiq/models"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	// videoCacheTTL bounds how long a player response is reused. Stream URLs
+	// are signed for about six hours, so entries usually expire on this
+	// rather than on the signature.
+	videoCacheTTL = time.Hour
+	// videoCacheExpiryMargin leaves time to finish a stream opened from a
+	// cached entry before its signed URLs expire
+	videoCacheExpiryMargin = 15 * time.Minute
+	// videoCacheNegativeTTL is how long unavailable videos are remembered
+	videoCacheNegativeTTL = 10 * time.Minute
+)
+
+// videoCache keeps player responses and the video info derived from them,
+// so one play doesn't cost a player request per endpoint it touches
+type videoCache struct {
+	mu      sync.Mutex
+	entries map[string]*videoCacheEntry
+	// maxEntries caps memory use; the entry closest to expiry is evicted
+	// first
+	maxEntries int
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+}
+
+type videoCacheEntry struct {
+	video *youtube.Video
+	// client is the index of the player client that fetched the video
+	client  int
+	info    *models.VideoInfo
+	err     error
+	expires time.Time
+}
+
+func newVideoCache(maxEntries int) *videoCache {
+	return &videoCache{entries: make(map[string]*videoCacheEntry), maxEntries: maxEntries}
+}
+
+// videoCacheKey includes the locale since titles and descriptions can be
+// localized
+func videoCacheKey(videoID string, locale Locale) string {
+	return locale.Key() + "|" + videoID
+}
+
+// get returns a cached video, or the cached error of an unavailable one
+func (c *videoCache) get(key string) (*videoCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+
+	switch {
+	case !ok:
+		c.misses.Add(1)
+		return nil, false
+	case entry.err != nil:
+		c.negativeHits.Add(1)
+	default:
+		c.hits.Add(1)
+	}
+	return entry, true
+}
+
+// store caches a player response until shortly before its stream URLs
+// expire. Videos that expire too soon to be worth reusing are not cached.
+func (c *videoCache) store(key string, video *youtube.Video, client int) {
+	expires := time.Now().Add(videoCacheTTL)
+	if signed, ok := streamURLExpiry(video); ok && signed.Add(-videoCacheExpiryMargin).Before(expires) {
+		expires = signed.Add(-videoCacheExpiryMargin)
+	}
+	if !expires.After(time.Now()) {
+		return
+	}
+	c.put(key, &videoCacheEntry{video: video, client: client, expires: expires})
+}
+
+// storeError remembers that a video can't be played. Transient failures
+// such as timeouts are not cached.
+func (c *videoCache) storeError(key string, err error) {
+	if !isUnavailable(err) {
+		return
+	}
+	c.put(key, &videoCacheEntry{err: err, expires: time.Now().Add(videoCacheNegativeTTL)})
+}
+
+// storeInfo attaches the converted video info to a cached entry
+func (c *videoCache) storeInfo(key string, info *models.VideoInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && entry.err == nil {
+		entry.info = info
+	}
+}
+
+// copyVideoInfo returns a deep copy of a cached video info, so callers
+// can't change the cached one through its slices and pointers
+func copyVideoInfo(info *models.VideoInfo) *models.VideoInfo {
+	copied := *info
+	copied.Thumbnails = slices.Clone(info.Thumbnails)
+	copied.Formats = slices.Clone(info.Formats)
+	if info.PublishedAt != nil {
+		published := *info.PublishedAt
+		copied.PublishedAt = &published
+	}
+	if info.Metadata != nil {
+		meta := *info.Metadata
+		meta.Featuring = slices.Clone(info.Metadata.Featuring)
+		copied.Metadata = &meta
+	}
+	return &copied
+}
+
+// invalidate drops an entry whose stream URLs were refused
+func (c *videoCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *videoCache) put(key string, entry *videoCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = entry
+}
+
+// stats returns the cache's counters since startup
+func (c *videoCache) stats() models.CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := models.CacheStats{
+		Entries:      entries,
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+	}
+	if lookups := stats.Hits + stats.NegativeHits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits+stats.NegativeHits) / float64(lookups)
+	}
+	return stats
+}
+
+// streamURLExpiry returns the earliest expire parameter of a video's signed
+// stream URLs, which sit in the cipher for videos with ciphered signatures
+func streamURLExpiry(video *youtube.Video) (time.Time, bool) {
+	var earliest time.Time
+	for _, format := range video.Formats {
+		rawURL := format.URL
+		if rawURL == "" && format.Cipher != "" {
+			if params, err := url.ParseQuery(format.Cipher); err == nil {
+				rawURL = params.Get("url")
+			}
+		}
+		if rawURL == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		seconds, err := strconv.ParseInt(parsed.Query().Get("expire"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if expire := time.Unix(seconds, 0); earliest.IsZero() || expire.Before(earliest) {
+			earliest = expire
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
+
+// isUnavailable reports whether a player error means the video itself can't
+// be played, as opposed to a failed request
+func isUnavailable(err error) bool {
+	var playability *youtube.ErrPlayabiltyStatus
+	return errors.Is(err, youtube.ErrVideoPrivate) ||
+		errors.Is(err, youtube.ErrLoginRequired) ||
+		errors.Is(err, youtube.ErrNotPlayableInEmbed) ||
+		errors.As(err, &playability)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// signedVideo returns a video whose stream URL expires at expire
+func signedVideo(id string, expire time.Time, ciphered bool) *youtube.Video {
+	streamURL := fmt.Sprintf("https://rr1.googlevideo.com/videoplayback?expire=%d&itag=140", expire.Unix())
+	format := youtube.Format{ItagNo: 140, URL: streamURL}
+	if ciphered {
+		format = youtube.Format{ItagNo: 140, Cipher: "s=abc&sp=sig&url=" + url.QueryEscape(streamURL)}
+	}
+	return &youtube.Video{ID: id, Formats: youtube.FormatList{format}}
+}
+
+func TestVideoCacheExpiry(t *testing.T) {
+	// The expire parameter has a resolution of seconds
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name     string
+		video    *youtube.Video
+		cached   bool
+		expected time.Time
+	}{
+		{name: "signed for hours", video: signedVideo("a", now.Add(6*time.Hour), false), cached: true, expected: now.Add(videoCacheTTL)},
+		{name: "signed for half an hour", video: signedVideo("a", now.Add(30*time.Minute), false), cached: true, expected: now.Add(30*time.Minute - videoCacheExpiryMargin)},
+		{name: "ciphered", video: signedVideo("a", now.Add(30*time.Minute), true), cached: true, expected: now.Add(30*time.Minute - videoCacheExpiryMargin)},
+		// Too close to expiry to finish a stream opened from the entry
+		{name: "expiring within the margin", video: signedVideo("a", now.Add(10*time.Minute), false)},
+		{name: "unsigned", video: &youtube.Video{ID: "a"}, cached: true, expected: now.Add(videoCacheTTL)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newVideoCache(10)
+			c.store("a", tt.video, 0)
+
+			entry, ok := c.get("a")
+			if ok != tt.cached {
+				t.Fatalf("cached = %v, want %v", ok, tt.cached)
+			}
+			if !ok {
+				return
+			}
+			// Entries without a signed expiry are timed from the store,
+			// slightly after now
+			if diff := entry.expires.Sub(tt.expected); diff < 0 || diff > time.Second {
+				t.Errorf("expires = %v, want %v", entry.expires, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVideoCacheNegative(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		cached bool
+	}{
+		{name: "private", err: youtube.ErrVideoPrivate, cached: true},
+		{name: "login required", err: fmt.Errorf("player: %w", youtube.ErrLoginRequired), cached: true},
+		{name: "unplayable", err: &youtube.ErrPlayabiltyStatus{Status: "UNPLAYABLE", Reason: "removed"}, cached: true},
+		// Failed requests are retried on the next lookup
+		{name: "timeout", err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newVideoCache(10)
+			c.storeError("a", tt.err)
+
+			entry, ok := c.get("a")
+			if ok != tt.cached {
+				t.Fatalf("cached = %v, want %v", ok, tt.cached)
+			}
+			if !ok {
+				return
+			}
+			if entry.err != tt.err {
+				t.Errorf("err = %v, want %v", entry.err, tt.err)
+			}
+			if stats := c.stats(); stats.NegativeHits != 1 || stats.Hits != 0 {
+				t.Errorf("stats = %+v, want one negative hit", stats)
+			}
+		})
+	}
+}
+
+func TestVideoCacheEviction(t *testing.T) {
+	now := time.Now()
+	c := newVideoCache(2)
+	c.store("soon", signedVideo("soon", now.Add(30*time.Minute), false), 0)
+	c.store("late", signedVideo("late", now.Add(6*time.Hour), false), 0)
+	c.store("new", signedVideo("new", now.Add(6*time.Hour), false), 0)
+
+	// The entry closest to expiry makes room
+	for key, want := range map[string]bool{"soon": false, "late": true, "new": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+
+	// Replacing an entry evicts nothing
+	c.store("late", signedVideo("late", now.Add(6*time.Hour), false), 1)
+	if _, ok := c.get("new"); !ok {
+		t.Error("new was evicted by replacing late")
+	}
+}
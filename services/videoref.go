@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidVideoRef is returned for input that is neither a video ID
+	// nor a recognized YouTube URL
+	ErrInvalidVideoRef = errors.New("invalid YouTube video ID or URL")
+	// ErrInvalidPlaylistRef is returned for input that is neither a
+	// playlist ID nor a YouTube URL with a list= parameter. It also
+	// matches ErrInvalidVideoRef, so callers can treat both alike.
+	ErrInvalidPlaylistRef error = playlistRefError{}
+
+	// videoIDRegex matches an 11 character YouTube video ID
+	videoIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
+	// playlistIDRegex matches the characters of playlist IDs; isPlaylistID
+	// also checks their prefix and length
+	playlistIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{2,64}$`)
+	// timestampRegex matches "90", "90s", "1m30s" and "1h2m3s" timestamps
+	timestampRegex = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+)
+
+// playlistIDPrefixes start the IDs of user playlists (PL), channel uploads
+// (UU), albums (OLAK5uy_), mixes (RD), liked videos (LL) and favorites (FL)
+var playlistIDPrefixes = []string{"PL", "UU", "OL", "RD", "LL", "FL"}
+
+// minPlaylistIDLength is the length of the shortest playlist IDs, the mixes
+// of a single video: RD followed by the video ID
+const minPlaylistIDLength = 13
+
+// playlistRefError is ErrInvalidPlaylistRef
+type playlistRefError struct{}
+
+func (playlistRefError) Error() string {
+	return "invalid YouTube playlist ID or URL"
+}
+
+func (playlistRefError) Is(target error) bool {
+	return target == ErrInvalidVideoRef
+}
+
+// youtubeURLHosts are the hosts serving watch, embed and short links
+var youtubeURLHosts = map[string]bool{
+	"youtube.com":              true,
+	"www.youtube.com":          true,
+	"m.youtube.com":            true,
+	"music.youtube.com":        true,
+	"gaming.youtube.com":       true,
+	"youtube-nocookie.com":     true,
+	"www.youtube-nocookie.com": true,
+}
+
+// videoPathPrefixes are URL paths followed by a video ID
+var videoPathPrefixes = []string{"/embed/", "/shorts/", "/live/", "/v/", "/e/", "/watch/"}
+
+// VideoRef is a parsed reference to a YouTube video: a bare ID or any of the
+// URL forms YouTube hands out. PlaylistID and Start are set when the URL
+// carries list= and t= (or start=) parameters.
+type VideoRef struct {
+	VideoID    string
+	PlaylistID string
+	Start      time.Duration
+}
+
+// ParseVideoRef parses a video ID or YouTube URL, such as
+//
+//	dQw4w9WgXcQ
+//	https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL...&t=1m30s
+//	https://youtu.be/dQw4w9WgXcQ?si=abc&t=42
+//	https://m.youtube.com/shorts/dQw4w9WgXcQ
+//	music.youtube.com/watch?v=dQw4w9WgXcQ
+//	https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=10
+//
+// A playlist URL without a video yields a ref with only PlaylistID set.
+// Anything else returns an error wrapping ErrInvalidVideoRef.
+func ParseVideoRef(input string) (VideoRef, error) {
+	input = strings.TrimSpace(input)
+	if videoIDRegex.MatchString(input) {
+		return VideoRef{VideoID: input}, nil
+	}
+
+	raw := input
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return VideoRef{}, fmt.Errorf("%w: %q", ErrInvalidVideoRef, input)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	query := u.Query()
+	var ref VideoRef
+
+	switch {
+	case host == "youtu.be" || host == "www.youtu.be":
+		ref.VideoID = firstPathSegment(u.Path)
+
+	case youtubeURLHosts[host]:
+		if v := query.Get("v"); v != "" {
+			ref.VideoID = v
+			break
+		}
+		for _, prefix := range videoPathPrefixes {
+			if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+				ref.VideoID = firstPathSegment(rest)
+				break
+			}
+		}
+
+	default:
+		return VideoRef{}, fmt.Errorf("%w: %q is not a YouTube URL", ErrInvalidVideoRef, input)
+	}
+
+	if ref.VideoID != "" && !videoIDRegex.MatchString(ref.VideoID) {
+		return VideoRef{}, fmt.Errorf("%w: %q is not a video ID", ErrInvalidVideoRef, ref.VideoID)
+	}
+
+	if list := query.Get("list"); list != "" {
+		if !playlistIDRegex.MatchString(list) {
+			return VideoRef{}, fmt.Errorf("%w: %q is not a playlist ID", ErrInvalidVideoRef, list)
+		}
+		ref.PlaylistID = list
+	}
+
+	if ref.VideoID == "" && ref.PlaylistID == "" {
+		return VideoRef{}, fmt.Errorf("%w: no video in %q", ErrInvalidVideoRef, input)
+	}
+
+	// Timestamps come as t=, start= or a #t= fragment
+	for _, value := range []string{query.Get("t"), query.Get("start"), strings.TrimPrefix(u.Fragment, "t=")} {
+		if start, ok := parseTimestamp(value); ok {
+			ref.Start = start
+			break
+		}
+	}
+
+	return ref, nil
+}
+
+// ParseVideoID parses input with ParseVideoRef and requires a video ID
+func ParseVideoID(input string) (string, error) {
+	ref, err := ParseVideoRef(input)
+	if err != nil {
+		return "", err
+	}
+	if ref.VideoID == "" {
+		return "", fmt.Errorf("%w: %q is a playlist, not a video", ErrInvalidVideoRef, input)
+	}
+	return ref.VideoID, nil
+}
+
+// ParsePlaylistID accepts a playlist ID or any YouTube URL with a list=
+// parameter. Anything else returns an error wrapping ErrInvalidPlaylistRef.
+func ParsePlaylistID(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if isPlaylistID(input) {
+		return input, nil
+	}
+
+	ref, err := ParseVideoRef(input)
+	if err != nil || ref.PlaylistID == "" {
+		return "", fmt.Errorf("%w: no playlist in %q", ErrInvalidPlaylistRef, input)
+	}
+	if !isPlaylistID(ref.PlaylistID) {
+		return "", fmt.Errorf("%w: %q is not a playlist ID", ErrInvalidPlaylistRef, ref.PlaylistID)
+	}
+	return ref.PlaylistID, nil
+}
+
+// isPlaylistID reports whether id has the prefix and length of a playlist ID
+func isPlaylistID(id string) bool {
+	if len(id) < minPlaylistIDLength || !playlistIDRegex.MatchString(id) {
+		return false
+	}
+	return slices.ContainsFunc(playlistIDPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(id, prefix)
+	})
+}
+
+// parseTimestamp converts "90", "90s", "1m30s" or "1h2m3s" to a duration
+func parseTimestamp(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	m := timestampRegex.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+
+	var total time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, false
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, true
+}
+
+func firstPathSegment(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return segment
+}
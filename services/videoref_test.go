@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePlaylistID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", want: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		{input: "RDdQw4w9WgXcQ", want: "RDdQw4w9WgXcQ"},
+		{input: "OLAK5uy_kEWqD8g4mkmXrMrM8RTAm4BXS3O0Pv4Rg", want: "OLAK5uy_kEWqD8g4mkmXrMrM8RTAm4BXS3O0Pv4Rg"},
+		{input: "UUuAXFkgsw1L7xaCfnd5JJOw", want: "UUuAXFkgsw1L7xaCfnd5JJOw"},
+		{input: "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", want: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		{input: "https://youtu.be/dQw4w9WgXcQ?list=RDdQw4w9WgXcQ", want: "RDdQw4w9WgXcQ"},
+
+		// Too short, unknown prefixes, video IDs and URLs without a list
+		{input: "PLabc"},
+		{input: "XXrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+		{input: "dQw4w9WgXcQ"},
+		{input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{input: "https://www.youtube.com/playlist?list=PLabc"},
+		{input: "https://example.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePlaylistID(tt.input)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidPlaylistRef) || !errors.Is(err, ErrInvalidVideoRef) {
+					t.Fatalf("ParsePlaylistID() = %q, %v, want an ErrInvalidPlaylistRef", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParsePlaylistID() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,12 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"musiq/models"
 
@@ -19,26 +16,163 @@ import (
 
 // YouTubeService handles all YouTube operations
 type YouTubeService struct {
-	client youtube.Client
+	client  *youtube.Client
+	web     innertubeClient
+	music   innertubeClient
+	timeout time.Duration
+	retry   retryPolicy
+	// thumbnailProxy is where result thumbnails point
+	thumbnailProxy thumbnailProxy
+
+	videos    *videoCache
+	searches  *responseCache[[]models.VideoResult]
+	playlists *responseCache[*models.Playlist]
+	mixes     *responseCache[*mixCrawl]
 }
 
-// NewYouTubeService creates a new YouTube service
-func NewYouTubeService() *YouTubeService {
+// NewYouTubeService creates a new YouTube service. Without options it talks
+// to the public YouTube frontends with http.DefaultClient.
+func NewYouTubeService(opts ...Option) *YouTubeService {
+	cfg := defaultServiceConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.httpClient = instrumentedClient(cfg.httpClient)
+
+	web := webClient
+	web.version = cfg.clientVersion
+	music := musicClient
+	music.version = cfg.musicClientVersion
+
+	for _, c := range []*innertubeClient{&web, &music} {
+		c.httpClient = cfg.httpClient
+		c.userAgent = cfg.userAgent
+		c.hl = cfg.hl
+		c.gl = cfg.gl
+		c.timeout = cfg.timeout
+	}
+	if cfg.baseURL != "" {
+		web.baseURL = cfg.baseURL
+		music.baseURL = cfg.baseURL
+	}
+	if cfg.musicBaseURL != "" {
+		music.baseURL = cfg.musicBaseURL
+	}
+
 	return &YouTubeService{
-		client: youtube.Client{},
+		client:         &youtube.Client{HTTPClient: cfg.playerHTTPClient()},
+		web:            web,
+		music:          music,
+		timeout:        cfg.timeout,
+		retry:          cfg.retryPolicy(),
+		thumbnailProxy: thumbnailProxy(cfg.thumbnailProxyURL),
+		videos:         newVideoCache(cfg.videoCacheSize),
+		searches:       newResponseCache[[]models.VideoResult]("search", cfg.searchCacheTTL, cfg.cacheStaleTTL, cfg.responseCacheSize),
+		playlists:      newResponseCache[*models.Playlist]("playlist", cfg.playlistCacheTTL, cfg.cacheStaleTTL, cfg.responseCacheSize),
+		mixes:          newResponseCache[*mixCrawl]("mix", cfg.playlistCacheTTL, cfg.cacheStaleTTL, cfg.responseCacheSize),
 	}
 }
 
-// GetVideo retrieves video information by ID
-func (s *YouTubeService) GetVideo(videoID string) (*youtube.Video, error) {
-	return s.client.GetVideo(videoID)
+// ForLocale returns a view of the service that requests results for the
+// given locale. Empty locale fields keep the service defaults.
+func (s *YouTubeService) ForLocale(locale Locale) *YouTubeService {
+	localized := *s
+	for _, c := range []*innertubeClient{&localized.web, &localized.music} {
+		if locale.HL != "" {
+			c.hl = locale.HL
+		}
+		if locale.GL != "" {
+			c.gl = locale.GL
+		}
+	}
+	return &localized
+}
+
+// ThumbnailURL returns the URL of a video's thumbnail at the given width,
+// pointing at the thumbnail proxy when one is configured
+func (s *YouTubeService) ThumbnailURL(videoID string, width int) string {
+	return s.thumbnailProxy.videoURL(videoID, width)
+}
+
+// Locale returns the locale the service requests results for
+func (s *YouTubeService) Locale() Locale {
+	return Locale{HL: s.web.hl, GL: s.web.gl}
 }
 
-// GetVideoInfo returns formatted video information
-func (s *YouTubeService) GetVideoInfo(videoID string) (*models.VideoInfo, error) {
-	video, err := s.client.GetVideo(videoID)
+// GetVideo retrieves video information by ID. Player responses are cached
+// until shortly before their stream URLs expire, and unavailable videos for
+// a few minutes.
+//
+// ctx carries the request logger. Player requests aren't cancelled with
+// it, since their outcome is cached and shared with other requests.
+func (s *YouTubeService) GetVideo(ctx context.Context, videoID string) (*youtube.Video, error) {
+	video, _, err := s.video(ctx, videoID)
+	return video, err
+}
+
+// video returns a player response with the index of the player client that
+// fetched it, since stream downloads must use the same client
+func (s *YouTubeService) video(ctx context.Context, videoID string) (*youtube.Video, int, error) {
+	key := videoCacheKey(videoID, s.Locale())
+	if entry, ok := s.videos.get(key); ok {
+		return entry.video, entry.client, entry.err
+	}
+	return s.fetchVideo(ctx, key, videoID, 0)
+}
+
+// fetchVideo requests a player response, retrying and falling back across
+// player clients from the one at index from, and caches the outcome
+func (s *YouTubeService) fetchVideo(ctx context.Context, key, videoID string, from int) (*youtube.Video, int, error) {
+	video, client, err := s.retry.run(ctx, videoID, from, func(client playerClient) (*youtube.Video, error) {
+		ctx, cancel := s.playerContext(context.WithoutCancel(ctx))
+		defer cancel()
+		return s.client.GetVideoContext(withPlayerClient(ctx, client), videoID)
+	})
 	if err != nil {
-		return nil, err
+		s.videos.storeError(key, err)
+		return nil, client, err
+	}
+
+	s.videos.store(key, video, client)
+	return video, client, nil
+}
+
+// CacheStats returns hit and miss counts of the service's caches
+func (s *YouTubeService) CacheStats() models.StatsResponse {
+	return models.StatsResponse{
+		VideoCache:    s.videos.stats(),
+		SearchCache:   s.searches.stats(),
+		PlaylistCache: s.playlists.stats(),
+		MixCache:      s.mixes.stats(),
+	}
+}
+
+// playerContext bounds a player library call by the service timeout and
+// carries the locale for the player transport to apply
+func (s *YouTubeService) playerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(withLocale(ctx, s.Locale()), s.timeout)
+}
+
+// GetVideoInfo returns formatted video information. The result is a copy
+// callers may modify.
+func (s *YouTubeService) GetVideoInfo(ctx context.Context, videoID string) (*models.VideoInfo, error) {
+	key := videoCacheKey(videoID, s.Locale())
+
+	var video *youtube.Video
+	if entry, ok := s.videos.get(key); ok {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		if entry.info != nil {
+			return copyVideoInfo(entry.info), nil
+		}
+		video = entry.video
+	} else {
+		fetched, _, err := s.fetchVideo(ctx, key, videoID, 0)
+		if err != nil {
+			return nil, err
+		}
+		video = fetched
 	}
 
 	info := &models.VideoInfo{
@@ -48,21 +182,102 @@ func (s *YouTubeService) GetVideoInfo(videoID string) (*models.VideoInfo, error)
 		Duration:    video.Duration.String(),
 		DurationSec: int(video.Duration.Seconds()),
 		Views:       strconv.FormatInt(int64(video.Views), 10),
+		ViewCount:   int64(video.Views),
 		Description: video.Description,
-		Thumbnails:  convertThumbnails(video.Thumbnails),
+		Thumbnails:  convertThumbnails(video.Thumbnails, s.thumbnailProxy),
 		Formats:     convertFormats(video.Formats),
 	}
+	if !video.PublishDate.IsZero() {
+		published := video.PublishDate
+		info.PublishedAt = &published
+	}
+	meta := CleanMetadata(info.Title, info.Author)
+	info.Metadata = &meta
+	s.videos.storeInfo(key, info)
+
+	return copyVideoInfo(info), nil
+}
+
+// Name returns the media source prefix of YouTube IDs
+func (s *YouTubeService) Name() string {
+	return "youtube"
+}
+
+// Search implements MediaSource
+func (s *YouTubeService) Search(ctx context.Context, query string, locale Locale) ([]models.VideoResult, error) {
+	return s.ForLocale(locale).SearchVideos(ctx, query)
+}
+
+// Info implements MediaSource; videoID may be any URL ParseVideoRef accepts
+func (s *YouTubeService) Info(ctx context.Context, videoID string, locale Locale) (*models.VideoInfo, error) {
+	id, err := ParseVideoID(videoID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ForLocale(locale).GetVideoInfo(ctx, id)
+}
+
+// AudioStream implements MediaSource. The container depends on the chosen
+// format, so no MIME type is reported.
+func (s *YouTubeService) AudioStream(ctx context.Context, videoID string) (*AudioStream, error) {
+	id, err := ParseVideoID(videoID)
+	if err != nil {
+		return nil, err
+	}
+	stream, size, err := s.GetAudioStream(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &AudioStream{ReadCloser: stream, Size: size}, nil
+}
 
-	return info, nil
+// Playlist implements MediaSource; playlistID may be any URL with a list=
+// parameter
+func (s *YouTubeService) Playlist(ctx context.Context, playlistID string, offset, limit int, locale Locale) (*models.Playlist, error) {
+	id, err := ParsePlaylistID(playlistID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ForLocale(locale).GetPlaylistVideos(ctx, id, offset, limit)
 }
 
 // GetAudioStream returns the best audio stream for a video
-func (s *YouTubeService) GetAudioStream(videoID string) (io.ReadCloser, int64, error) {
-	video, err := s.client.GetVideo(videoID)
+func (s *YouTubeService) GetAudioStream(ctx context.Context, videoID string) (io.ReadCloser, int64, error) {
+	stream, _, _, size, err := s.openStream(ctx, videoID, bestAudioFormat)
+	if err != nil {
+		return nil, 0, err
+	}
+	return stream, size, nil
+}
+
+// GetCombinedStream returns a stream that has both video and audio combined
+// This is faster than muxing separate streams but may be lower quality (360p/720p)
+func (s *YouTubeService) GetCombinedStream(ctx context.Context, videoID string) (io.ReadCloser, string, int64, error) {
+	stream, _, format, size, err := s.openStream(ctx, videoID, bestCombinedFormat)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return stream, format.MimeType, size, nil
+}
+
+// GetVideoAndAudioStreams returns separate video and audio streams for muxing
+func (s *YouTubeService) GetVideoAndAudioStreams(ctx context.Context, videoID string) (video io.ReadCloser, audio io.ReadCloser, videoInfo *youtube.Video, err error) {
+	video, videoInfo, _, _, err = s.openStream(ctx, videoID, bestVideoOnlyFormat)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get video: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to get video stream: %w", err)
+	}
+
+	audio, _, _, _, err = s.openStream(ctx, videoID, preferredAudioFormat)
+	if err != nil {
+		video.Close()
+		return nil, nil, nil, fmt.Errorf("failed to get audio stream: %w", err)
 	}
 
+	return video, audio, videoInfo, nil
+}
+
+// bestAudioFormat picks the audio-only format with the highest bitrate
+func bestAudioFormat(video *youtube.Video) (*youtube.Format, error) {
 	// Get audio-only formats sorted by bitrate
 	formats := video.Formats.WithAudioChannels()
 	audioFormats := make([]youtube.Format, 0)
@@ -83,26 +298,14 @@ func (s *YouTubeService) GetAudioStream(videoID string) (io.ReadCloser, int64, e
 	})
 
 	if len(audioFormats) == 0 {
-		return nil, 0, fmt.Errorf("no audio formats available")
+		return nil, fmt.Errorf("no audio formats available")
 	}
 
-	format := &audioFormats[0]
-	stream, size, err := s.client.GetStream(video, format)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get stream: %w", err)
-	}
-
-	return stream, size, nil
+	return &audioFormats[0], nil
 }
 
-// GetCombinedStream returns a stream that has both video and audio combined
-// This is faster than muxing separate streams but may be lower quality (360p/720p)
-func (s *YouTubeService) GetCombinedStream(videoID string) (io.ReadCloser, string, int64, error) {
-	video, err := s.client.GetVideo(videoID)
-	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to get video: %w", err)
-	}
-
+// bestCombinedFormat picks a progressive format with both video and audio
+func bestCombinedFormat(video *youtube.Video) (*youtube.Format, error) {
 	// Find formats with both video and audio (progressive formats)
 	// Prefer MP4 formats for browser compatibility
 	var combinedFormats []youtube.Format
@@ -114,7 +317,7 @@ func (s *YouTubeService) GetCombinedStream(videoID string) (io.ReadCloser, strin
 	}
 
 	if len(combinedFormats) == 0 {
-		return nil, "", 0, fmt.Errorf("no combined video+audio formats available")
+		return nil, fmt.Errorf("no combined video+audio formats available")
 	}
 
 	// Sort by quality (prefer higher resolution, then MP4 over WebM)
@@ -129,27 +332,17 @@ func (s *YouTubeService) GetCombinedStream(videoID string) (io.ReadCloser, strin
 		return combinedFormats[i].Height > combinedFormats[j].Height
 	})
 
-	format := &combinedFormats[0]
-	stream, size, err := s.client.GetStream(video, format)
-	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to get stream: %w", err)
-	}
-
-	return stream, format.MimeType, size, nil
+	return &combinedFormats[0], nil
 }
 
-// GetVideoAndAudioStreams returns separate video and audio streams for muxing
-func (s *YouTubeService) GetVideoAndAudioStreams(videoID string) (video io.ReadCloser, audio io.ReadCloser, videoInfo *youtube.Video, err error) {
-	videoInfo, err = s.client.GetVideo(videoID)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get video: %w", err)
-	}
-
+// bestVideoOnlyFormat picks the video-only format with the highest bitrate,
+// preferring H.264 for browser compatibility
+func bestVideoOnlyFormat(video *youtube.Video) (*youtube.Format, error) {
 	// Get video-only formats, preferring H.264 (avc1) for browser compatibility
 	h264Formats := make([]youtube.Format, 0)
 	vp9Formats := make([]youtube.Format, 0)
 
-	for _, f := range videoInfo.Formats {
+	for _, f := range video.Formats {
 		if strings.Contains(f.MimeType, "video") && f.AudioChannels == 0 {
 			// H.264/AVC formats have "avc1" in MIME type
 			if strings.Contains(f.MimeType, "avc1") {
@@ -179,12 +372,18 @@ func (s *YouTubeService) GetVideoAndAudioStreams(videoID string) (video io.ReadC
 	}
 
 	if len(videoFormats) == 0 {
-		return nil, nil, nil, fmt.Errorf("no video-only formats available")
+		return nil, fmt.Errorf("no video-only formats available")
 	}
 
+	return &videoFormats[0], nil
+}
+
+// preferredAudioFormat picks the audio format with the highest bitrate,
+// preferring an English track on videos with several audio languages
+func preferredAudioFormat(video *youtube.Video) (*youtube.Format, error) {
 	// Get best audio format (prefer English)
 	audioFormats := make([]youtube.Format, 0)
-	for _, f := range videoInfo.Formats {
+	for _, f := range video.Formats {
 		if strings.Contains(f.MimeType, "audio") {
 			audioFormats = append(audioFormats, f)
 		}
@@ -196,49 +395,39 @@ func (s *YouTubeService) GetVideoAndAudioStreams(videoID string) (video io.ReadC
 	})
 
 	// Try to find English audio
-	var selectedAudio *youtube.Format
 	for i := range audioFormats {
 		if audioFormats[i].AudioTrack != nil {
 			if strings.HasPrefix(audioFormats[i].AudioTrack.ID, "en") {
-				selectedAudio = &audioFormats[i]
-				break
+				return &audioFormats[i], nil
 			}
 		}
 	}
-	if selectedAudio == nil && len(audioFormats) > 0 {
-		selectedAudio = &audioFormats[0]
-	}
-
-	if selectedAudio == nil {
-		return nil, nil, nil, fmt.Errorf("no audio formats available")
+	if len(audioFormats) == 0 {
+		return nil, fmt.Errorf("no audio formats available")
 	}
 
-	// Get video stream
-	videoStream, _, err := s.client.GetStream(videoInfo, &videoFormats[0])
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get video stream: %w", err)
-	}
+	return &audioFormats[0], nil
+}
 
-	// Get audio stream
-	audioStream, _, err := s.client.GetStream(videoInfo, selectedAudio)
+// SearchVideos searches YouTube for videos. Results are cached per locale
+// and normalized query; the returned slice is the caller's to modify.
+func (s *YouTubeService) SearchVideos(ctx context.Context, query string) ([]models.VideoResult, error) {
+	key := s.Locale().Key() + "|" + normalizeQuery(query)
+	results, err := s.searches.get(ctx, key, func(ctx context.Context) ([]models.VideoResult, error) {
+		return s.searchYouTube(ctx, query, "video")
+	})
 	if err != nil {
-		videoStream.Close()
-		return nil, nil, nil, fmt.Errorf("failed to get audio stream: %w", err)
+		return nil, err
 	}
-
-	return videoStream, audioStream, videoInfo, nil
+	return copyVideos(results), nil
 }
 
-// SearchVideos searches YouTube for videos
-func (s *YouTubeService) SearchVideos(query string) ([]models.VideoResult, error) {
-	return searchYouTube(query, "video")
-}
-
-// SearchPlaylists searches YouTube for playlists
+// SearchPlaylists searches YouTube for playlists. It is served from the
+// search cache.
 // Note: Due to InnerTube API limitations, this returns video results for "query playlist"
-func (s *YouTubeService) SearchPlaylists(query string) ([]models.PlaylistResult, error) {
+func (s *YouTubeService) SearchPlaylists(ctx context.Context, query string) ([]models.PlaylistResult, error) {
 	// Search for query + playlist to get playlist-related results
-	videos, err := s.SearchVideos(query + " playlist")
+	videos, err := s.SearchVideos(ctx, query+" playlist")
 	if err != nil {
 		return nil, err
 	}
@@ -259,42 +448,129 @@ func (s *YouTubeService) SearchPlaylists(query string) ([]models.PlaylistResult,
 	return playlists, nil
 }
 
-// GetPlaylistVideos retrieves videos from a playlist
-func (s *YouTubeService) GetPlaylistVideos(playlistID string) ([]models.VideoResult, error) {
-	playlist, err := s.client.GetPlaylist(playlistID)
+const (
+	// DefaultPlaylistLimit is the page size used when none is requested
+	DefaultPlaylistLimit = 100
+	// MaxPlaylistLimit caps the page size so large playlists stay paged
+	MaxPlaylistLimit = 500
+	// maxPlaylistPages bounds the browse requests made to load one
+	// playlist; YouTube sends up to 100 videos per page
+	maxPlaylistPages = 50
+)
+
+// GetPlaylistVideos retrieves a playlist's metadata and the page of its
+// videos starting at offset. A limit of 0 uses DefaultPlaylistLimit.
+// Auto-generated mixes (RD... IDs) are endless: each request extends the mix
+// far enough to fill the requested page.
+func (s *YouTubeService) GetPlaylistVideos(ctx context.Context, playlistID string, offset, limit int) (*models.Playlist, error) {
+	if limit <= 0 {
+		limit = DefaultPlaylistLimit
+	}
+	if limit > MaxPlaylistLimit {
+		limit = MaxPlaylistLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Regular playlists are loaded whole and paged from the cached copy;
+	// mixes are crawled as far as the page reaches and extended by later
+	// pages
+	key := s.Locale().Key() + "|" + playlistID
+	var cached *models.Playlist
+	var err error
+	if IsMixPlaylistID(playlistID) {
+		cached, err = s.getMixPlaylist(ctx, key, playlistID, offset+limit)
+	} else {
+		cached, err = s.playlists.get(ctx, key, func(ctx context.Context) (*models.Playlist, error) {
+			return s.getPlaylist(ctx, playlistID)
+		})
+	}
 	if err != nil {
+		return nil, err
+	}
+
+	total := len(cached.Videos)
+	start := min(offset, total)
+	end := min(start+limit, total)
+
+	result := *cached
+	result.Offset = offset
+	result.Limit = limit
+	result.Videos = copyVideos(cached.Videos[start:end])
+	annotateVideos(result.Videos)
+
+	return &result, nil
+}
+
+// getPlaylist loads every video of a regular playlist from its browse page
+// and the continuations that follow it
+func (s *YouTubeService) getPlaylist(ctx context.Context, playlistID string) (*models.Playlist, error) {
+	var response browseResponse
+	payload := map[string]interface{}{
+		"context":  s.web.innertubeContext(),
+		"browseId": "VL" + playlistID,
+	}
+	if err := s.web.request(ctx, "browse", payload, &response); err != nil {
 		return nil, fmt.Errorf("failed to get playlist: %w", err)
 	}
 
-	videos := make([]models.VideoResult, 0, len(playlist.Videos))
-	for _, entry := range playlist.Videos {
-		video := models.VideoResult{
-			ID:          entry.ID,
-			Title:       entry.Title,
-			Author:      entry.Author,
-			Duration:    entry.Duration.String(),
-			DurationSec: int(entry.Duration.Seconds()),
-			Thumbnails:  convertThumbnails(entry.Thumbnails),
-		}
-		videos = append(videos, video)
+	header, err := response.playlistHeader()
+	if err != nil {
+		return nil, err
 	}
+	items, err := response.playlistItems()
+	if err != nil {
+		return nil, err
+	}
+	videos, continuation := playlistVideos(items, s.thumbnailProxy)
 
-	return videos, nil
+	for page := 1; continuation != "" && page < maxPlaylistPages; page++ {
+		var next browseResponse
+		payload := map[string]interface{}{
+			"context":      s.web.innertubeContext(),
+			"continuation": continuation,
+		}
+		if err := s.web.request(ctx, "browse", payload, &next); err != nil {
+			return nil, fmt.Errorf("failed to get playlist page %d: %w", page+1, err)
+		}
+		items, err := next.continuationItems()
+		if err != nil {
+			return nil, err
+		}
+		var more []models.VideoResult
+		more, continuation = playlistVideos(items, s.thumbnailProxy)
+		videos = append(videos, more...)
+	}
+
+	return &models.Playlist{
+		ID:          playlistID,
+		Title:       header.Title.String(),
+		Author:      header.OwnerText.First(),
+		Description: header.DescriptionText.String(),
+		VideoCount:  len(videos),
+		Videos:      videos,
+	}, nil
 }
 
 // GetRelatedVideos retrieves related videos for a video ID
-func (s *YouTubeService) GetRelatedVideos(videoID string) ([]models.VideoResult, error) {
+func (s *YouTubeService) GetRelatedVideos(ctx context.Context, videoID string) ([]models.VideoResult, error) {
 	// Use YouTube search as fallback since kkdai/youtube doesn't have direct related videos
-	return s.SearchVideos(videoID)
+	return s.SearchVideos(ctx, videoID)
 }
 
 // Helper functions
 
-func convertThumbnails(thumbnails youtube.Thumbnails) []models.Thumbnail {
+// copyVideos copies cached results so callers can modify them
+func copyVideos(videos []models.VideoResult) []models.VideoResult {
+	return append(make([]models.VideoResult, 0, len(videos)), videos...)
+}
+
+func convertThumbnails(thumbnails youtube.Thumbnails, proxy thumbnailProxy) []models.Thumbnail {
 	result := make([]models.Thumbnail, 0, len(thumbnails))
 	for _, t := range thumbnails {
 		result = append(result, models.Thumbnail{
-			URL:    t.URL,
+			URL:    proxy.rewrite(t.URL, int(t.Width)),
 			Width:  int(t.Width),
 			Height: int(t.Height),
 		})
@@ -324,254 +600,78 @@ func convertFormats(formats youtube.FormatList) []models.VideoFormat {
 }
 
 // searchYouTube performs a YouTube search using the InnerTube API
-func searchYouTube(query string, searchType string) ([]models.VideoResult, error) {
-	results, err := searchYouTubeRaw(query, searchType)
-	if err != nil {
-		return nil, err
-	}
-
-	videos := make([]models.VideoResult, 0)
-	for _, item := range results {
-		if videoID, ok := item["videoId"].(string); ok {
-			video := models.VideoResult{
-				ID:    videoID,
-				Title: getString(item, "title"),
-			}
-
-			// Get author
-			if ownerText, ok := item["ownerText"].(map[string]interface{}); ok {
-				if runs, ok := ownerText["runs"].([]interface{}); ok && len(runs) > 0 {
-					if run, ok := runs[0].(map[string]interface{}); ok {
-						video.Author = getString(run, "text")
-					}
-				}
-			}
-
-			// Get duration
-			if lengthText, ok := item["lengthText"].(map[string]interface{}); ok {
-				video.Duration = getString(lengthText, "simpleText")
-			}
-
-			// Get views
-			if viewCount, ok := item["viewCountText"].(map[string]interface{}); ok {
-				video.Views = getString(viewCount, "simpleText")
-			}
-
-			// Get thumbnails
-			if thumbnail, ok := item["thumbnail"].(map[string]interface{}); ok {
-				video.Thumbnails = extractThumbnails(thumbnail)
-			}
-
-			videos = append(videos, video)
-		}
-	}
-
-	return videos, nil
-}
-
-// searchYouTubeRaw performs raw YouTube search using InnerTube API
-func searchYouTubeRaw(query string, searchType string) ([]map[string]interface{}, error) {
-	ctx := context.Background()
-
-	// Build InnerTube API request
-	apiURL := "https://www.youtube.com/youtubei/v1/search?prettyPrint=false"
-
+func (s *YouTubeService) searchYouTube(ctx context.Context, query string, searchType string) ([]models.VideoResult, error) {
 	payload := map[string]interface{}{
-		"context": map[string]interface{}{
-			"client": map[string]interface{}{
-				"clientName":    "WEB",
-				"clientVersion": "2.20231219.04.00",
-				"hl":            "en",
-				"gl":            "US",
-			},
-		},
-		"query": query,
+		"context": s.web.innertubeContext(),
+		"query":   query,
 	}
 
 	// Note: Params filtering removed - InnerTube API filter params are unreliable
-	// Results are filtered by renderer type in extractSearchResults instead
-
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
+	// Results are filtered by renderer type in videoRenderers instead
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(string(payloadBytes)))
-	if err != nil {
+	var response searchResponse
+	if err := s.web.request(ctx, "search", payload, &response); err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-	resp, err := http.DefaultClient.Do(req)
+	renderers, err := response.videoRenderers()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	// Extract video/playlist results from response
-	return extractSearchResults(result), nil
-}
-
-func extractSearchResults(data map[string]interface{}) []map[string]interface{} {
-	results := make([]map[string]interface{}, 0)
-
-	// Navigate through the nested response structure
-	contents, ok := data["contents"].(map[string]interface{})
-	if !ok {
-		return results
-	}
-
-	twoColumnResults, ok := contents["twoColumnSearchResultsRenderer"].(map[string]interface{})
-	if !ok {
-		return results
-	}
-
-	primaryContents, ok := twoColumnResults["primaryContents"].(map[string]interface{})
-	if !ok {
-		return results
-	}
-
-	sectionListRenderer, ok := primaryContents["sectionListRenderer"].(map[string]interface{})
-	if !ok {
-		return results
-	}
-
-	sectionContents, ok := sectionListRenderer["contents"].([]interface{})
-	if !ok {
-		return results
-	}
-
-	for _, section := range sectionContents {
-		sectionMap, ok := section.(map[string]interface{})
-		if !ok {
-			continue
-		}
 
-		itemSectionRenderer, ok := sectionMap["itemSectionRenderer"].(map[string]interface{})
-		if !ok {
-			continue
+	now := time.Now()
+	videos := make([]models.VideoResult, 0, len(renderers))
+	for _, r := range renderers {
+		video := models.VideoResult{
+			ID:          r.VideoID,
+			Title:       r.Title.String(),
+			Author:      r.OwnerText.First(),
+			Duration:    r.LengthText.String(),
+			DurationSec: parseClockDuration(r.LengthText.String()),
+			// Live streams report "1,234 watching" as runs
+			Views:      r.ViewCountText.String(),
+			ViewCount:  parseViewCount(r.ViewCountText.String()),
+			Published:  r.PublishedTimeText.String(),
+			Thumbnails: r.Thumbnail.convert(s.thumbnailProxy),
 		}
-
-		items, ok := itemSectionRenderer["contents"].([]interface{})
-		if !ok {
-			continue
+		if video.Published != "" {
+			video.PublishedAt = parsePublishedTime(video.Published, now)
 		}
+		applyBadges(&video, r)
 
-		for _, item := range items {
-			itemMap, ok := item.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			// Check for video renderer
-			if videoRenderer, ok := itemMap["videoRenderer"].(map[string]interface{}); ok {
-				results = append(results, videoRenderer)
-			}
-
-			// Check for playlist renderer (multiple possible keys)
-			if playlistRenderer, ok := itemMap["playlistRenderer"].(map[string]interface{}); ok {
-				results = append(results, playlistRenderer)
-			}
-
-			// Check for compact playlist renderer
-			if compactPlaylist, ok := itemMap["compactPlaylistRenderer"].(map[string]interface{}); ok {
-				results = append(results, compactPlaylist)
-			}
-
-			// Check for grid playlist renderer
-			if gridPlaylist, ok := itemMap["gridPlaylistRenderer"].(map[string]interface{}); ok {
-				results = append(results, gridPlaylist)
-			}
-		}
+		videos = append(videos, video)
 	}
 
-	return results
+	annotateVideos(videos)
+	return videos, nil
 }
 
-func getString(m map[string]interface{}, key string) string {
-	if val, ok := m[key]; ok {
-		switch v := val.(type) {
-		case string:
-			return v
-		case map[string]interface{}:
-			// Handle nested text objects like {"simpleText": "..."} or {"runs": [...]}
-			if simpleText, ok := v["simpleText"].(string); ok {
-				return simpleText
-			}
-			if runs, ok := v["runs"].([]interface{}); ok && len(runs) > 0 {
-				if run, ok := runs[0].(map[string]interface{}); ok {
-					if text, ok := run["text"].(string); ok {
-						return text
-					}
-				}
-			}
+// applyBadges reads the metadata badges (live, new, CC, 4K, ...) and
+// thumbnail overlays of a video renderer into the badge fields of a result
+func applyBadges(video *models.VideoResult, r *videoRenderer) {
+	for _, badge := range r.Badges {
+		if badge.MetadataBadgeRenderer == nil {
+			continue
 		}
-	}
-	return ""
-}
-
-func extractThumbnails(thumbnail map[string]interface{}) []models.Thumbnail {
-	thumbnails := make([]models.Thumbnail, 0)
-	if thumbList, ok := thumbnail["thumbnails"].([]interface{}); ok {
-		for _, t := range thumbList {
-			if thumbMap, ok := t.(map[string]interface{}); ok {
-				thumb := models.Thumbnail{}
-				if url, ok := thumbMap["url"].(string); ok {
-					thumb.URL = url
-				}
-				if width, ok := thumbMap["width"].(float64); ok {
-					thumb.Width = int(width)
-				}
-				if height, ok := thumbMap["height"].(float64); ok {
-					thumb.Height = int(height)
-				}
-				thumbnails = append(thumbnails, thumb)
-			}
+		label := badge.MetadataBadgeRenderer.Label
+
+		switch {
+		case badge.MetadataBadgeRenderer.Style == "BADGE_STYLE_TYPE_LIVE_NOW" || strings.EqualFold(label, "live"):
+			video.IsLive = true
+		case strings.EqualFold(label, "new"):
+			video.IsNew = true
+		case label == "CC":
+			video.HasCaptions = true
+		}
+		if label != "" {
+			video.Badges = append(video.Badges, label)
 		}
-	}
-	return thumbnails
-}
-
-// ExtractVideoID extracts video ID from various YouTube URL formats
-func ExtractVideoID(input string) string {
-	// If it's already a video ID (11 characters, alphanumeric with - and _)
-	if matched, _ := regexp.MatchString(`^[a-zA-Z0-9_-]{11}$`, input); matched {
-		return input
-	}
-
-	// Try to parse as URL
-	u, err := url.Parse(input)
-	if err != nil {
-		return input
-	}
-
-	// Handle youtu.be URLs
-	if u.Host == "youtu.be" {
-		return strings.TrimPrefix(u.Path, "/")
 	}
 
-	// Handle youtube.com URLs
-	if strings.Contains(u.Host, "youtube.com") {
-		// Check for /watch?v=ID format
-		if v := u.Query().Get("v"); v != "" {
-			return v
-		}
-		// Check for /embed/ID format
-		if strings.HasPrefix(u.Path, "/embed/") {
-			return strings.TrimPrefix(u.Path, "/embed/")
-		}
-		// Check for /v/ID format
-		if strings.HasPrefix(u.Path, "/v/") {
-			return strings.TrimPrefix(u.Path, "/v/")
+	// Live streams are also flagged on the thumbnail overlay
+	for _, overlay := range r.ThumbnailOverlays {
+		if overlay.ThumbnailOverlayTimeStatusRenderer != nil && overlay.ThumbnailOverlayTimeStatusRenderer.Style == "LIVE" {
+			video.IsLive = true
 		}
 	}
-
-	return input
 }
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"musiq/internal/fakeyoutube"
+	"musiq/models"
+)
+
+// fakeMediaSize is the length of the synthetic streams fakeyoutube serves
+const fakeMediaSize = 256 * 1024
+
+// newFakeService returns a service talking to a fresh fakeyoutube server,
+// retrying without delay
+func newFakeService(t *testing.T) *YouTubeService {
+	t.Helper()
+	server := httptest.NewServer(fakeyoutube.New("testdata"))
+	t.Cleanup(server.Close)
+	return NewYouTubeService(WithBaseURL(server.URL), WithRetryBackoff(0))
+}
+
+func TestYouTubeServiceSearch(t *testing.T) {
+	s := newFakeService(t)
+	ctx := context.Background()
+
+	videos, err := s.SearchVideos(ctx, "lofi")
+	if err != nil {
+		t.Fatalf("SearchVideos() error = %v", err)
+	}
+	if len(videos) != 2 || videos[0].ID != "jfKfPfyJRdk" || videos[1].ID != "dQw4w9WgXcQ" {
+		t.Fatalf("SearchVideos() = %+v, want jfKfPfyJRdk and dQw4w9WgXcQ", videos)
+	}
+	if !videos[0].IsLive || videos[1].DurationSec != 213 || videos[1].Metadata == nil || videos[1].Metadata.Artist != "Rick Astley" {
+		t.Errorf("SearchVideos() results not fully parsed: %+v", videos)
+	}
+
+	music, err := s.SearchMusic(ctx, "daft punk", "")
+	if err != nil {
+		t.Fatalf("SearchMusic() error = %v", err)
+	}
+	if len(music.Songs) != 1 || len(music.Albums) != 1 || len(music.Artists) != 1 || len(music.Playlists) != 1 {
+		t.Errorf("SearchMusic() = %+v, want one result of each type", music)
+	}
+
+	playlist, err := s.GetPlaylistVideos(ctx, "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf", 0, 0)
+	if err != nil {
+		t.Fatalf("GetPlaylistVideos() error = %v", err)
+	}
+	if playlist.Title != "Synthwave Essentials" || len(playlist.Videos) != 2 || playlist.Videos[0].ID != "MV_3Dpw-BRY" {
+		t.Errorf("GetPlaylistVideos() = %+v", playlist)
+	}
+}
+
+func TestYouTubeServiceThumbnailProxy(t *testing.T) {
+	server := httptest.NewServer(fakeyoutube.New("testdata"))
+	t.Cleanup(server.Close)
+	proxied := NewYouTubeService(WithBaseURL(server.URL), WithThumbnailProxyURL("/api/thumb/"))
+	direct := newFakeService(t)
+	ctx := context.Background()
+
+	videos, err := proxied.SearchVideos(ctx, "lofi")
+	if err != nil {
+		t.Fatalf("SearchVideos() error = %v", err)
+	}
+	thumbnail := videos[1].Thumbnails[0]
+	if want := "/api/thumb/dQw4w9WgXcQ?w=" + strconv.Itoa(thumbnail.Width); thumbnail.URL != want {
+		t.Errorf("proxied thumbnail = %q, want %q", thumbnail.URL, want)
+	}
+	if got := proxied.ThumbnailURL("dQw4w9WgXcQ", 480); got != "/api/thumb/dQw4w9WgXcQ?w=480" {
+		t.Errorf("ThumbnailURL() = %q", got)
+	}
+
+	// Another service keeps linking to YouTube
+	videos, err = direct.SearchVideos(ctx, "lofi")
+	if err != nil {
+		t.Fatalf("SearchVideos() error = %v", err)
+	}
+	if url := videos[1].Thumbnails[0].URL; !strings.Contains(url, "ytimg.com") {
+		t.Errorf("direct thumbnail = %q, want i.ytimg.com", url)
+	}
+	if got := direct.ThumbnailURL("dQw4w9WgXcQ", 480); got != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" {
+		t.Errorf("ThumbnailURL() = %q", got)
+	}
+}
+
+func TestYouTubeServiceMixPages(t *testing.T) {
+	s := newFakeService(t)
+	ctx := context.Background()
+
+	// The fixture mix has two videos; pages are cut from one crawl
+	var ids []string
+	for offset := 0; offset < 3; offset++ {
+		page, err := s.GetPlaylistVideos(ctx, "RDdQw4w9WgXcQ", offset, 1)
+		if err != nil {
+			t.Fatalf("GetPlaylistVideos(offset %d) error = %v", offset, err)
+		}
+		if !page.Endless {
+			t.Errorf("mix page %d isn't marked endless", offset)
+		}
+		for _, video := range page.Videos {
+			ids = append(ids, video.ID)
+		}
+	}
+	if len(ids) != 2 || ids[0] != "dQw4w9WgXcQ" || ids[1] != "yPYZpwSpKmA" {
+		t.Errorf("mix pages = %q, want dQw4w9WgXcQ then yPYZpwSpKmA", ids)
+	}
+}
+
+func TestYouTubeServicePlayer(t *testing.T) {
+	tests := []struct {
+		name    string
+		videoID string
+		// client is the player client expected to answer
+		client string
+	}{
+		{name: "plain video", videoID: "dQw4w9WgXcQ", client: "ANDROID"},
+		// The first request fails with 503 and is retried with the same client
+		{name: "flaky upstream", videoID: "FLAKY000001", client: "ANDROID"},
+		// Age-restricted videos are only played by the embedded TV client
+		{name: "login required", videoID: "LOGIN000001", client: "TVHTML5_SIMPLY_EMBEDDED_PLAYER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeService(t)
+
+			video, client, err := s.video(context.Background(), tt.videoID)
+			if err != nil {
+				t.Fatalf("video() error = %v", err)
+			}
+			if video.ID != tt.videoID {
+				t.Errorf("video ID = %q, want %q", video.ID, tt.videoID)
+			}
+			if got := s.retry.clients[client].name; got != tt.client {
+				t.Errorf("answered by %s, want %s", got, tt.client)
+			}
+
+			info, err := s.GetVideoInfo(context.Background(), tt.videoID)
+			if err != nil {
+				t.Fatalf("GetVideoInfo() error = %v", err)
+			}
+			if info.DurationSec != 213 || len(info.Formats) == 0 {
+				t.Errorf("GetVideoInfo() = %+v", info)
+			}
+		})
+	}
+}
+
+func TestYouTubeServiceVideoInfoCopy(t *testing.T) {
+	s := newFakeService(t)
+	ctx := context.Background()
+
+	first, err := s.GetVideoInfo(ctx, "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetVideoInfo() error = %v", err)
+	}
+	want := *first.Metadata
+	first.Formats[0].ItagNo = -1
+	first.Thumbnails = append(first.Thumbnails[:0], models.Thumbnail{URL: "changed"})
+	first.Metadata.Artist = "changed"
+	if first.PublishedAt != nil {
+		*first.PublishedAt = first.PublishedAt.AddDate(-1, 0, 0)
+	}
+
+	// The second call is served from the cached info
+	second, err := s.GetVideoInfo(ctx, "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("GetVideoInfo() error = %v", err)
+	}
+	if second.Formats[0].ItagNo == -1 || second.Thumbnails[0].URL == "changed" || second.Metadata.Artist != want.Artist {
+		t.Errorf("GetVideoInfo() = %+v, changed through an earlier result", second)
+	}
+	if first.PublishedAt != nil && second.PublishedAt.Equal(*first.PublishedAt) {
+		t.Errorf("PublishedAt = %v, changed through an earlier result", second.PublishedAt)
+	}
+}
+
+func TestYouTubeServiceAudioStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		videoID string
+	}{
+		{name: "plain stream", videoID: "dQw4w9WgXcQ"},
+		// The first player response carries URLs that already expired,
+		// so the stream is re-resolved
+		{name: "expired URL", videoID: "EXPIR000001"},
+		// The first two requests drop halfway; the stream resumes from the
+		// last byte read
+		{name: "dropped connection", videoID: "DROPS000001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeService(t)
+
+			stream, size, err := s.GetAudioStream(context.Background(), tt.videoID)
+			if err != nil {
+				t.Fatalf("GetAudioStream() error = %v", err)
+			}
+			defer stream.Close()
+
+			data, err := io.ReadAll(stream)
+			if err != nil {
+				t.Fatalf("reading the stream failed after %d bytes: %v", len(data), err)
+			}
+			if size != fakeMediaSize || len(data) != fakeMediaSize {
+				t.Fatalf("read %d of %d bytes, want %d", len(data), size, fakeMediaSize)
+			}
+			// Resumed streams must continue exactly where they broke off
+			for i, b := range data {
+				if b != byte(i%251) {
+					t.Fatalf("byte %d = %d, want %d", i, b, i%251)
+				}
+			}
+		})
+	}
+}
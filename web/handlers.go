@@ -1,6 +1,10 @@
 package web
 
 import (
+	"slices"
+	"strconv"
+
+	"musiq/models"
 	"musiq/services"
 	"musiq/web/templates/components"
 	"musiq/web/templates/pages"
@@ -8,11 +12,26 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var youtubeService = services.NewYouTubeService()
+var youtubeService *services.YouTubeService
+var suggestService *services.SuggestService
+var searchHistory *services.HistorySuggestProvider
+var mediaSources *services.Sources
+
+// Configure sets the services the UI handlers use
+func Configure(s *services.Services) {
+	youtubeService = s.YouTube
+	suggestService = s.Suggest
+	searchHistory = s.History
+	mediaSources = s.Sources
+}
 
 // HomePage renders the main page
 func HomePage(c *gin.Context) {
-	pages.Home().Render(c.Request.Context(), c.Writer)
+	selected := ""
+	if hl, gl := cookieValue(c, "hl"), cookieValue(c, "gl"); hl != "" && gl != "" {
+		selected = hl + "_" + gl
+	}
+	pages.Home(selected).Render(c.Request.Context(), c.Writer)
 }
 
 // SearchResultsView returns search results as HTML partial
@@ -23,13 +42,36 @@ func SearchResultsView(c *gin.Context) {
 		return
 	}
 
-	results, err := youtubeService.SearchVideos(query)
+	// Searches run while typing would fill the history with prefixes of
+	// the query, so only submitted ones are recorded
+	if c.Query("submit") == "1" {
+		searchHistory.Record(query)
+	}
+
+	results, err := mediaSources.Search(c.Request.Context(), query, requestLocale(c))
 	if err != nil {
 		components.VideoGrid(nil).Render(c.Request.Context(), c.Writer)
 		return
 	}
 
-	components.VideoGrid(results).Render(c.Request.Context(), c.Writer)
+	components.VideoGrid(withThumbnails(results)).Render(c.Request.Context(), c.Writer)
+}
+
+// SuggestView returns search completions as an HTML partial for the dropdown
+func SuggestView(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		components.Suggestions(nil).Render(c.Request.Context(), c.Writer)
+		return
+	}
+
+	suggestions, err := suggestService.Suggest(c.Request.Context(), query, requestLocale(c))
+	if err != nil {
+		components.Suggestions(nil).Render(c.Request.Context(), c.Writer)
+		return
+	}
+
+	components.Suggestions(suggestions).Render(c.Request.Context(), c.Writer)
 }
 
 // PlayerView returns the audio/video player as HTML partial
@@ -38,7 +80,7 @@ func PlayerView(c *gin.Context) {
 	playerType := c.DefaultQuery("type", "audio")
 
 	// Get video info for title and author
-	info, err := youtubeService.GetVideoInfo(videoID)
+	info, err := mediaSources.Info(c.Request.Context(), videoID, requestLocale(c))
 	title := "Unknown"
 	author := "Unknown"
 	if err == nil {
@@ -57,7 +99,7 @@ func PlaylistSearchView(c *gin.Context) {
 		return
 	}
 
-	results, err := youtubeService.SearchPlaylists(query)
+	results, err := localizedService(c).SearchPlaylists(c.Request.Context(), query)
 	if err != nil {
 		components.PlaylistGrid(nil).Render(c.Request.Context(), c.Writer)
 		return
@@ -66,15 +108,57 @@ func PlaylistSearchView(c *gin.Context) {
 	components.PlaylistGrid(results).Render(c.Request.Context(), c.Writer)
 }
 
-// PlaylistVideosView returns videos in a playlist as HTML partial
+// PlaylistVideosView returns a page of videos in a playlist as HTML partial
 func PlaylistVideosView(c *gin.Context) {
 	playlistID := c.Param("id")
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	videos, err := youtubeService.GetPlaylistVideos(playlistID)
+	playlist, err := mediaSources.Playlist(c.Request.Context(), playlistID, offset, services.DefaultPlaylistLimit, requestLocale(c))
 	if err != nil {
 		components.PlaylistVideos(nil).Render(c.Request.Context(), c.Writer)
 		return
 	}
 
-	components.PlaylistVideos(videos).Render(c.Request.Context(), c.Writer)
+	withVideoThumbnails := *playlist
+	withVideoThumbnails.Videos = withThumbnails(playlist.Videos)
+	components.PlaylistVideos(&withVideoThumbnails).Render(c.Request.Context(), c.Writer)
+}
+
+// withThumbnails gives YouTube videos without thumbnails the one YouTube
+// serves for their ID. Results can come from a cache, so they are copied.
+func withThumbnails(videos []models.VideoResult) []models.VideoResult {
+	videos = slices.Clone(videos)
+	for i, video := range videos {
+		if len(video.Thumbnails) == 0 && video.Source != "local" {
+			videos[i].Thumbnails = []models.Thumbnail{{URL: youtubeService.ThumbnailURL(video.ID, 480), Width: 480, Height: 270}}
+		}
+	}
+	return videos
+}
+
+// requestLocale reads the locale from hl/gl query parameters, then the
+// cookies set by the locale selector, then Accept-Language. Malformed values
+// are ignored rather than failing the partial.
+func requestLocale(c *gin.Context) services.Locale {
+	hl := c.DefaultQuery("hl", cookieValue(c, "hl"))
+	gl := c.DefaultQuery("gl", cookieValue(c, "gl"))
+
+	locale, err := services.ParseLocale(hl, gl, c.GetHeader("Accept-Language"))
+	if err != nil {
+		locale, _ = services.ParseLocale("", "", c.GetHeader("Accept-Language"))
+	}
+	return locale
+}
+
+// localizedService returns the YouTube service for the request's locale
+func localizedService(c *gin.Context) *services.YouTubeService {
+	return youtubeService.ForLocale(requestLocale(c))
+}
+
+func cookieValue(c *gin.Context, name string) string {
+	value, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
 }
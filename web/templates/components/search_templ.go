@@ -29,7 +29,7 @@ func Search() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"relative\"><div class=\"flex gap-3\"><div class=\"flex-1 relative\"><span class=\"absolute left-4 top-1/2 -translate-y-1/2 text-2xl\">🔍</span> <input type=\"search\" id=\"search-input\" name=\"q\" placeholder=\"Search for music, videos, playlists...\" hx-get=\"/ui/search\" hx-trigger=\"keyup changed delay:300ms, search\" hx-target=\"#results\" hx-indicator=\"#loading\" class=\"neo-input pl-14 text-lg font-medium\"></div></div><div id=\"loading\" class=\"htmx-indicator mt-4\"><div class=\"neo-card p-4 text-center\"><div class=\"inline-flex items-center gap-2\"><div class=\"w-4 h-4 bg-neo-yellow border-2 border-neo-border animate-bounce\"></div><div class=\"w-4 h-4 bg-neo-blue border-2 border-neo-border animate-bounce\" style=\"animation-delay: 0.1s\"></div><div class=\"w-4 h-4 bg-neo-red border-2 border-neo-border animate-bounce\" style=\"animation-delay: 0.2s\"></div></div><p class=\"mt-2 font-semibold\">Searching...</p></div></div></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"relative\"><div class=\"flex gap-3\"><div class=\"flex-1 relative\" x-data=\"{ open: false, pick(q) { const input = document.getElementById('search-input'); input.value = q; this.open = false; htmx.trigger(input, 'search') } }\" @click.outside=\"open = false\"><span class=\"absolute left-4 top-1/2 -translate-y-1/2 text-2xl\">🔍</span><!-- Enter and picked suggestions send submit=1; only those searches are kept in the history --><input type=\"search\" id=\"search-input\" name=\"q\" placeholder=\"Search for music, videos, playlists...\" hx-get=\"/ui/search\" hx-trigger=\"keyup changed delay:300ms, search, refresh\" hx-target=\"#results\" hx-indicator=\"#loading\" autocomplete=\"off\" @htmx:config-request=\"if ($event.detail.triggeringEvent?.type === 'search') $event.detail.parameters.submit = '1'\" @input=\"open = true\" @keydown.escape=\"open = false\" @search=\"open = false\" class=\"neo-input pl-14 text-lg font-medium\"><!-- Suggestions load here via HTMX --><div id=\"suggestions\" hx-get=\"/ui/suggest\" hx-trigger=\"input changed delay:150ms from:#search-input\" hx-include=\"#search-input\" hx-swap=\"innerHTML\" x-show=\"open\" class=\"neo-suggest\"></div></div></div><div id=\"loading\" class=\"htmx-indicator mt-4\"><div class=\"neo-card p-4 text-center\"><div class=\"inline-flex items-center gap-2\"><div class=\"w-4 h-4 bg-neo-yellow border-2 border-neo-border animate-bounce\"></div><div class=\"w-4 h-4 bg-neo-blue border-2 border-neo-border animate-bounce\" style=\"animation-delay: 0.1s\"></div><div class=\"w-4 h-4 bg-neo-red border-2 border-neo-border animate-bounce\" style=\"animation-delay: 0.2s\"></div></div><p class=\"mt-2 font-semibold\">Searching...</p></div></div></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}